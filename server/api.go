@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// ErrForbidden is returned when the requesting user may not perform an action.
+var ErrForbidden = errors.New("forbidden")
+
+// Errors returned when an uploaded attachment breaks the configured limits.
+var (
+	ErrAttachmentTooLarge       = errors.New("attachment is too large")
+	ErrAttachmentTypeNotAllowed = errors.New("attachment type is not allowed")
+)
+
+// badRequestError reports invalid input supplied by the client.
+type badRequestError struct {
+	message string
+}
+
+func (e *badRequestError) Error() string {
+	return e.message
+}
+
+func newBadRequestError(message string) error {
+	return &badRequestError{message: message}
+}
+
+// initRouter registers every HTTP route served by the plugin.
+func (p *Plugin) initRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(p.instrumentRequests)
+
+	// The metrics route authenticates scrapers itself, as they may not carry a user session.
+	router.HandleFunc("/metrics", p.handleMetrics).Methods(http.MethodGet)
+
+	// Incoming webhooks authenticate with a token instead of a user session.
+	incoming := router.PathPrefix("/incoming").Subrouter()
+	incoming.Use(p.requireIncomingToken, p.rateLimit, p.auditMutations)
+	incoming.HandleFunc("/petitions", p.handleIncomingPetition).Methods(http.MethodPost).Name("petition.submit")
+
+	// Calendar apps authenticate with the secret token in the feed URL.
+	router.Handle(calendarFeedPath("{token:[a-z0-9]+}"), p.requireCalendarToken(p.rateLimit(http.HandlerFunc(p.handleCalendarFeed)))).Methods(http.MethodGet)
+
+	// Telemetry events are counted rather than audited.
+	telemetry := router.PathPrefix("/telemetry").Subrouter()
+	telemetry.Use(p.requireUser, p.rateLimit)
+	telemetry.HandleFunc("", p.handleRecordTelemetry).Methods(http.MethodPost)
+	telemetry.Handle("", p.requirePluginAdmin(http.HandlerFunc(p.handleGetTelemetry))).Methods(http.MethodGet)
+
+	api := router.PathPrefix("/").Subrouter()
+	api.Use(p.requireUser, p.rateLimit, p.auditMutations)
+
+	api.HandleFunc("/add", p.handleAddIssue).Methods(http.MethodPost).Name("issue.create")
+	api.HandleFunc("/list", p.handleListIssues).Methods(http.MethodGet)
+	api.HandleFunc("/edit", p.handleEditIssue).Methods(http.MethodPut).Name("issue.update")
+	api.HandleFunc("/change_assignment", p.handleChangeAssignment).Methods(http.MethodPost).Name("issue.reassign")
+	api.HandleFunc("/accept", p.handleAcceptIssue).Methods(http.MethodPost).Name("issue.accept")
+	api.HandleFunc("/complete", p.handleCompleteIssue).Methods(http.MethodPost).Name("issue.complete")
+	api.HandleFunc("/remove", p.handleRemoveIssue).Methods(http.MethodPost).Name("issue.delete")
+	p.initChecklistRoutes(api.PathPrefix("/issues/{id}/subtasks").Subrouter(), KindIssue, p.updateIssueChecklist)
+	p.initChannelIssueRoutes(api.PathPrefix("/channels/{channel_id}/issues").Subrouter())
+
+	api.HandleFunc("/health", p.handleHealth).Methods(http.MethodGet)
+	api.HandleFunc("/search", p.handleSearch).Methods(http.MethodGet)
+	api.HandleFunc("/stats", p.handleGetStats).Methods(http.MethodGet)
+
+	api.HandleFunc("/email/preferences", p.handleGetEmailPreferences).Methods(http.MethodGet)
+	api.HandleFunc("/email/preferences", p.handleUpdateEmailPreferences).Methods(http.MethodPut).Name("email_preferences.update")
+
+	api.HandleFunc("/calendar/token", p.handleGetCalendarToken).Methods(http.MethodGet)
+	api.HandleFunc("/calendar/token", p.handleCreateCalendarToken).Methods(http.MethodPost).Name("calendar_token.create")
+	api.HandleFunc("/calendar/token", p.handleRevokeCalendarToken).Methods(http.MethodDelete).Name("calendar_token.delete")
+
+	api.HandleFunc("/topics", p.handleListTopics).Methods(http.MethodGet)
+	api.Handle("/topics/refresh", p.requirePluginAdmin(http.HandlerFunc(p.handleRefreshTopics))).Methods(http.MethodPost).Name("topics.refresh")
+
+	api.HandleFunc("/categories", p.handleListCategories).Methods(http.MethodGet)
+	api.HandleFunc("/categories", p.handleCreateCategory).Methods(http.MethodPost).Name("category.create")
+
+	api.HandleFunc("/requests", p.handleListPetitions).Methods(http.MethodGet)
+	api.HandleFunc("/requests", p.handleCreatePetition).Methods(http.MethodPost).Name("petition.create")
+	api.HandleFunc("/requests/export", p.handleExportPetitions).Methods(http.MethodGet)
+	api.HandleFunc("/requests/duplicates", p.handleFindDuplicates).Methods(http.MethodPost)
+	api.HandleFunc("/requests/category-suggestion", p.handleSuggestCategory).Methods(http.MethodPost)
+	api.HandleFunc("/requests/forward/{id}", p.handleForwardPetition).Methods(http.MethodPost).Name("petition.forward")
+	api.HandleFunc("/requests/{id}", p.handleGetPetition).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}", p.handleUpdatePetition).Methods(http.MethodPut).Name("petition.update")
+	api.HandleFunc("/requests/{id}", p.handleDeletePetition).Methods(http.MethodDelete).Name("petition.delete")
+	p.initChecklistRoutes(api.PathPrefix("/requests/{id}/subtasks").Subrouter(), KindPetition, p.updatePetitionChecklist)
+	api.HandleFunc("/requests/{id}/comments", p.handleListComments).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}/comments", p.handleAddComment).Methods(http.MethodPost).Name("comment.create")
+	api.HandleFunc("/requests/{id}/comments/{comment_id}", p.handleEditComment).Methods(http.MethodPut).Name("comment.update")
+	api.HandleFunc("/requests/{id}/comments/{comment_id}", p.handleDeleteComment).Methods(http.MethodDelete).Name("comment.delete")
+	api.HandleFunc("/requests/{id}/pdf", p.handlePetitionDossier).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}/timeline", p.handleGetTimeline).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}/attachments", p.handleListAttachments).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}/attachments", p.handleUploadAttachment).Methods(http.MethodPost).Name("attachment.create")
+	api.HandleFunc("/requests/{id}/attachments/{file_id}", p.handleDownloadAttachment).Methods(http.MethodGet)
+	api.HandleFunc("/requests/{id}/attachments/{file_id}", p.handleDeleteAttachment).Methods(http.MethodDelete).Name("attachment.delete")
+	api.HandleFunc("/requests/{id}/watch", p.handleWatchPetition).Methods(http.MethodPost).Name("petition.watch")
+	api.HandleFunc("/requests/{id}/link", p.handleLinkPetition).Methods(http.MethodPost).Name("petition.link")
+	api.HandleFunc("/requests/{id}/merge", p.handleMergePetition).Methods(http.MethodPost).Name("petition.merge")
+	api.HandleFunc("/requests/{id}/watch", p.handleWatchPetition).Methods(http.MethodDelete).Name("petition.unwatch")
+
+	api.HandleFunc("/boards", p.handleListBoards).Methods(http.MethodGet)
+	api.HandleFunc("/boards", p.handleCreateBoard).Methods(http.MethodPost).Name("board.create")
+	api.HandleFunc("/boards/{id}", p.handleGetBoard).Methods(http.MethodGet)
+	api.HandleFunc("/boards/{id}", p.handleUpdateBoard).Methods(http.MethodPut).Name("board.update")
+	api.HandleFunc("/boards/{id}", p.handleDeleteBoard).Methods(http.MethodDelete).Name("board.delete")
+	api.HandleFunc("/boards/{id}/move", p.handleMoveCard).Methods(http.MethodPost).Name("board.move")
+
+	imports := api.PathPrefix("/imports").Subrouter()
+	imports.Use(p.requirePluginAdmin)
+	imports.HandleFunc("", p.handleCreateImport).Methods(http.MethodPost).Name("import.create")
+	imports.HandleFunc("/legacy", p.handleMigrateLegacy).Methods(http.MethodPost).Name("import.legacy")
+	imports.HandleFunc("/{id}", p.handleGetImport).Methods(http.MethodGet)
+	imports.HandleFunc("/{id}", p.handleDeleteImport).Methods(http.MethodDelete).Name("import.delete")
+	imports.HandleFunc("/{id}/commit", p.handleCommitImport).Methods(http.MethodPost).Name("import.commit")
+
+	roles := api.PathPrefix("/roles").Subrouter()
+	roles.Use(p.requirePluginAdmin)
+	roles.HandleFunc("", p.handleListRoles).Methods(http.MethodGet)
+	roles.HandleFunc("", p.handleAssignRole).Methods(http.MethodPost).Name("role.create")
+	roles.HandleFunc("/{id}", p.handleRevokeRole).Methods(http.MethodDelete).Name("role.delete")
+
+	categoryRules := api.PathPrefix("/category-rules").Subrouter()
+	categoryRules.Use(p.requirePluginAdmin)
+	categoryRules.HandleFunc("", p.handleListCategoryRules).Methods(http.MethodGet)
+	categoryRules.HandleFunc("", p.handleCreateCategoryRule).Methods(http.MethodPost).Name("category_rule.create")
+	categoryRules.HandleFunc("/test", p.handleTestCategoryRules).Methods(http.MethodPost)
+	categoryRules.HandleFunc("/stats", p.handleCategoryRuleStats).Methods(http.MethodGet)
+	categoryRules.HandleFunc("/{id}", p.handleDeleteCategoryRule).Methods(http.MethodDelete).Name("category_rule.delete")
+
+	audit := api.PathPrefix("/audit").Subrouter()
+	audit.Use(p.requirePluginAdmin)
+	audit.HandleFunc("", p.handleQueryAudit).Methods(http.MethodGet)
+	audit.HandleFunc("/verify", p.handleVerifyAudit).Methods(http.MethodGet)
+
+	webhooks := api.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(p.requirePluginAdmin)
+	p.initWebhookRoutes(webhooks)
+
+	diagnostics := api.PathPrefix("/diagnostics").Subrouter()
+	diagnostics.Use(p.requirePluginAdmin)
+	diagnostics.HandleFunc("", p.handleDiagnostics).Methods(http.MethodGet)
+
+	return router
+}
+
+// requireUser rejects requests that were not authenticated by the Mattermost server.
+func (p *Plugin) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mattermost-User-ID") == "" {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeTemplate returns the path template of the route matched by the request, or its path.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// decodeJSON reads the request body into v, reporting malformed input as a bad request.
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newBadRequestError("unable to decode JSON")
+	}
+	return nil
+}
+
+// writeJSON serializes v as the response body.
+func (p *Plugin) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		p.API.LogWarn("Failed to write JSON response", "error", err.Error())
+	}
+}
+
+// handleError maps err to the appropriate HTTP status code and writes it to the response.
+func (p *Plugin) handleError(w http.ResponseWriter, err error) {
+	cause := errors.Cause(err)
+
+	var badRequest *badRequestError
+	switch {
+	case errors.As(cause, &badRequest):
+		http.Error(w, badRequest.message, http.StatusBadRequest)
+	case cause == ErrNotFound:
+		http.Error(w, "Not found", http.StatusNotFound)
+	case cause == ErrForbidden:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case cause == ErrSubtasksOpen, cause == ErrImportRunning, cause == ErrIssueClaimed, cause == ErrIdempotencyKeyInUse:
+		http.Error(w, cause.Error(), http.StatusConflict)
+	case cause == ErrAttachmentTooLarge, cause == ErrImportTooLarge:
+		http.Error(w, cause.Error(), http.StatusRequestEntityTooLarge)
+	case cause == ErrAttachmentTypeNotAllowed:
+		http.Error(w, cause.Error(), http.StatusUnsupportedMediaType)
+	case cause == ErrTopicsUnavailable:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		p.API.LogError("Request failed", "error", err.Error())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
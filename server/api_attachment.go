@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// multipartOverhead is the room left for multipart headers on top of the attachment size limit.
+const multipartOverhead = 1024 * 1024
+
+// attachmentMimeType determines the MIME type of an uploaded file from its extension, falling
+// back to the type declared by the client and finally to content sniffing.
+func attachmentMimeType(filename, declared string, data []byte) string {
+	if byExtension := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExtension != "" {
+		declared = byExtension
+	}
+	if declared == "" || declared == "application/octet-stream" {
+		declared = http.DetectContentType(data)
+	}
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil {
+		return mediaType
+	}
+	return declared
+}
+
+// deleteAttachmentFile deletes the post holding an attachment's file, and the file with it.
+func (p *Plugin) deleteAttachmentFile(attachment *Attachment) {
+	if appErr := p.API.DeletePost(attachment.PostID); appErr != nil {
+		p.API.LogError("Failed to delete attachment file", "file_id", attachment.ID, "error", appErr.Error())
+	}
+}
+
+func (p *Plugin) handleListAttachments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	attachments, err := p.store.GetAttachments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if attachments == nil {
+		attachments = []*Attachment{}
+	}
+
+	p.writeJSON(w, attachments)
+}
+
+func (p *Plugin) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	config := p.getConfiguration()
+	maxBytes := config.MaxAttachmentBytes()
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			p.handleError(w, ErrAttachmentTooLarge)
+			return
+		}
+		p.handleError(w, newBadRequestError("a file is required"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		p.handleError(w, errors.Wrap(err, "failed to read attachment"))
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		p.handleError(w, ErrAttachmentTooLarge)
+		return
+	}
+
+	name := filepath.Base(header.Filename)
+	mimeType := attachmentMimeType(name, header.Header.Get("Content-Type"), data)
+	if !config.IsAllowedAttachmentType(mimeType) {
+		p.handleError(w, ErrAttachmentTypeNotAllowed)
+		return
+	}
+
+	// Files must belong to a channel; the bot's direct channel with itself keeps them out of
+	// sight of everyone, and the post holding a file lets it be deleted with the attachment.
+	channel, appErr := p.API.GetDirectChannel(p.botUserID, p.botUserID)
+	if appErr != nil {
+		p.handleError(w, errors.Wrap(appErr, "failed to get direct channel"))
+		return
+	}
+	info, appErr := p.API.UploadFile(data, channel.Id, name)
+	if appErr != nil {
+		p.handleError(w, errors.Wrap(appErr, "failed to upload attachment"))
+		return
+	}
+	post, appErr := p.API.CreatePost(&model.Post{UserId: p.botUserID, ChannelId: channel.Id, FileIds: []string{info.Id}})
+	if appErr != nil {
+		p.handleError(w, errors.Wrap(appErr, "failed to attach file"))
+		return
+	}
+
+	attachment := &Attachment{
+		ID:         info.Id,
+		PetitionID: petition.ID,
+		PostID:     post.Id,
+		UserID:     userID,
+		Name:       name,
+		MimeType:   mimeType,
+		Size:       int64(len(data)),
+		CreateAt:   model.GetMillis(),
+	}
+	if err := p.store.SaveAttachment(attachment); err != nil {
+		p.deleteAttachmentFile(attachment)
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindAttachment, attachment.ID, nil, attachment)
+
+	p.writeJSON(w, attachment)
+}
+
+func (p *Plugin) handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+
+	petition, err := p.getVisiblePetition(userID, vars["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	attachment, err := p.store.GetAttachment(petition.ID, vars["file_id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	data, appErr := p.API.GetFile(attachment.ID)
+	if appErr != nil {
+		p.handleError(w, errors.Wrap(appErr, "failed to get attachment"))
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := w.Write(data); err != nil {
+		p.API.LogWarn("Failed to write attachment", "error", err.Error())
+	}
+}
+
+func (p *Plugin) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+
+	petition, err := p.getVisiblePetition(userID, vars["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	var deleted *Attachment
+	err = p.store.DeleteAttachment(petition.ID, vars["file_id"], func(attachment *Attachment) error {
+		if attachment.UserID != userID && !a.IsPluginAdmin() {
+			return ErrForbidden
+		}
+		deleted = attachment
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.deleteAttachmentFile(deleted)
+	p.auditChange(r, auditKindAttachment, deleted.ID, deleted, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
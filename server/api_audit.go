@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// headerRequestID carries the ID correlating a request with its audit record.
+const headerRequestID = "X-Request-Id"
+
+// auditSortField is the cursor sort field of the audit query route.
+const auditSortField = "seq"
+
+// auditEntry is the target and snapshots of a record changed by a mutating request.
+type auditEntry struct {
+	kind   string
+	id     string
+	before interface{}
+	after  interface{}
+}
+
+// auditEntries collects the records changed by a mutating request for the audit middleware.
+type auditEntries struct {
+	entries []*auditEntry
+}
+
+type auditContextKey struct{}
+
+// auditChange describes a record changed by a mutating request. before and after are the
+// record's state around the change, either of which is nil for creations and deletions; states
+// captured inside atomic updates are passed as returned by auditSnapshot. Requests changing
+// several records call it once for each, and get one audit record for each.
+func (p *Plugin) auditChange(r *http.Request, kind, id string, before, after interface{}) {
+	if changes, ok := r.Context().Value(auditContextKey{}).(*auditEntries); ok {
+		changes.entries = append(changes.entries, &auditEntry{kind: kind, id: id, before: before, after: after})
+	}
+}
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// auditMutations appends a record to the audit log for every successful request that may
+// mutate data. The action is the route name; handlers describe the change with auditChange.
+// Routes left unnamed are read-only, such as POST queries, and are not audited.
+func (p *Plugin) auditMutations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions || route == nil || route.GetName() == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		action := route.GetName()
+
+		requestID := r.Header.Get(headerRequestID)
+		if requestID == "" {
+			requestID = model.NewId()
+		}
+		w.Header().Set(headerRequestID, requestID)
+
+		changes := &auditEntries{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, changes)))
+		if recorder.status >= http.StatusBadRequest {
+			return
+		}
+		if len(changes.entries) == 0 {
+			changes.entries = []*auditEntry{{id: mux.Vars(r)["id"]}}
+		}
+
+		for _, entry := range changes.entries {
+			record := &AuditRecord{
+				ActorID:    r.Header.Get("Mattermost-User-ID"),
+				Action:     action,
+				TargetKind: entry.kind,
+				TargetID:   entry.id,
+				RequestID:  requestID,
+				Changes:    diffSnapshots(auditSnapshot(entry.before), auditSnapshot(entry.after)),
+			}
+			if err := p.store.AppendAuditRecord(record); err != nil {
+				// The response is already sent, so the failure can only be reported in the server log.
+				p.API.LogError("Failed to append audit record", "action", action, "target_id", entry.id, "request_id", requestID, "error", err.Error())
+			}
+		}
+	})
+}
+
+// matchesAuditQuery reports whether record satisfies the filters of the audit query route.
+// An action ending with a dot selects every action starting with it.
+func matchesAuditQuery(record *AuditRecord, actorID, action, kind, targetID string, since, until int64) bool {
+	if action != "" {
+		if strings.HasSuffix(action, ".") {
+			if !strings.HasPrefix(record.Action, action) {
+				return false
+			}
+		} else if record.Action != action {
+			return false
+		}
+	}
+	return (actorID == "" || record.ActorID == actorID) &&
+		(kind == "" || record.TargetKind == kind) &&
+		(targetID == "" || record.TargetID == targetID) &&
+		inDateRange(record.CreateAt, since, until)
+}
+
+// handleQueryAudit returns audit records, newest first, filtered by the actor, action, kind,
+// target, from and to query parameters. Results are paginated with per_page and cursor.
+func (p *Plugin) handleQueryAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since, until, err := parseDateRange(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	perPage := defaultPerPage
+	if raw := query.Get("per_page"); raw != "" {
+		if perPage, err = strconv.Atoi(raw); err != nil || perPage <= 0 {
+			p.handleError(w, newBadRequestError("invalid per_page"))
+			return
+		}
+		if perPage > maxPerPage {
+			perPage = maxPerPage
+		}
+	}
+
+	seq, err := p.store.LastAuditSeq()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if after.Sort != auditSortField {
+			p.handleError(w, newBadRequestError("invalid cursor"))
+			return
+		}
+		seq = after.Num - 1
+	}
+
+	records := []*AuditRecord{}
+	for ; seq > 0 && len(records) < perPage; seq-- {
+		record, err := p.store.GetAuditRecord(seq)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if matchesAuditQuery(record, query.Get("actor"), query.Get("action"), query.Get("kind"), query.Get("target"), since, until) {
+			records = append(records, record)
+		}
+	}
+	if seq > 0 {
+		w.Header().Set(headerNextCursor, encodeCursor(sortKey{Sort: auditSortField, Num: seq + 1}))
+	}
+
+	p.writeJSON(w, records)
+}
+
+func (p *Plugin) handleVerifyAudit(w http.ResponseWriter, r *http.Request) {
+	result, err := p.store.VerifyAuditLog()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, result)
+}
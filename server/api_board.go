@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// auditKindBoard is the target kind of audit records about kanban boards.
+const auditKindBoard = "board"
+
+type boardRequest struct {
+	Name       string         `json:"name"`
+	CategoryID string         `json:"category_id"`
+	Columns    []*BoardColumn `json:"columns"`
+}
+
+type moveCardRequest struct {
+	PetitionID string `json:"petition_id"`
+	ColumnID   string `json:"column_id"`
+	Index      int    `json:"index"`
+}
+
+// BoardColumnView is a board column with the petitions shown in it, in display order.
+type BoardColumnView struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Status string      `json:"status,omitempty"`
+	Cards  []*Petition `json:"cards"`
+}
+
+// BoardView is a board as displayed to one user.
+type BoardView struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	CategoryID string             `json:"category_id,omitempty"`
+	CreatorID  string             `json:"creator_id"`
+	Columns    []*BoardColumnView `json:"columns"`
+	CreateAt   int64              `json:"create_at"`
+	UpdateAt   int64              `json:"update_at"`
+}
+
+// boardView lays out the board and keeps the cards userID may see. Boards are only sent to
+// clients as views, since their columns' order lists the IDs of every petition placed.
+func (p *Plugin) boardView(userID string, board *Board) (*BoardView, error) {
+	views, err := p.boardViews(userID, []*Board{board})
+	if err != nil {
+		return nil, err
+	}
+	return views[0], nil
+}
+
+// boardViews is boardView for several boards, loading the petitions once.
+func (p *Plugin) boardViews(userID string, boards []*Board) ([]*BoardView, error) {
+	a, err := p.newAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	petitions, err := p.store.GetPetitions()
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]*BoardView, len(boards))
+	for i, board := range boards {
+		views[i] = layoutBoard(a, petitions, board)
+	}
+	return views, nil
+}
+
+func layoutBoard(a *access, petitions []*Petition, board *Board) *BoardView {
+	view := &BoardView{
+		ID:         board.ID,
+		Name:       board.Name,
+		CategoryID: board.CategoryID,
+		CreatorID:  board.CreatorID,
+		Columns:    make([]*BoardColumnView, len(board.Columns)),
+		CreateAt:   board.CreateAt,
+		UpdateAt:   board.UpdateAt,
+	}
+	for i, cards := range board.Layout(petitions) {
+		column := board.Columns[i]
+		visible := make([]*Petition, 0, len(cards))
+		for _, petition := range cards {
+			if a.CanView(petition) {
+				visible = append(visible, petition)
+			}
+		}
+		view.Columns[i] = &BoardColumnView{ID: column.ID, Name: column.Name, Status: column.Status, Cards: visible}
+	}
+	return view
+}
+
+// errTransitionSuperseded is returned to leave a petition alone whose status was changed again
+// after the transition being undone.
+var errTransitionSuperseded = errors.New("petition status changed since the transition")
+
+// undoTransition moves a petition transitioned to status by a card move back to previousStatus,
+// dropping the history entry of the transition. Petitions changed meanwhile are left as they are.
+func (p *Plugin) undoTransition(id, previousStatus, status string) {
+	_, err := p.store.UpdatePetition(id, func(petition *Petition) error {
+		if petition.Status != status {
+			return errTransitionSuperseded
+		}
+		petition.Status = previousStatus
+		if n := len(petition.StatusHistory); n > 0 && petition.StatusHistory[n-1].Status == status {
+			petition.StatusHistory = petition.StatusHistory[:n-1]
+		}
+		return nil
+	})
+	if err != nil && err != errTransitionSuperseded {
+		p.API.LogError("Failed to undo petition transition", "petition_id", id, "error", err.Error())
+	}
+}
+
+// checkBoardOwner reports ErrForbidden unless userID created the board or is a plugin admin.
+func (p *Plugin) checkBoardOwner(userID string, board *Board) error {
+	if board.CreatorID == userID {
+		return nil
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		return err
+	}
+	if !a.IsPluginAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (p *Plugin) handleListBoards(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	boards, err := p.store.GetBoards()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	views, err := p.boardViews(userID, boards)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, views)
+}
+
+func (p *Plugin) handleCreateBoard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req boardRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.CategoryID != "" {
+		if err := p.validateCategory(req.CategoryID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	board, err := NewBoard(req.Name, req.CategoryID, userID, req.Columns)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.store.SaveBoard(board); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindBoard, board.ID, nil, board)
+
+	view, err := p.boardView(userID, board)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, view)
+}
+
+func (p *Plugin) handleGetBoard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	board, err := p.store.GetBoard(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	view, err := p.boardView(userID, board)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, view)
+}
+
+// handleUpdateBoard renames a board and replaces its category and columns. Columns sent with
+// their existing ID keep their cards' order.
+func (p *Plugin) handleUpdateBoard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req boardRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.CategoryID != "" {
+		if err := p.validateCategory(req.CategoryID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	var before json.RawMessage
+	board, err := p.store.UpdateBoard(mux.Vars(r)["id"], func(board *Board) error {
+		if err := p.checkBoardOwner(userID, board); err != nil {
+			return err
+		}
+		before = auditSnapshot(board)
+		if req.Name != "" {
+			board.Name = req.Name
+		}
+		board.CategoryID = req.CategoryID
+		board.UpdateAt = model.GetMillis()
+		return board.SetColumns(req.Columns)
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindBoard, board.ID, before, board)
+
+	view, err := p.boardView(userID, board)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, view)
+}
+
+func (p *Plugin) handleDeleteBoard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	board, err := p.store.GetBoard(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.checkBoardOwner(userID, board); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if err := p.store.DeleteBoard(board.ID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindBoard, board.ID, board, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMoveCard moves a petition to a position in a board column. Moving it into the column of
+// another workflow state transitions the petition, with the same permissions and checks as
+// updating its status; the card is only placed once the transition succeeded, and the
+// transition is undone if the board cannot be updated.
+func (p *Plugin) handleMoveCard(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req moveCardRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	board, err := p.store.GetBoard(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	column := board.Column(req.ColumnID)
+	if column == nil {
+		p.handleError(w, newBadRequestError("unknown column"))
+		return
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	// check is run on the current petition and again inside the transition, which may see a
+	// newer version.
+	check := func(petition *Petition) error {
+		if err := a.require(petition, a.CanHandle); err != nil {
+			return err
+		}
+		if board.CategoryID != "" && petition.CategoryID != board.CategoryID {
+			return newBadRequestError("petition is not on this board")
+		}
+		return nil
+	}
+	petition, err := p.store.GetPetition(req.PetitionID)
+	if err == nil {
+		err = check(petition)
+	}
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	previousStatus := petition.Status
+	before := auditSnapshot(petition)
+	if column.Status != "" && column.Status != petition.Status {
+		patch := &PetitionPatch{Status: &column.Status}
+		petition, err = p.store.UpdatePetition(petition.ID, func(petition *Petition) error {
+			if err := check(petition); err != nil {
+				return err
+			}
+			previousStatus = petition.Status
+			before = auditSnapshot(petition)
+			if err := a.CheckPatch(petition, patch); err != nil {
+				return err
+			}
+			return petition.Apply(patch)
+		})
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	boardBefore := auditSnapshot(board)
+	petitions, err := p.store.GetPetitions()
+	if err == nil {
+		board, err = p.store.UpdateBoard(board.ID, func(board *Board) error {
+			return board.Place(petitions, petition.ID, req.ColumnID, req.Index)
+		})
+	}
+	if err != nil {
+		if petition.Status != previousStatus {
+			p.undoTransition(petition.ID, previousStatus, column.Status)
+		}
+		p.handleError(w, err)
+		return
+	}
+	if petition.Status != previousStatus {
+		p.auditChange(r, KindPetition, petition.ID, before, petition)
+		p.emitStatusWebhookEvents(previousStatus, petition)
+		p.emailPetitionChange(userID, previousStatus, petition.Priority, petition)
+	}
+	p.auditChange(r, auditKindBoard, board.ID, boardBefore, board)
+
+	view, err := p.boardView(userID, board)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, view)
+}
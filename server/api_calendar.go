@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// auditKindCalendarToken is the target kind of audit records about calendar feed tokens.
+const auditKindCalendarToken = "calendar_token"
+
+// pluginRoutePath returns the path under which the server serves the plugin's routes.
+func pluginRoutePath() string {
+	return "/plugins/" + manifest.Id
+}
+
+// calendarFeedPath returns the path of the calendar feed served for token.
+func calendarFeedPath(token string) string {
+	return "/calendar/" + token + ".ics"
+}
+
+// calendarFeedURL returns the absolute URL of the calendar feed served for token, or its path
+// relative to the site if no site URL is configured.
+func (p *Plugin) calendarFeedURL(token string) string {
+	siteURL := ""
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = strings.TrimSuffix(*config.ServiceSettings.SiteURL, "/")
+	}
+	return siteURL + pluginRoutePath() + calendarFeedPath(token)
+}
+
+// requireCalendarToken authenticates calendar feed requests by the secret token in their path,
+// which calendar apps send instead of a user session, and attributes them to its owner.
+func (p *Plugin) requireCalendarToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := p.store.ResolveCalendarToken(mux.Vars(r)["token"])
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		r.Header.Set("Mattermost-User-ID", userID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCalendarFeed serves the iCalendar feed of the token's owner: the due dates of their open
+// issues and the deadlines of the open petitions assigned to them. Feeds of deactivated users
+// are not served.
+func (p *Plugin) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil || user.DeleteAt != 0 {
+		p.handleError(w, ErrNotFound)
+		return
+	}
+	issues, err := p.store.GetIssuesForUser(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petitions, err := p.store.GetPetitions()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	categories, err := p.store.GetCategories()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	calendar := renderCalendar("Todos and petitions of "+user.Username, calendarEntries(userID, issues, petitions, categories), time.Now())
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if _, err := w.Write([]byte(calendar)); err != nil {
+		p.API.LogWarn("Failed to write calendar feed", "error", err.Error())
+	}
+}
+
+// handleGetCalendarToken describes the current user's calendar feed token, without the token
+// itself, which is only shown when generated.
+func (p *Plugin) handleGetCalendarToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	token, err := p.store.GetCalendarToken(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, token)
+}
+
+// handleCreateCalendarToken generates a calendar feed token for the current user, revoking the
+// previous one, and returns it with the feed URL.
+func (p *Plugin) handleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var before interface{}
+	previous, err := p.store.GetCalendarToken(userID)
+	if err == nil {
+		before = previous
+	} else if err != ErrNotFound {
+		p.handleError(w, err)
+		return
+	}
+	token, err := p.store.CreateCalendarToken(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindCalendarToken, userID, before, &CalendarToken{UserID: userID, CreateAt: token.CreateAt})
+
+	token.URL = p.calendarFeedURL(token.Token)
+	p.writeJSON(w, token)
+}
+
+// handleRevokeCalendarToken revokes the current user's calendar feed token, so that the feed URL
+// stops working.
+func (p *Plugin) handleRevokeCalendarToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	token, err := p.store.GetCalendarToken(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.store.RevokeCalendarToken(userID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindCalendarToken, userID, token, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
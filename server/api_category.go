@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+type createCategoryRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	AssigneeID  string `json:"assignee_id"`
+	SLAHours    int    `json:"sla_hours"`
+}
+
+// isSystemAdmin reports whether userID may manage the Mattermost system.
+func (p *Plugin) isSystemAdmin(userID string) bool {
+	return p.API.HasPermissionTo(userID, model.PermissionManageSystem)
+}
+
+func (p *Plugin) handleListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := p.store.GetCategories()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, categories)
+}
+
+func (p *Plugin) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if !a.CanManageCategories() {
+		p.handleError(w, ErrForbidden)
+		return
+	}
+
+	var req createCategoryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	category, err := NewCategory(req.Name, req.Description, req.AssigneeID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.SLAHours < 0 {
+		p.handleError(w, newBadRequestError("SLA hours must not be negative"))
+		return
+	}
+	category.SLAHours = req.SLAHours
+	if err := p.store.SaveCategory(category); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindCategory, category.ID, nil, category)
+
+	p.writeJSON(w, category)
+}
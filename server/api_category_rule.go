@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// auditKindCategoryRule is the target kind of audit records about categorization rules.
+const auditKindCategoryRule = "category_rule"
+
+type ruleTextRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// CategoryRuleTest shows every rule firing for a sample text, and the one that would suggest
+// the category of a petition filed with it.
+type CategoryRuleTest struct {
+	Matches    []*RuleMatch `json:"matches"`
+	Suggestion *RuleMatch   `json:"suggestion"`
+}
+
+// CategorySuggestionResponse is the category suggested to a submitter before filing a petition.
+// CategoryID is empty when no rule fires.
+type CategorySuggestionResponse struct {
+	CategoryID string `json:"category_id,omitempty"`
+	AutoApply  bool   `json:"auto_apply,omitempty"`
+}
+
+// suggestCategory returns the best rule firing for a petition's title and content, or nil if
+// none does.
+func (p *Plugin) suggestCategory(title, content string) (*RuleMatch, error) {
+	rules, err := p.store.GetCategoryRules()
+	if err != nil {
+		return nil, err
+	}
+	matches := matchCategoryRules(rules, title, content)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return matches[0], nil
+}
+
+// categorizePetition applies the rule suggestion for a new petition: rules set to auto-apply
+// replace the category the submitter chose, and other rules only record whether the submitter
+// followed them. Failing to evaluate the rules leaves the petition as submitted.
+func (p *Plugin) categorizePetition(petition *Petition) {
+	match, err := p.suggestCategory(petition.Title, petition.Content)
+	if err != nil {
+		p.API.LogError("Failed to evaluate category rules", "error", err.Error())
+		return
+	}
+	if match == nil {
+		return
+	}
+	suggestion := &CategorySuggestion{RuleID: match.RuleID, CategoryID: match.CategoryID}
+	if petition.CategoryID != match.CategoryID {
+		if match.AutoApply {
+			petition.CategoryID = match.CategoryID
+			suggestion.Applied = true
+		} else if petition.CategoryID != "" {
+			suggestion.Overridden = true
+		}
+	}
+	petition.CategorySuggestion = suggestion
+}
+
+// handleSuggestCategory suggests a category for a petition about to be filed.
+func (p *Plugin) handleSuggestCategory(w http.ResponseWriter, r *http.Request) {
+	var req ruleTextRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	match, err := p.suggestCategory(req.Title, req.Content)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	response := &CategorySuggestionResponse{}
+	if match != nil {
+		response.CategoryID = match.CategoryID
+		response.AutoApply = match.AutoApply
+	}
+	p.writeJSON(w, response)
+}
+
+func (p *Plugin) handleListCategoryRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := p.store.GetCategoryRules()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if rules == nil {
+		rules = []*CategoryRule{}
+	}
+
+	p.writeJSON(w, rules)
+}
+
+func (p *Plugin) handleCreateCategoryRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req CategoryRule
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	rule, err := NewCategoryRule(req, userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.validateCategory(rule.CategoryID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if err := p.store.AddCategoryRule(rule); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindCategoryRule, rule.ID, nil, rule)
+
+	p.writeJSON(w, rule)
+}
+
+func (p *Plugin) handleDeleteCategoryRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := p.store.DeleteCategoryRule(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindCategoryRule, rule.ID, rule, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTestCategoryRules shows which rules fire for a sample text.
+func (p *Plugin) handleTestCategoryRules(w http.ResponseWriter, r *http.Request) {
+	var req ruleTextRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	rules, err := p.store.GetCategoryRules()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	test := &CategoryRuleTest{Matches: matchCategoryRules(rules, req.Title, req.Content)}
+	if len(test.Matches) > 0 {
+		test.Suggestion = test.Matches[0]
+	}
+
+	p.writeJSON(w, test)
+}
+
+// handleCategoryRuleStats reports how often the suggestions of each rule were overridden.
+func (p *Plugin) handleCategoryRuleStats(w http.ResponseWriter, r *http.Request) {
+	rules, err := p.store.GetCategoryRules()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petitions, err := p.store.GetPetitions()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, categoryRuleStats(rules, petitions))
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// channelRefreshEvent tells the members of a channel to reload its shared todo list.
+const channelRefreshEvent = "channel_refresh"
+
+// Values of the state query parameter of the channel list route.
+const (
+	channelIssuesOpen      = "open"
+	channelIssuesCompleted = "completed"
+	channelIssuesAll       = "all"
+)
+
+// ErrIssueClaimed is returned when claiming an issue another channel member already claimed.
+var ErrIssueClaimed = errors.New("issue is claimed by another user")
+
+type addChannelIssueRequest struct {
+	Message     string `json:"message"`
+	Description string `json:"description"`
+	PostID      string `json:"post_id"`
+}
+
+// initChannelIssueRoutes registers the routes of channels' shared todo lists on router, whose
+// path carries the channel ID in the "channel_id" variable.
+func (p *Plugin) initChannelIssueRoutes(router *mux.Router) {
+	router.Use(p.requireChannelMember)
+	router.HandleFunc("", p.handleListChannelIssues).Methods(http.MethodGet)
+	router.HandleFunc("", p.handleAddChannelIssue).Methods(http.MethodPost).Name("channel_issue.create")
+	router.HandleFunc("/{id}", p.handleDeleteChannelIssue).Methods(http.MethodDelete).Name("channel_issue.delete")
+	router.HandleFunc("/{id}/claim", p.handleClaimChannelIssue).Methods(http.MethodPost).Name("channel_issue.claim")
+	router.HandleFunc("/{id}/claim", p.handleClaimChannelIssue).Methods(http.MethodDelete).Name("channel_issue.unclaim")
+	router.HandleFunc("/{id}/complete", p.handleCompleteChannelIssue).Methods(http.MethodPost).Name("channel_issue.complete")
+	p.initChecklistRoutes(router.PathPrefix("/{id}/subtasks").Subrouter(), "channel_issue", p.updateChannelIssueChecklist)
+}
+
+// isChannelMember reports whether userID currently belongs to channelID.
+func (p *Plugin) isChannelMember(channelID, userID string) (bool, error) {
+	if _, appErr := p.API.GetChannelMember(channelID, userID); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, errors.Wrap(appErr, "failed to get channel member")
+	}
+	return true, nil
+}
+
+// canSeeIssue reports whether userID may see the issue: personal issues are visible to the
+// users involved in them, shared ones to the members of their channel.
+func (p *Plugin) canSeeIssue(userID string, issue *Issue) bool {
+	if issue.ChannelID == "" {
+		return issue.involves(userID)
+	}
+	member, err := p.isChannelMember(issue.ChannelID, userID)
+	if err != nil {
+		p.API.LogWarn("Failed to check channel membership", "channel_id", issue.ChannelID, "user_id", userID, "error", err.Error())
+	}
+	return member
+}
+
+// requireChannelMember rejects requests from users who are not members of the channel named by
+// the "channel_id" route variable. Membership is checked on every request, so users leaving a
+// channel lose access to its list at once.
+func (p *Plugin) requireChannelMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		member, err := p.isChannelMember(mux.Vars(r)["channel_id"], r.Header.Get("Mattermost-User-ID"))
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if !member {
+			p.handleError(w, ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publishChannelRefresh asks the clients of every member of channelID to reload its list.
+func (p *Plugin) publishChannelRefresh(channelID string) {
+	p.publishWebSocketEvent(channelRefreshEvent, map[string]interface{}{"channel_id": channelID}, &model.WebsocketBroadcast{ChannelId: channelID})
+}
+
+// updateChannelIssue atomically applies fn to an issue of the channel named in the request and
+// records the change for the audit log.
+func (p *Plugin) updateChannelIssue(r *http.Request, id string, fn func(*Issue) error) (*Issue, error) {
+	channelID := mux.Vars(r)["channel_id"]
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(id, func(issue *Issue) error {
+		if issue.ChannelID != channelID {
+			return ErrNotFound
+		}
+		before = auditSnapshot(issue)
+		return fn(issue)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+	p.publishChannelRefresh(channelID)
+	return issue, nil
+}
+
+// handleListChannelIssues returns the issues of a channel's shared list. The state parameter
+// selects open, completed or all issues; the /list filters and pagination apply.
+func (p *Plugin) handleListChannelIssues(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	state := query.Get("state")
+	if state == "" {
+		state = channelIssuesOpen
+	}
+	if state != channelIssuesOpen && state != channelIssuesCompleted && state != channelIssuesAll {
+		p.handleError(w, newBadRequestError("state must be open, completed or all"))
+		return
+	}
+	filter, err := ParseIssueFilter(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	pageReq, err := parsePageRequest(query, issueSortFields...)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	issues, err := p.store.GetChannelIssues(mux.Vars(r)["channel_id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	matching := make([]*Issue, 0, len(issues))
+	for _, issue := range issues {
+		completed := issue.CompletedAt != 0
+		if (state == channelIssuesAll || completed == (state == channelIssuesCompleted)) && filter.Matches(issue) {
+			matching = append(matching, issue)
+		}
+	}
+
+	page, next := paginate(matching, issueSortKey(pageReq.Sort), pageReq)
+	writePageHeaders(w, len(matching), next)
+	p.writeJSON(w, page)
+}
+
+func (p *Plugin) handleAddChannelIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	channelID := mux.Vars(r)["channel_id"]
+
+	var req addChannelIssueRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	issue, err := NewChannelIssue(req.Message, req.Description, req.PostID, userID, channelID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.store.SaveIssue(issue); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, nil, issue)
+	p.publishChannelRefresh(channelID)
+
+	p.writeJSON(w, issue)
+}
+
+// handleClaimChannelIssue assigns an open issue to the requesting member, or releases their claim
+// when the method is DELETE.
+func (p *Plugin) handleClaimChannelIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	claim := r.Method != http.MethodDelete
+
+	issue, err := p.updateChannelIssue(r, mux.Vars(r)["id"], func(issue *Issue) error {
+		if issue.CompletedAt != 0 {
+			return newBadRequestError("issue is completed")
+		}
+		if issue.AssigneeID != "" && issue.AssigneeID != userID {
+			return ErrIssueClaimed
+		}
+		if claim {
+			issue.AssigneeID = userID
+		} else {
+			issue.AssigneeID = ""
+		}
+		issue.Accepted = claim
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, issue)
+}
+
+// handleCompleteChannelIssue completes an issue on behalf of any channel member. Unclaimed issues
+// are claimed by the member completing them.
+func (p *Plugin) handleCompleteChannelIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	issue, err := p.updateChannelIssue(r, mux.Vars(r)["id"], func(issue *Issue) error {
+		if issue.CompletedAt != 0 {
+			return newBadRequestError("issue is already completed")
+		}
+		if issue.Subtasks.OpenRequired() > 0 {
+			return ErrSubtasksOpen
+		}
+		if issue.AssigneeID == "" {
+			issue.AssigneeID = userID
+			issue.Accepted = true
+		}
+		issue.CompletedAt = model.GetMillis()
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, issue)
+}
+
+// handleDeleteChannelIssue removes an issue from a channel's list. Only its creator may.
+func (p *Plugin) handleDeleteChannelIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	channelID := mux.Vars(r)["channel_id"]
+
+	issue, err := p.store.GetIssue(mux.Vars(r)["id"])
+	if err == nil && issue.ChannelID != channelID {
+		err = ErrNotFound
+	}
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if issue.CreatorID != userID {
+		p.handleError(w, ErrForbidden)
+		return
+	}
+
+	if err := p.store.DeleteIssue(issue); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, issue, nil)
+	p.publishChannelRefresh(channelID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateChannelIssueChecklist is the checklistUpdater for issues on channels' shared lists.
+func (p *Plugin) updateChannelIssueChecklist(r *http.Request, id string, fn func(*Checklist) error) (Checklist, error) {
+	issue, err := p.updateChannelIssue(r, id, func(issue *Issue) error {
+		return fn(&issue.Subtasks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issue.Subtasks, nil
+}
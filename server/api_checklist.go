@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// checklistUpdater atomically applies fn to the checklist of the record identified by id on
+// behalf of the user making request r and returns the updated checklist.
+type checklistUpdater func(r *http.Request, id string, fn func(*Checklist) error) (Checklist, error)
+
+type addSubtaskRequest struct {
+	Title      string `json:"title"`
+	AssigneeID string `json:"assignee_id"`
+	Required   bool   `json:"required"`
+}
+
+type reorderSubtasksRequest struct {
+	Order []string `json:"order"`
+}
+
+// initChecklistRoutes registers the subtask routes on router, whose path carries the ID of the
+// owning record in the "id" variable. Route names are prefixed with the record kind.
+func (p *Plugin) initChecklistRoutes(router *mux.Router, kind string, update checklistUpdater) {
+	router.HandleFunc("", p.handleAddSubtask(update)).Methods(http.MethodPost).Name(kind + ".subtask.create")
+	router.HandleFunc("/reorder", p.handleReorderSubtasks(update)).Methods(http.MethodPost).Name(kind + ".subtask.reorder")
+	router.HandleFunc("/{subtask_id}/toggle", p.handleToggleSubtask(update)).Methods(http.MethodPost).Name(kind + ".subtask.toggle")
+	router.HandleFunc("/{subtask_id}", p.handleDeleteSubtask(update)).Methods(http.MethodDelete).Name(kind + ".subtask.delete")
+}
+
+func (p *Plugin) handleAddSubtask(update checklistUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req addSubtaskRequest
+		if err := decodeJSON(r, &req); err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if req.AssigneeID != "" {
+			if err := p.validateUser(req.AssigneeID); err != nil {
+				p.handleError(w, err)
+				return
+			}
+		}
+
+		var subtask *Subtask
+		_, err := update(r, mux.Vars(r)["id"], func(c *Checklist) error {
+			var err error
+			subtask, err = c.Add(req.Title, req.AssigneeID, req.Required)
+			return err
+		})
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+
+		p.writeJSON(w, subtask)
+	}
+}
+
+func (p *Plugin) handleReorderSubtasks(update checklistUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req reorderSubtasksRequest
+		if err := decodeJSON(r, &req); err != nil {
+			p.handleError(w, err)
+			return
+		}
+
+		checklist, err := update(r, mux.Vars(r)["id"], func(c *Checklist) error {
+			return c.Reorder(req.Order)
+		})
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+
+		p.writeJSON(w, checklist)
+	}
+}
+
+func (p *Plugin) handleToggleSubtask(update checklistUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("Mattermost-User-ID")
+		vars := mux.Vars(r)
+
+		var subtask *Subtask
+		_, err := update(r, vars["id"], func(c *Checklist) error {
+			var err error
+			subtask, err = c.Toggle(vars["subtask_id"], userID)
+			return err
+		})
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+
+		p.writeJSON(w, subtask)
+	}
+}
+
+func (p *Plugin) handleDeleteSubtask(update checklistUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		_, err := update(r, vars["id"], func(c *Checklist) error {
+			return c.Remove(vars["subtask_id"])
+		})
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Types of timeline entries.
+const (
+	TimelineProcess = "process"
+	TimelineComment = "comment"
+)
+
+// TimelineEntry is one item of a petition's timeline: either a forwarding step or a comment.
+type TimelineEntry struct {
+	Type     string   `json:"type"`
+	CreateAt int64    `json:"create_at"`
+	Process  *Process `json:"process,omitempty"`
+	Comment  *Comment `json:"comment,omitempty"`
+}
+
+type commentRequest struct {
+	Message string `json:"message"`
+}
+
+// resolveMentions returns the IDs of the existing users mentioned in message. Unknown usernames
+// are ignored.
+func (p *Plugin) resolveMentions(message string) []string {
+	var userIDs []string
+	for _, username := range parseMentions(message) {
+		user, appErr := p.API.GetUserByUsername(username)
+		if appErr != nil {
+			continue
+		}
+		userIDs = append(userIDs, user.Id)
+	}
+	return userIDs
+}
+
+// addComment stores a comment by userID on petition, subscribes the author to the petition if
+// they may see it and notifies mentioned users and watchers, except those listed in notified.
+func (p *Plugin) addComment(petition *Petition, userID, message string, notified ...string) (*Comment, error) {
+	comment, err := NewComment(petition.ID, userID, message)
+	if err != nil {
+		return nil, err
+	}
+	comment.Mentions = p.resolveMentions(message)
+
+	if err := p.store.SaveComment(comment); err != nil {
+		return nil, err
+	}
+	if len(p.filterViewers(petition, []string{userID})) > 0 {
+		if _, err := p.store.UpdatePetition(petition.ID, func(petition *Petition) error {
+			petition.Watch(userID)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	author := p.displayName(userID)
+	skip := append([]string{userID}, notified...)
+
+	mentioned := p.filterViewers(petition, excludeUsers(comment.Mentions, skip))
+	p.notifyUsers(mentioned, userID, fmt.Sprintf("%s mentioned you on the petition **%s**:\n\n%s", author, petition.Title, quote(comment.Message)))
+
+	watchers := excludeUsers(petition.Watchers, append(skip, mentioned...))
+	p.notifyUsers(watchers, userID, fmt.Sprintf("%s commented on the petition **%s**:\n\n%s", author, petition.Title, quote(comment.Message)))
+
+	return comment, nil
+}
+
+// filterViewers returns the members of userIDs that may see petition, so that mentions do not
+// disclose petitions to users without access to them.
+func (p *Plugin) filterViewers(petition *Petition, userIDs []string) []string {
+	var viewers []string
+	for _, userID := range userIDs {
+		a, err := p.newAccess(userID)
+		if err != nil {
+			p.API.LogError("Failed to check access of mentioned user", "user_id", userID, "error", err.Error())
+			continue
+		}
+		if a.CanView(petition) {
+			viewers = append(viewers, userID)
+		}
+	}
+	return viewers
+}
+
+// excludeUsers returns the members of userIDs that are not listed in excluded.
+func excludeUsers(userIDs, excluded []string) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, userID := range excluded {
+		skip[userID] = true
+	}
+
+	var result []string
+	for _, userID := range userIDs {
+		if !skip[userID] {
+			result = append(result, userID)
+		}
+	}
+	return result
+}
+
+func (p *Plugin) handleListComments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	comments, err := p.store.GetComments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if comments == nil {
+		comments = []*Comment{}
+	}
+
+	p.writeJSON(w, comments)
+}
+
+func (p *Plugin) handleAddComment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req commentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	comment, err := p.addComment(petition, userID, req.Message)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindComment, comment.ID, nil, comment)
+
+	p.writeJSON(w, comment)
+}
+
+func (p *Plugin) handleEditComment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+
+	var req commentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if _, err := NewComment(vars["id"], userID, req.Message); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	petition, err := p.getVisiblePetition(userID, vars["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	mentions := p.resolveMentions(req.Message)
+	var previous []string
+	var before json.RawMessage
+	comment, err := p.store.UpdateComment(vars["id"], vars["comment_id"], func(comment *Comment) error {
+		if comment.UserID != userID {
+			return ErrForbidden
+		}
+		before = auditSnapshot(comment)
+		previous = comment.Mentions
+		comment.Message = req.Message
+		comment.Mentions = mentions
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindComment, comment.ID, before, comment)
+
+	p.notifyUsers(p.filterViewers(petition, excludeUsers(mentions, previous)), userID, fmt.Sprintf("%s mentioned you on the petition **%s**:\n\n%s", p.displayName(userID), petition.Title, quote(comment.Message)))
+
+	p.writeJSON(w, comment)
+}
+
+func (p *Plugin) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	vars := mux.Vars(r)
+
+	if _, err := p.getVisiblePetition(userID, vars["id"]); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var deleted *Comment
+	err = p.store.DeleteComment(vars["id"], vars["comment_id"], func(comment *Comment) error {
+		if comment.UserID != userID && !a.IsPluginAdmin() {
+			return ErrForbidden
+		}
+		deleted = comment
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindComment, deleted.ID, deleted, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Plugin) handleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	comments, err := p.store.GetComments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	timeline := make([]*TimelineEntry, 0, len(petition.Processes)+len(comments))
+	for _, process := range petition.Processes {
+		timeline = append(timeline, &TimelineEntry{Type: TimelineProcess, CreateAt: process.CreateAt, Process: process})
+	}
+	for _, comment := range comments {
+		timeline = append(timeline, &TimelineEntry{Type: TimelineComment, CreateAt: comment.CreateAt, Comment: comment})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].CreateAt < timeline[j].CreateAt
+	})
+
+	p.writeJSON(w, timeline)
+}
+
+func (p *Plugin) handleWatchPetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	watch := r.Method != http.MethodDelete
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	var before json.RawMessage
+	petition, err := p.store.UpdatePetition(mux.Vars(r)["id"], func(petition *Petition) error {
+		if err := a.require(petition, nil); err != nil {
+			return err
+		}
+		before = auditSnapshot(petition)
+		if watch {
+			petition.Watch(userID)
+		} else {
+			petition.Unwatch(userID)
+		}
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+
+	p.writeJSON(w, petition)
+}
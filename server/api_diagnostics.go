@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Overall states reported by the health route.
+const (
+	healthStatusOK       = "ok"
+	healthStatusDegraded = "degraded"
+)
+
+// HealthCheck is the outcome of one health check. Latency is in milliseconds.
+type HealthCheck struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Latency int64  `json:"latency"`
+}
+
+// Health reports the build of the running plugin and whether its dependencies work.
+type Health struct {
+	Status  string                  `json:"status"`
+	Version string                  `json:"version"`
+	GitHash string                  `json:"git_hash"`
+	Checks  map[string]*HealthCheck `json:"checks"`
+}
+
+// JobStatus lists the background job runs in progress and the last finished run of each job.
+type JobStatus struct {
+	Running  []*JobRun          `json:"running"`
+	LastRuns map[string]*JobRun `json:"last_runs"`
+}
+
+// Diagnostics extends the health report with the state of background jobs and the number of
+// stored records, for support staff.
+type Diagnostics struct {
+	*Health
+	Jobs         *JobStatus     `json:"jobs"`
+	Records      map[string]int `json:"records,omitempty"`
+	RecordsError string         `json:"records_error,omitempty"`
+}
+
+// runCheck times check and describes its outcome.
+func runCheck(check func() error) *HealthCheck {
+	start := time.Now()
+	err := check()
+	result := &HealthCheck{OK: err == nil, Latency: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// health runs the health checks: the configuration must be valid and the key-value store
+// reachable.
+func (p *Plugin) health() *Health {
+	health := &Health{
+		Status:  healthStatusOK,
+		Version: buildVersion,
+		GitHash: buildHash,
+		Checks: map[string]*HealthCheck{
+			"configuration": runCheck(p.getConfiguration().IsValid),
+			"kv_store":      runCheck(p.store.Ping),
+		},
+	}
+	for _, check := range health.Checks {
+		if !check.OK {
+			health.Status = healthStatusDegraded
+		}
+	}
+	return health
+}
+
+// handleHealth reports the plugin's health, answering 503 when a check fails.
+func (p *Plugin) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := p.health()
+	if health.Status != healthStatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	p.writeJSON(w, health)
+}
+
+// handleDiagnostics reports the plugin's health along with its background jobs and record counts.
+// Failing checks are part of the report rather than errors.
+func (p *Plugin) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	diagnostics := &Diagnostics{
+		Health: p.health(),
+		Jobs:   &JobStatus{Running: p.jobs.Running(), LastRuns: p.jobs.LastRuns()},
+	}
+	records, err := p.store.CountRecords()
+	if err != nil {
+		diagnostics.RecordsError = err.Error()
+	} else {
+		diagnostics.Records = records
+	}
+
+	p.writeJSON(w, diagnostics)
+}
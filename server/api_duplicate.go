@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// createPetitionResponse is the created petition along with the open petitions it likely
+// duplicates, which the submitter may link or merge it into.
+type createPetitionResponse struct {
+	*Petition
+	Duplicates []*DuplicateCandidate `json:"duplicates"`
+}
+
+type duplicatesRequest struct {
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	CategoryID string `json:"category_id"`
+}
+
+type relatedPetitionRequest struct {
+	TargetID string `json:"target_id"`
+}
+
+// findDuplicatesOf returns the open petitions the user may see that likely duplicate petition.
+func (p *Plugin) findDuplicatesOf(a *access, petition *Petition) ([]*DuplicateCandidate, error) {
+	petitions, err := p.store.GetPetitions()
+	if err != nil {
+		return nil, err
+	}
+	visible := []*Petition{}
+	for _, other := range petitions {
+		if a.CanView(other) {
+			visible = append(visible, other)
+		}
+	}
+	return findDuplicates(petition, visible), nil
+}
+
+// handleFindDuplicates returns the open petitions likely to duplicate a petition about to be
+// filed, so that the submitter may join one of them instead.
+func (p *Plugin) handleFindDuplicates(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req duplicatesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.CategoryID == "" {
+		p.handleError(w, newBadRequestError("category is required"))
+		return
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if !a.CanSubmit() {
+		p.handleError(w, ErrForbidden)
+		return
+	}
+
+	duplicates, err := p.findDuplicatesOf(a, &Petition{Title: req.Title, Content: req.Content, CategoryID: req.CategoryID})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, duplicates)
+}
+
+// loadRelatedPetitions returns the petition in the route, which the user must be allowed to
+// edit, and the target of the request, which the user must be allowed to see.
+func (p *Plugin) loadRelatedPetitions(a *access, id, targetID string) (*Petition, *Petition, error) {
+	if targetID == "" {
+		return nil, nil, newBadRequestError("target is required")
+	}
+	if targetID == id {
+		return nil, nil, newBadRequestError("a petition cannot relate to itself")
+	}
+	petition, err := p.store.GetPetition(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := a.require(petition, a.CanEdit); err != nil {
+		return nil, nil, err
+	}
+	target, err := p.store.GetPetition(targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !a.CanView(target) {
+		return nil, nil, ErrNotFound
+	}
+	return petition, target, nil
+}
+
+// handleLinkPetition records that the petition in the route relates to the target petition, on
+// both of them.
+func (p *Plugin) handleLinkPetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req relatedPetitionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petition, target, err := p.loadRelatedPetitions(a, mux.Vars(r)["id"], req.TargetID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var before json.RawMessage
+	petition, err = p.store.UpdatePetition(petition.ID, func(petition *Petition) error {
+		before = auditSnapshot(petition)
+		petition.Link(target.ID)
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if _, err := p.store.UpdatePetition(target.ID, func(target *Petition) error {
+		target.Link(petition.ID)
+		return nil
+	}); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+
+	p.writeJSON(w, petition)
+}
+
+// undoMerge reopens a petition merged into targetID in previousStatus, dropping the history
+// entry of the merge and, unless linked before, its link to the target. Petitions changed
+// meanwhile are left as they are.
+func (p *Plugin) undoMerge(id, targetID, previousStatus string, linked bool) {
+	_, err := p.store.UpdatePetition(id, func(petition *Petition) error {
+		if petition.MergedIntoID != targetID || petition.Status != StatusRejected {
+			return errTransitionSuperseded
+		}
+		petition.MergedIntoID = ""
+		petition.Status = previousStatus
+		if n := len(petition.StatusHistory); n > 0 && petition.StatusHistory[n-1].Status == StatusRejected {
+			petition.StatusHistory = petition.StatusHistory[:n-1]
+		}
+		if !linked {
+			linkedIDs := []string{}
+			for _, linkedID := range petition.LinkedIDs {
+				if linkedID != targetID {
+					linkedIDs = append(linkedIDs, linkedID)
+				}
+			}
+			petition.LinkedIDs = linkedIDs
+		}
+		return nil
+	})
+	if err != nil && err != errTransitionSuperseded {
+		p.API.LogError("Failed to undo petition merge", "petition_id", id, "error", err.Error())
+	}
+}
+
+// handleMergePetition merges the open petition in the route into the target petition: the
+// petition is closed as merged, its submitter starts watching the target, and its text is
+// added to the target's discussion.
+func (p *Plugin) handleMergePetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req relatedPetitionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petition, target, err := p.loadRelatedPetitions(a, mux.Vars(r)["id"], req.TargetID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var before json.RawMessage
+	var previousStatus string
+	var linked bool
+	petition, err = p.store.UpdatePetition(petition.ID, func(petition *Petition) error {
+		if !petition.IsOpen() {
+			return newBadRequestError("petition is closed")
+		}
+		before = auditSnapshot(petition)
+		previousStatus = petition.Status
+		linked = containsString(petition.LinkedIDs, target.ID)
+		petition.MergedIntoID = target.ID
+		petition.Link(target.ID)
+		petition.enterStatus(StatusRejected)
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	var targetBefore json.RawMessage
+	target, err = p.store.UpdatePetition(target.ID, func(target *Petition) error {
+		if !target.IsOpen() {
+			return newBadRequestError("target petition is closed")
+		}
+		targetBefore = auditSnapshot(target)
+		target.Link(petition.ID)
+		target.Watch(petition.CreatorID)
+		return nil
+	})
+	if err != nil {
+		p.undoMerge(petition.ID, petition.MergedIntoID, previousStatus, linked)
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+	p.auditChange(r, KindPetition, target.ID, targetBefore, target)
+	p.emitStatusWebhookEvents(previousStatus, petition)
+	p.emailPetitionChange(userID, previousStatus, petition.Priority, petition)
+
+	message := fmt.Sprintf("Merged the petition **%s** into this one.", petition.Title)
+	if petition.Content != "" {
+		message += "\n\n" + quote(petition.Content)
+	}
+	if _, err := p.addComment(target, userID, message); err != nil {
+		p.API.LogError("Failed to record merged petition", "petition_id", petition.ID, "error", err.Error())
+	}
+
+	p.writeJSON(w, petition)
+}
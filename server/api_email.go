@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+)
+
+// auditKindEmailPreferences is the target kind of audit records about email preferences.
+const auditKindEmailPreferences = "email_preferences"
+
+// emailEnabled reports whether petition events are emailed: the plugin setting must enable it,
+// and the server must be configured to send email notifications.
+func (p *Plugin) emailEnabled() bool {
+	if !p.getConfiguration().EnableEmailNotifications {
+		return false
+	}
+	config := p.API.GetConfig()
+	return config != nil && config.EmailSettings.SendEmailNotifications != nil && *config.EmailSettings.SendEmailNotifications
+}
+
+// emailUsers queues the notification of event about petition, triggered by actorID, for each of
+// userIDs who wants it, skipping the actor. The petition change already happened, so failures are
+// logged rather than reported to the client.
+func (p *Plugin) emailUsers(event string, petition *Petition, actorID string, userIDs ...string) {
+	if len(userIDs) == 0 || !p.emailEnabled() {
+		return
+	}
+
+	queued := map[string]bool{actorID: true}
+	for _, userID := range userIDs {
+		if userID == "" || queued[userID] {
+			continue
+		}
+		queued[userID] = true
+
+		prefs, err := p.store.GetEmailPreferences(userID)
+		if err != nil {
+			p.API.LogError("Failed to get email preferences", "user_id", userID, "error", err.Error())
+			continue
+		}
+		if !prefs.Enabled(event) {
+			continue
+		}
+		if err := p.store.QueueEmailNotification(userID, newEmailNotification(event, petition, actorID)); err != nil {
+			p.API.LogError("Failed to queue email notification", "user_id", userID, "error", err.Error())
+		}
+	}
+}
+
+// emailAssignment emails the assignee a petition was handed to by actorID. previousAssigneeID
+// tells a first assignment from a forward.
+func (p *Plugin) emailAssignment(actorID, previousAssigneeID string, petition *Petition) {
+	event := EmailEventForwarded
+	if previousAssigneeID == "" {
+		event = EmailEventAssigned
+	}
+	p.emailUsers(event, petition, actorID, petition.AssigneeID)
+}
+
+// emailPetitionChange emails the events of a petition's change by actorID from previousStatus
+// and previousPriority. Lowering the priority number of an open petition escalates it, and its
+// assignee and watchers hear about it; the creator and watchers hear about resolutions.
+func (p *Plugin) emailPetitionChange(actorID, previousStatus string, previousPriority int, petition *Petition) {
+	if petition.IsOpen() && petition.Priority < previousPriority {
+		p.emailUsers(EmailEventEscalated, petition, actorID, append([]string{petition.AssigneeID}, petition.Watchers...)...)
+	}
+	if previousStatus != StatusResolved && petition.Status == StatusResolved {
+		p.emailUsers(EmailEventResolved, petition, actorID, append([]string{petition.CreatorID}, petition.Watchers...)...)
+	}
+}
+
+// handleGetEmailPreferences returns the current user's email preferences for every event.
+func (p *Plugin) handleGetEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	prefs, err := p.store.GetEmailPreferences(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, prefs)
+}
+
+// handleUpdateEmailPreferences changes the current user's email preferences for the events
+// listed in the body, leaving the others untouched.
+func (p *Plugin) handleUpdateEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var changes EmailPreferences
+	if err := decodeJSON(r, &changes); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	before, err := p.store.GetEmailPreferences(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	prefs, err := p.store.UpdateEmailPreferences(userID, changes)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindEmailPreferences, userID, before, prefs)
+
+	p.writeJSON(w, prefs)
+}
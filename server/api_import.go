@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// maxImportSize bounds the size of an uploaded import file.
+const maxImportSize = 20 * 1024 * 1024
+
+// ErrImportTooLarge is returned when an uploaded import file exceeds maxImportSize.
+var ErrImportTooLarge = errors.New("import file is too large")
+
+// handleCreateImport validates an uploaded CSV file without creating anything and returns the
+// resulting report. The multipart form carries the file, the record type, an optional JSON
+// mapping from field names to column headers, the team of imported petitions and the time zone
+// of dates without one.
+func (p *Plugin) handleCreateImport(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+multipartOverhead)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			p.handleError(w, ErrImportTooLarge)
+			return
+		}
+		p.handleError(w, newBadRequestError("a file is required"))
+		return
+	}
+	defer file.Close()
+
+	importType := r.FormValue("type")
+	if _, ok := importFields[importType]; !ok {
+		p.handleError(w, newBadRequestError("type must be petitions or todos"))
+		return
+	}
+	mapping := map[string]string{}
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			p.handleError(w, newBadRequestError("invalid mapping"))
+			return
+		}
+	}
+	location := time.UTC
+	if tz := r.FormValue("tz"); tz != "" {
+		if location, err = time.LoadLocation(tz); err != nil {
+			p.handleError(w, newBadRequestError("unknown time zone"))
+			return
+		}
+	}
+
+	im, err := p.newImporter(importType, userID, r.FormValue("team_id"), location)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	job, batches, err := im.validate(file, mapping)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.store.SaveImportJob(job, batches); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindImport, job.ID, nil, job)
+
+	p.writeJSON(w, job)
+}
+
+func (p *Plugin) handleGetImport(w http.ResponseWriter, r *http.Request) {
+	job, err := p.store.GetImportJob(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, job)
+}
+
+// handleCommitImport starts creating the records of a validated import in the background.
+// Committing a failed or abandoned import resumes it after the last completed batch. Imports
+// with invalid rows are only committed when skip_invalid is set.
+func (p *Plugin) handleCommitImport(w http.ResponseWriter, r *http.Request) {
+	skipInvalid := r.URL.Query().Get("skip_invalid") == "true"
+
+	var before json.RawMessage
+	job, err := p.store.UpdateImportJob(mux.Vars(r)["id"], func(job *ImportJob) error {
+		before = auditSnapshot(job)
+		switch job.Status {
+		case ImportStatusCompleted:
+			return newBadRequestError("import is already completed")
+		case ImportStatusRunning:
+			if model.GetMillis()-job.UpdateAt < importLease.Milliseconds() {
+				return ErrImportRunning
+			}
+		}
+		if job.Valid == 0 {
+			return newBadRequestError("no valid rows to import")
+		}
+		if job.Valid < job.Total && !skipInvalid {
+			return newBadRequestError("the file has invalid rows")
+		}
+		job.Status = ImportStatusRunning
+		job.Failure = ""
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindImport, job.ID, before, job)
+
+	go p.runImport(job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		p.API.LogWarn("Failed to write JSON response", "error", err.Error())
+	}
+}
+
+func (p *Plugin) handleDeleteImport(w http.ResponseWriter, r *http.Request) {
+	job, err := p.store.GetImportJob(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if job.Status == ImportStatusRunning && model.GetMillis()-job.UpdateAt < importLease.Milliseconds() {
+		p.handleError(w, ErrImportRunning)
+		return
+	}
+
+	if err := p.store.DeleteImportJob(job); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindImport, job.ID, job, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMigrateLegacy ingests a JSONL dump of the legacy petition backend sent as the request
+// body. Records migrated by an earlier run are skipped, so an interrupted migration can simply be
+// run again. With dry_run set, records are validated without creating anything.
+func (p *Plugin) handleMigrateLegacy(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	m, err := p.newLegacyMigrator(query.Get("team_id"), query.Get("dry_run") == "true")
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	// Records read before the limit is hit stay migrated; running the migration again skips them.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	report, err := m.run(r.Body)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindImport, "", nil, report)
+
+	p.writeJSON(w, report)
+}
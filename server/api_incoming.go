@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// headerIncomingToken carries the incoming webhook token, for the reason given at
+// headerMetricsToken.
+const headerIncomingToken = "X-Webhook-Token"
+
+// headerIdempotencyKey carries the client's key deduplicating retried submissions.
+const headerIdempotencyKey = "Idempotency-Key"
+
+// headerIdempotentReplayed marks responses returning the petition of an earlier submission.
+const headerIdempotentReplayed = "Idempotent-Replayed"
+
+// maxIncomingBodySize bounds the body of incoming webhook requests.
+const maxIncomingBodySize = 64 * 1024
+
+// incomingCreator returns the ID of the account filing submitted petitions: the configured bot,
+// or the plugin's bot.
+func (p *Plugin) incomingCreator() (string, error) {
+	username := strings.TrimSpace(p.getConfiguration().IncomingWebhookBotUsername)
+	if username == "" {
+		return p.botUserID, nil
+	}
+	user, appErr := p.API.GetUserByUsername(username)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get incoming webhook bot")
+	}
+	if !user.IsBot {
+		return "", errors.Errorf("incoming webhook account %s is not a bot", username)
+	}
+	return user.Id, nil
+}
+
+// requireIncomingToken authenticates incoming webhook requests by the configured token and
+// attributes them to the bot filing the petitions, so that the usual rate limits and audit
+// log apply. The route does not exist while no token is configured.
+func (p *Plugin) requireIncomingToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := p.getConfiguration().IncomingWebhookToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		provided := r.Header.Get(headerIncomingToken)
+		if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		creatorID, err := p.incomingCreator()
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		r.Header.Set("Mattermost-User-ID", creatorID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleIncomingPetition files a petition submitted by an external form under the configured
+// category and routes it to the category's assignee. Submissions carrying an Idempotency-Key
+// already used return the petition created the first time.
+func (p *Plugin) handleIncomingPetition(w http.ResponseWriter, r *http.Request) {
+	creatorID := r.Header.Get("Mattermost-User-ID")
+	idempotencyKey := strings.TrimSpace(r.Header.Get(headerIdempotencyKey))
+	if len(idempotencyKey) > maxIncomingKeyLength {
+		p.handleError(w, newBadRequestError("idempotency key is too long"))
+		return
+	}
+
+	var in IncomingPetition
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIncomingBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		p.handleError(w, newBadRequestError(fmt.Sprintf("invalid petition: %s", err.Error())))
+		return
+	}
+	if err := in.IsValid(); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	category, err := p.store.GetCategory(p.getConfiguration().IncomingWebhookCategoryID)
+	if err != nil {
+		p.API.LogError("Incoming webhook category is not usable", "category_id", p.getConfiguration().IncomingWebhookCategoryID, "error", err.Error())
+		http.Error(w, "Incoming webhook is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	petition := in.Petition(category.ID, creatorID)
+	if idempotencyKey != "" {
+		existing, err := p.store.ReserveIdempotencyKey(idempotencyKey, petition.ID)
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if existing != nil {
+			w.Header().Set(headerIdempotentReplayed, "true")
+			p.writeJSON(w, existing)
+			return
+		}
+	}
+
+	if category.AssigneeID != "" {
+		petition.Forward(creatorID, category.AssigneeID, incomingRouteAction)
+	}
+	if err := p.store.SavePetition(petition); err != nil {
+		if idempotencyKey != "" {
+			if releaseErr := p.store.ReleaseIdempotencyKey(idempotencyKey); releaseErr != nil {
+				p.API.LogError("Failed to release idempotency key", "error", releaseErr.Error())
+			}
+		}
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, nil, petition)
+	p.emitWebhookEvent(WebhookEventPetitionCreated, petition)
+	if petition.AssigneeID != "" {
+		p.emitWebhookEvent(WebhookEventPetitionForwarded, petition)
+		p.emailAssignment(creatorID, "", petition)
+		p.sendDirectMessage(petition.AssigneeID, fmt.Sprintf("A petition **%s** was submitted through the online form and routed to you.", petition.Title))
+	}
+
+	p.writeJSON(w, petition)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+type addIssueRequest struct {
+	SendTo      string `json:"send_to"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+	PostID      string `json:"post_id"`
+	DueAt       int64  `json:"due_at"`
+}
+
+type editIssueRequest struct {
+	ID          string `json:"id"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+
+	// DueAt replaces the issue's due date when present; zero clears it.
+	DueAt *int64 `json:"due_at"`
+}
+
+type changeAssignmentRequest struct {
+	ID     string `json:"id"`
+	SendTo string `json:"send_to"`
+}
+
+type issueIDRequest struct {
+	ID string `json:"id"`
+}
+
+// resolveUsername returns the ID of the user with the given username, or an empty string if
+// username is empty.
+func (p *Plugin) resolveUsername(username string) (string, error) {
+	if username == "" {
+		return "", nil
+	}
+	user, appErr := p.API.GetUserByUsername(username)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return "", newBadRequestError("unknown user " + username)
+		}
+		return "", errors.Wrap(appErr, "failed to get user")
+	}
+	return user.Id, nil
+}
+
+func (p *Plugin) handleAddIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req addIssueRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	assigneeID, err := p.resolveUsername(req.SendTo)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	issue, err := NewIssue(req.Message, req.Description, req.PostID, userID, assigneeID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.DueAt < 0 {
+		p.handleError(w, newBadRequestError("due date is invalid"))
+		return
+	}
+	issue.DueAt = req.DueAt
+	if err := p.store.SaveIssue(issue); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, nil, issue)
+
+	p.writeJSON(w, issue)
+}
+
+func (p *Plugin) handleListIssues(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	query := r.URL.Query()
+	listName := query.Get("list")
+	if listName == "" {
+		listName = MyListKey
+	}
+	filter, err := ParseIssueFilter(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	pageReq, err := parsePageRequest(query, issueSortFields...)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	issues, err := p.store.GetIssuesForUser(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	matching := make([]*Issue, 0, len(issues))
+	for _, issue := range issues {
+		if issue.list(userID) == listName && filter.Matches(issue) {
+			matching = append(matching, issue)
+		}
+	}
+
+	page, next := paginate(matching, issueSortKey(pageReq.Sort), pageReq)
+	writePageHeaders(w, len(matching), next)
+	p.writeJSON(w, page)
+}
+
+func (p *Plugin) handleEditIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req editIssueRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.Message == "" {
+		p.handleError(w, newBadRequestError("message is required"))
+		return
+	}
+	if req.DueAt != nil && *req.DueAt < 0 {
+		p.handleError(w, newBadRequestError("due date is invalid"))
+		return
+	}
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(req.ID, func(issue *Issue) error {
+		if !issue.involves(userID) {
+			return ErrNotFound
+		}
+		before = auditSnapshot(issue)
+		issue.Message = req.Message
+		issue.Description = req.Description
+		if req.DueAt != nil {
+			issue.DueAt = *req.DueAt
+		}
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+
+	p.writeJSON(w, issue)
+}
+
+func (p *Plugin) handleChangeAssignment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req changeAssignmentRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	assigneeID, err := p.resolveUsername(req.SendTo)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if assigneeID == "" {
+		assigneeID = userID
+	}
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(req.ID, func(issue *Issue) error {
+		if issue.ChannelID != "" {
+			return ErrNotFound
+		}
+		if issue.CreatorID != userID {
+			return ErrForbidden
+		}
+		before = auditSnapshot(issue)
+		issue.AssigneeID = assigneeID
+		issue.Accepted = assigneeID == issue.CreatorID
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+
+	p.writeJSON(w, issue)
+}
+
+func (p *Plugin) handleAcceptIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req issueIDRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(req.ID, func(issue *Issue) error {
+		if issue.ChannelID != "" || issue.AssigneeID != userID {
+			return ErrNotFound
+		}
+		before = auditSnapshot(issue)
+		issue.Accepted = true
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+
+	p.writeJSON(w, issue)
+}
+
+func (p *Plugin) handleCompleteIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req issueIDRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(req.ID, func(issue *Issue) error {
+		if issue.ChannelID != "" || issue.AssigneeID != userID {
+			return ErrNotFound
+		}
+		if issue.Subtasks.OpenRequired() > 0 {
+			return ErrSubtasksOpen
+		}
+		before = auditSnapshot(issue)
+		issue.CompletedAt = model.GetMillis()
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+
+	p.writeJSON(w, issue)
+}
+
+func (p *Plugin) handleRemoveIssue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req issueIDRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	issue, err := p.store.GetIssue(req.ID)
+	if err == nil && !issue.involves(userID) {
+		err = ErrNotFound
+	}
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if err := p.store.DeleteIssue(issue); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindIssue, issue.ID, issue, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateIssueChecklist is the checklistUpdater for issues: only the creator and the assignee may
+// change an issue's subtasks.
+func (p *Plugin) updateIssueChecklist(r *http.Request, id string, fn func(*Checklist) error) (Checklist, error) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var before json.RawMessage
+	issue, err := p.store.UpdateIssue(id, func(issue *Issue) error {
+		if !issue.involves(userID) {
+			return ErrNotFound
+		}
+		before = auditSnapshot(issue)
+		return fn(&issue.Subtasks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.auditChange(r, KindIssue, issue.ID, before, issue)
+	return issue.Subtasks, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+// instrumentRequests records the status and latency of every request served by a route.
+func (p *Plugin) instrumentRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		p.metrics.ObserveRequest(routeTemplate(r), r.Method, recorder.status, time.Since(start))
+	})
+}
+
+// headerMetricsToken carries the metrics token of scrapers. The Authorization header cannot be
+// used, as the server consumes it before passing requests to plugins.
+const headerMetricsToken = "X-Metrics-Token"
+
+// hasMetricsToken reports whether the request carries the configured metrics token, in the
+// metrics token header or else in the token query parameter.
+func (p *Plugin) hasMetricsToken(r *http.Request) bool {
+	token := p.getConfiguration().MetricsToken
+	if token == "" {
+		return false
+	}
+	provided := r.Header.Get(headerMetricsToken)
+	if provided == "" {
+		provided = r.URL.Query().Get("token")
+	}
+	return provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// handleMetrics serves the plugin's metrics in the Prometheus text format to plugin admins and
+// to scrapers presenting the configured metrics token.
+func (p *Plugin) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !p.hasMetricsToken(r) {
+		userID := r.Header.Get("Mattermost-User-ID")
+		if userID == "" {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		a, err := p.newAccess(userID)
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if !a.IsPluginAdmin() {
+			p.handleError(w, ErrForbidden)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := p.metrics.Write(w); err != nil {
+		p.API.LogWarn("Failed to write metrics", "error", err.Error())
+	}
+}
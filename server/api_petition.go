@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+type createPetitionRequest struct {
+	TeamID     string   `json:"team_id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Priority   int      `json:"priority"`
+	CategoryID string   `json:"category_id"`
+	TopicIDs   []string `json:"topic_ids"`
+}
+
+type forwardPetitionRequest struct {
+	AssigneeID string `json:"assignee_id"`
+	Action     string `json:"action"`
+	Message    string `json:"message"`
+}
+
+// validateCategory reports a bad request if categoryID does not name an existing category.
+func (p *Plugin) validateCategory(categoryID string) error {
+	if _, err := p.store.GetCategory(categoryID); err != nil {
+		if err == ErrNotFound {
+			return newBadRequestError("unknown category")
+		}
+		return err
+	}
+	return nil
+}
+
+// validateUser reports a bad request if userID does not name an existing user.
+func (p *Plugin) validateUser(userID string) error {
+	if _, appErr := p.API.GetUser(userID); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return newBadRequestError("unknown user")
+		}
+		return errors.Wrap(appErr, "failed to get user")
+	}
+	return nil
+}
+
+// PetitionDetail is the full view of a petition returned by the detail route.
+type PetitionDetail struct {
+	*Petition
+	Attachments []*Attachment `json:"attachments"`
+}
+
+// getVisiblePetition returns the petition with the given ID if userID may see it.
+func (p *Plugin) getVisiblePetition(userID, id string) (*Petition, error) {
+	a, err := p.newAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	petition, err := p.store.GetPetition(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.require(petition, nil); err != nil {
+		return nil, err
+	}
+	return petition, nil
+}
+
+func (p *Plugin) handleListPetitions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	query := r.URL.Query()
+	filter, err := ParsePetitionFilter(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	pageReq, err := parsePageRequest(query, petitionSortFields...)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petitions, err := p.store.GetPetitions()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	matching := make([]*Petition, 0, len(petitions))
+	for _, petition := range petitions {
+		if filter.Matches(petition) && a.CanView(petition) {
+			matching = append(matching, petition)
+		}
+	}
+
+	page, next := paginate(matching, petitionSortKey(pageReq.Sort), pageReq)
+	writePageHeaders(w, len(matching), next)
+	p.writeJSON(w, page)
+}
+
+func (p *Plugin) handleGetPetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	attachments, err := p.store.GetAttachments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if attachments == nil {
+		attachments = []*Attachment{}
+	}
+
+	p.writeJSON(w, &PetitionDetail{Petition: petition, Attachments: attachments})
+}
+
+func (p *Plugin) handleCreatePetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req createPetitionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if !a.CanSubmit() {
+		p.handleError(w, ErrForbidden)
+		return
+	}
+
+	now := model.GetMillis()
+	petition := &Petition{
+		ID:         model.NewId(),
+		TeamID:     req.TeamID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Priority:   req.Priority,
+		CategoryID: req.CategoryID,
+		Status:     StatusPending,
+		CreatorID:  userID,
+		Watchers:   []string{userID},
+		Processes:  []*Process{},
+		Subtasks:   Checklist{},
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+	p.categorizePetition(petition)
+	if err := petition.IsValid(); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.validateCategory(petition.CategoryID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if len(req.TopicIDs) > 0 {
+		if petition.TopicIDs, err = normalizeTopicIDs(req.TopicIDs); err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if err := p.validateTopics(petition.TopicIDs); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	if err := p.store.SavePetition(petition); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, nil, petition)
+	p.emitWebhookEvent(WebhookEventPetitionCreated, petition)
+
+	duplicates, err := p.findDuplicatesOf(a, petition)
+	if err != nil {
+		// The petition is filed, so failing to look for duplicates only leaves them unreported.
+		p.API.LogError("Failed to find duplicate petitions", "petition_id", petition.ID, "error", err.Error())
+		duplicates = []*DuplicateCandidate{}
+	}
+
+	p.writeJSON(w, &createPetitionResponse{Petition: petition, Duplicates: duplicates})
+}
+
+func (p *Plugin) handleUpdatePetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var patch PetitionPatch
+	if err := decodeJSON(r, &patch); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if patch.CategoryID != nil {
+		if err := p.validateCategory(*patch.CategoryID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	var before json.RawMessage
+	var previousStatus string
+	var previousPriority int
+	petition, err := p.store.UpdatePetition(mux.Vars(r)["id"], func(petition *Petition) error {
+		if err := a.require(petition, nil); err != nil {
+			return err
+		}
+		if err := a.CheckPatch(petition, &patch); err != nil {
+			return err
+		}
+		if patch.TopicIDs != nil {
+			// Topics linked earlier stay valid after the crawler stops listing them.
+			var added []string
+			for _, topicID := range *patch.TopicIDs {
+				if !containsString(petition.TopicIDs, strings.TrimSpace(topicID)) {
+					added = append(added, topicID)
+				}
+			}
+			if err := p.validateTopics(added); err != nil {
+				return err
+			}
+		}
+		before = auditSnapshot(petition)
+		previousStatus = petition.Status
+		previousPriority = petition.Priority
+		return petition.Apply(&patch)
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+	p.emitStatusWebhookEvents(previousStatus, petition)
+	p.emailPetitionChange(userID, previousStatus, previousPriority, petition)
+
+	p.writeJSON(w, petition)
+}
+
+func (p *Plugin) handleForwardPetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req forwardPetitionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.AssigneeID == "" {
+		p.handleError(w, newBadRequestError("assignee is required"))
+		return
+	}
+	if err := p.validateUser(req.AssigneeID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	var before json.RawMessage
+	var previousAssigneeID string
+	petition, err := p.store.UpdatePetition(mux.Vars(r)["id"], func(petition *Petition) error {
+		if err := a.require(petition, a.CanHandle); err != nil {
+			return err
+		}
+		if !petition.IsOpen() {
+			return newBadRequestError("petition is closed")
+		}
+		before = auditSnapshot(petition)
+		previousAssigneeID = petition.AssigneeID
+		petition.Forward(userID, req.AssigneeID, req.Action)
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+	p.emitWebhookEvent(WebhookEventPetitionForwarded, petition)
+	p.emailAssignment(userID, previousAssigneeID, petition)
+
+	notification := fmt.Sprintf("%s forwarded the petition **%s** to you.", p.displayName(userID), petition.Title)
+	if req.Message != "" {
+		// The petition was forwarded already, so a failure only loses the message.
+		if comment, err := p.addComment(petition, userID, req.Message, req.AssigneeID); err != nil {
+			p.API.LogError("Failed to add forwarding message", "petition_id", petition.ID, "error", err.Error())
+		} else {
+			notification += "\n\n" + quote(comment.Message)
+		}
+	}
+	if req.AssigneeID != userID {
+		p.sendDirectMessage(req.AssigneeID, notification)
+	}
+
+	p.writeJSON(w, petition)
+}
+
+func (p *Plugin) handleDeletePetition(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	id := mux.Vars(r)["id"]
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petition, err := p.store.GetPetition(id)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := a.require(petition, a.CanDelete); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if err := p.store.DeletePetition(id); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if err := p.store.DeleteComments(id); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	attachments, err := p.store.DeleteAttachments(id)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	for _, attachment := range attachments {
+		p.deleteAttachmentFile(attachment)
+	}
+	p.auditChange(r, KindPetition, id, petition, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updatePetitionChecklist is the checklistUpdater for petitions.
+func (p *Plugin) updatePetitionChecklist(r *http.Request, id string, fn func(*Checklist) error) (Checklist, error) {
+	a, err := p.newAccess(r.Header.Get("Mattermost-User-ID"))
+	if err != nil {
+		return nil, err
+	}
+	var before json.RawMessage
+	petition, err := p.store.UpdatePetition(id, func(petition *Petition) error {
+		if err := a.require(petition, a.CanHandle); err != nil {
+			return err
+		}
+		before = auditSnapshot(petition)
+		return fn(&petition.Subtasks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.auditChange(r, KindPetition, petition.ID, before, petition)
+	return petition.Subtasks, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// rateLimit rejects requests exceeding the configured limit of the user on the route with 429
+// Too Many Requests, telling the client when to retry.
+func (p *Plugin) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		perMinute, burst := p.getConfiguration().RateLimit(r.Method, route)
+		if perMinute > 0 {
+			key := r.Header.Get("Mattermost-User-ID") + " " + r.Method + " " + route
+			if allowed, wait := p.limiter.Allow(key, perMinute, burst); !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// auditKindRole is the target kind of audit records about role assignments.
+const auditKindRole = "role"
+
+type assignRoleRequest struct {
+	Role       string `json:"role"`
+	UserID     string `json:"user_id"`
+	GroupID    string `json:"group_id"`
+	CategoryID string `json:"category_id"`
+}
+
+// requirePluginAdmin rejects requests from users who are not plugin admins.
+func (p *Plugin) requirePluginAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a, err := p.newAccess(r.Header.Get("Mattermost-User-ID"))
+		if err != nil {
+			p.handleError(w, err)
+			return
+		}
+		if !a.IsPluginAdmin() {
+			p.handleError(w, ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Plugin) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	assignments, err := p.store.GetRoleAssignments()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if assignments == nil {
+		assignments = []*RoleAssignment{}
+	}
+
+	p.writeJSON(w, assignments)
+}
+
+func (p *Plugin) handleAssignRole(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req assignRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	assignment, err := NewRoleAssignment(req.Role, req.UserID, req.GroupID, req.CategoryID, userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if assignment.UserID != "" {
+		if err := p.validateUser(assignment.UserID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+	if assignment.GroupID != "" {
+		if err := p.validateGroup(assignment.GroupID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+	if assignment.CategoryID != "" {
+		if err := p.validateCategory(assignment.CategoryID); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	assignment, err = p.store.AddRoleAssignment(assignment)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindRole, assignment.ID, nil, assignment)
+
+	p.writeJSON(w, assignment)
+}
+
+func (p *Plugin) handleRevokeRole(w http.ResponseWriter, r *http.Request) {
+	assignment, err := p.store.DeleteRoleAssignment(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindRole, assignment.ID, assignment, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateGroup reports a bad request if groupID does not name an existing Mattermost group.
+func (p *Plugin) validateGroup(groupID string) error {
+	if _, appErr := p.API.GetGroup(groupID); appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return newBadRequestError("unknown group")
+		}
+		return errors.Wrap(appErr, "failed to get group")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Bounds on the number of results returned by the search route.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchResult is a search hit together with the record it refers to.
+type searchResult struct {
+	*SearchHit
+	Petition *Petition `json:"petition,omitempty"`
+	Issue    *Issue    `json:"issue,omitempty"`
+}
+
+func (p *Plugin) handleSearch(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	query := r.URL.Query()
+
+	kind := query.Get("type")
+	if kind != "" && kind != KindPetition && kind != KindIssue {
+		p.handleError(w, newBadRequestError("type must be petition or issue"))
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			p.handleError(w, newBadRequestError("invalid limit"))
+			return
+		}
+		if n > maxSearchLimit {
+			n = maxSearchLimit
+		}
+		limit = n
+	}
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	petitions := map[string]*Petition{}
+	issues := map[string]*Issue{}
+	visible := func(hitKind, id string) bool {
+		if kind != "" && hitKind != kind {
+			return false
+		}
+		switch hitKind {
+		case KindPetition:
+			petition, err := p.store.GetPetition(id)
+			if err != nil || !a.CanView(petition) {
+				return false
+			}
+			petitions[id] = petition
+			return true
+		case KindIssue:
+			issue, err := p.store.GetIssue(id)
+			if err != nil || !p.canSeeIssue(userID, issue) {
+				return false
+			}
+			issues[id] = issue
+			return true
+		}
+		return false
+	}
+
+	hits, err := p.search.Search(query.Get("q"), limit, visible)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	results := make([]*searchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, &searchResult{
+			SearchHit: hit,
+			Petition:  petitions[hit.ID],
+			Issue:     issues[hit.ID],
+		})
+	}
+
+	p.writeJSON(w, results)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handleGetStats returns the statistics of the petitions filed in the team named by team_id
+// between from and to. Only users who may view every petition may see them.
+func (p *Plugin) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	query := r.URL.Query()
+
+	since, until, err := parseDateRange(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if !a.CanViewAll() {
+		p.handleError(w, ErrForbidden)
+		return
+	}
+
+	stats, err := p.stats.Get(StatsScope{TeamID: query.Get("team_id"), Since: since, Until: until})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, stats)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+type telemetryRequest struct {
+	Event      string                 `json:"event"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// TelemetryReport is the telemetry shown to admins: the daily buckets of a period and their
+// totals.
+type TelemetryReport struct {
+	Enabled bool               `json:"enabled"`
+	Days    []*TelemetryBucket `json:"days"`
+	Totals  map[string]int64   `json:"totals"`
+}
+
+// telemetryEnabled reports whether the system admin left the server's diagnostics enabled. The
+// plugin keeps no telemetry when they opted out.
+func (p *Plugin) telemetryEnabled() bool {
+	config := p.API.GetConfig()
+	if config == nil {
+		return false
+	}
+	return config.LogSettings.EnableDiagnostics == nil || *config.LogSettings.EnableDiagnostics
+}
+
+// handleRecordTelemetry counts an event reported by the webapp. Events are dropped when
+// telemetry is disabled.
+func (p *Plugin) handleRecordTelemetry(w http.ResponseWriter, r *http.Request) {
+	var req telemetryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	counters, err := telemetryCounters(req.Event, req.Properties)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if p.telemetryEnabled() {
+		if err := p.store.RecordTelemetry(counters, time.Now()); err != nil {
+			p.handleError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetTelemetry returns the telemetry counted from the day given by from to the day given by
+// to, both formatted as YYYY-MM-DD.
+func (p *Plugin) handleGetTelemetry(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	for _, name := range []string{"from", "to"} {
+		if day := query.Get(name); day != "" {
+			if _, err := time.Parse(telemetryDayLayout, day); err != nil {
+				p.handleError(w, newBadRequestError("invalid "+name+" day"))
+				return
+			}
+		}
+	}
+
+	days, err := p.store.GetTelemetry(query.Get("from"), query.Get("to"))
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	report := &TelemetryReport{Enabled: p.telemetryEnabled(), Days: days, Totals: map[string]int64{}}
+	for _, day := range days {
+		for counter, count := range day.Counts {
+			report.Totals[counter] += count
+		}
+	}
+
+	p.writeJSON(w, report)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TopicList is the topic list served to the webapp.
+type TopicList struct {
+	Topics     []*Topic `json:"topics"`
+	HotTopicID string   `json:"hot_topic_id,omitempty"`
+	FetchedAt  int64    `json:"fetched_at,omitempty"`
+
+	// Stale reports that the latest attempt to refresh the topics failed, so that the list may
+	// be outdated.
+	Stale bool `json:"stale"`
+}
+
+// topicsConfig returns the crawler URL and the topic refresh interval.
+func (p *Plugin) topicsConfig() (string, time.Duration) {
+	config := p.getConfiguration()
+	return strings.TrimSpace(config.TopicsURL), config.TopicsRefreshInterval()
+}
+
+// validateTopics checks that the crawler lists the topics a petition is linked to. Any topic is
+// accepted while no topics were ever fetched, as in offline deployments.
+func (p *Plugin) validateTopics(topicIDs []string) error {
+	if len(topicIDs) == 0 {
+		return nil
+	}
+	cache, err := p.store.GetTopicCache()
+	if err != nil {
+		return err
+	}
+	if len(cache.Topics) == 0 {
+		return nil
+	}
+	known := make(map[string]bool, len(cache.Topics))
+	for _, topic := range cache.Topics {
+		known[topic.ID] = true
+	}
+	for _, topicID := range topicIDs {
+		if !known[strings.TrimSpace(topicID)] {
+			return newBadRequestError("unknown topic " + topicID)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) topicList(cache *TopicCache) *TopicList {
+	return &TopicList{
+		Topics:     cache.Topics,
+		HotTopicID: p.getConfiguration().HotTopicID,
+		FetchedAt:  cache.FetchedAt,
+		Stale:      cache.LastError != "",
+	}
+}
+
+// handleListTopics returns the cached topic list. It never calls the crawler, so that it keeps
+// working when the crawler cannot be reached.
+func (p *Plugin) handleListTopics(w http.ResponseWriter, r *http.Request) {
+	cache, err := p.store.GetTopicCache()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, p.topicList(cache))
+}
+
+// handleRefreshTopics fetches the topics from the crawler at once.
+func (p *Plugin) handleRefreshTopics(w http.ResponseWriter, r *http.Request) {
+	cache, err := p.topics.Refresh()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.writeJSON(w, p.topicList(cache))
+}
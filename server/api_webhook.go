@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// auditKindWebhook is the target kind of audit records about webhook subscriptions and
+// deliveries.
+const auditKindWebhook = "webhook"
+
+// webhookDeliverySortFields lists the sort fields of the delivery log route.
+var webhookDeliverySortFields = []string{"create_at", "update_at"}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// initWebhookRoutes registers the routes managing webhook subscriptions and deliveries on
+// router, which only plugin admins may reach.
+func (p *Plugin) initWebhookRoutes(router *mux.Router) {
+	router.HandleFunc("", p.handleListWebhooks).Methods(http.MethodGet)
+	router.HandleFunc("", p.handleCreateWebhook).Methods(http.MethodPost).Name("webhook.create")
+	router.HandleFunc("/deliveries", p.handleListWebhookDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/deliveries/{id}/retry", p.handleRetryWebhookDelivery).Methods(http.MethodPost).Name("webhook.retry")
+	router.HandleFunc("/dead_letters", p.handleListDeadWebhookDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/{id}", p.handleUpdateWebhook).Methods(http.MethodPut).Name("webhook.update")
+	router.HandleFunc("/{id}", p.handleDeleteWebhook).Methods(http.MethodDelete).Name("webhook.delete")
+}
+
+// emitWebhookEvent queues the delivery of event about petition. The petition change already
+// happened, so failures are logged rather than reported to the client.
+func (p *Plugin) emitWebhookEvent(event string, petition *Petition) {
+	if err := p.webhooks.Enqueue(event, petition); err != nil {
+		p.API.LogError("Failed to queue webhook deliveries", "event", event, "petition_id", petition.ID, "error", err.Error())
+	}
+}
+
+// emitStatusWebhookEvents queues the events of a petition's transition from previousStatus.
+func (p *Plugin) emitStatusWebhookEvents(previousStatus string, petition *Petition) {
+	if previousStatus != StatusResolved && petition.Status == StatusResolved {
+		p.emitWebhookEvent(WebhookEventPetitionResolved, petition)
+	}
+}
+
+func (p *Plugin) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := p.store.GetWebhookSubscriptions()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	redacted := make([]*WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		redacted = append(redacted, subscription.Redacted())
+	}
+	p.writeJSON(w, redacted)
+}
+
+// handleCreateWebhook creates a subscription and returns it with its signing secret, which is
+// not shown again.
+func (p *Plugin) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var req webhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	subscription, err := NewWebhookSubscription(req.URL, req.Events, userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	if err := p.store.SaveWebhookSubscription(subscription); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindWebhook, subscription.ID, nil, subscription.Redacted())
+
+	p.writeJSON(w, subscription)
+}
+
+// handleUpdateWebhook replaces the URL and events of a subscription, and activates or
+// deactivates it.
+func (p *Plugin) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	var before json.RawMessage
+	subscription, err := p.store.UpdateWebhookSubscription(mux.Vars(r)["id"], func(subscription *WebhookSubscription) error {
+		before = auditSnapshot(subscription.Redacted())
+		if req.URL != "" {
+			subscription.URL = req.URL
+		}
+		if req.Events != nil {
+			subscription.Events = req.Events
+		}
+		if req.Active != nil {
+			subscription.Active = *req.Active
+		}
+		subscription.UpdateAt = model.GetMillis()
+		return subscription.IsValid()
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindWebhook, subscription.ID, before, subscription.Redacted())
+
+	p.writeJSON(w, subscription.Redacted())
+}
+
+func (p *Plugin) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	subscription, err := p.store.GetWebhookSubscription(mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	if err := p.store.DeleteWebhookSubscription(subscription.ID); err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindWebhook, subscription.ID, subscription.Redacted(), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWebhookDeliveries returns the delivery log, filtered by the status, event and
+// subscription_id query parameters and paginated like the other list routes.
+func (p *Plugin) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	pageReq, err := parsePageRequest(query, webhookDeliverySortFields...)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	deliveries, err := p.store.GetWebhookDeliveryLog()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	status, event, subscriptionID := query.Get("status"), query.Get("event"), query.Get("subscription_id")
+	matching := make([]*WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if (status == "" || delivery.Status == status) &&
+			(event == "" || delivery.Event == event) &&
+			(subscriptionID == "" || delivery.SubscriptionID == subscriptionID) {
+			matching = append(matching, delivery)
+		}
+	}
+
+	page, next := paginate(matching, func(delivery *WebhookDelivery) sortKey {
+		if pageReq.Sort == "update_at" {
+			return sortKey{Num: delivery.UpdateAt, ID: delivery.ID}
+		}
+		return sortKey{Num: delivery.CreateAt, ID: delivery.ID}
+	}, pageReq)
+	writePageHeaders(w, len(matching), next)
+	p.writeJSON(w, page)
+}
+
+func (p *Plugin) handleListDeadWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := p.store.GetDeadWebhookDeliveries()
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	p.writeJSON(w, deliveries)
+}
+
+// handleRetryWebhookDelivery queues a dead-lettered delivery again, with a fresh set of attempts.
+func (p *Plugin) handleRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	var before json.RawMessage
+	delivery, err := p.store.UpdateWebhookDelivery(mux.Vars(r)["id"], func(delivery *WebhookDelivery) error {
+		if delivery.Status != DeliveryStatusDead {
+			return newBadRequestError("only dead-lettered deliveries can be retried")
+		}
+		before = auditSnapshot(delivery)
+		now := model.GetMillis()
+		delivery.Status = DeliveryStatusPending
+		delivery.Failures = 0
+		delivery.NextAttemptAt = now
+		delivery.UpdateAt = now
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	p.auditChange(r, auditKindWebhook, delivery.ID, before, delivery)
+	p.webhooks.Wake()
+
+	p.writeJSON(w, delivery)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+const attachmentsKeyPrefix = "attachments_"
+
+// Attachment links a file held in Mattermost file storage to a petition. The plugin API cannot
+// delete files, so each file is attached to a post of the bot in its own direct channel, out of
+// sight of users; deleting that post deletes the file.
+type Attachment struct {
+	ID         string `json:"id"`
+	PetitionID string `json:"petition_id"`
+	PostID     string `json:"post_id"`
+	UserID     string `json:"user_id"`
+	Name       string `json:"name"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	CreateAt   int64  `json:"create_at"`
+}
+
+func attachmentsKey(petitionID string) string {
+	return attachmentsKeyPrefix + petitionID
+}
+
+// GetAttachments returns the attachments of a petition, oldest first.
+func (s *Store) GetAttachments(petitionID string) ([]*Attachment, error) {
+	var attachments []*Attachment
+	if _, err := getJSON(s.kv, attachmentsKey(petitionID), &attachments); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// GetAttachment returns the attachment of a petition with the given file ID.
+func (s *Store) GetAttachment(petitionID, fileID string) (*Attachment, error) {
+	attachments, err := s.GetAttachments(petitionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if attachment.ID == fileID {
+			return attachment, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SaveAttachment links an attachment to its petition.
+func (s *Store) SaveAttachment(attachment *Attachment) error {
+	return s.modifyAttachments(attachment.PetitionID, func(attachments []*Attachment) ([]*Attachment, error) {
+		return append(attachments, attachment), nil
+	})
+}
+
+// DeleteAttachment unlinks the given attachment if check accepts it. The caller deletes its file.
+func (s *Store) DeleteAttachment(petitionID, fileID string, check func(*Attachment) error) error {
+	return s.modifyAttachments(petitionID, func(attachments []*Attachment) ([]*Attachment, error) {
+		for i, attachment := range attachments {
+			if attachment.ID != fileID {
+				continue
+			}
+			if err := check(attachment); err != nil {
+				return nil, err
+			}
+			return append(attachments[:i], attachments[i+1:]...), nil
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// DeleteAttachments unlinks every attachment of a petition and returns them, so that the caller
+// may delete their files.
+func (s *Store) DeleteAttachments(petitionID string) ([]*Attachment, error) {
+	attachments, err := s.GetAttachments(petitionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.kv.Delete(attachmentsKey(petitionID)); err != nil {
+		return nil, err
+	}
+	s.notifyChange(KindPetition, petitionID)
+	return attachments, nil
+}
+
+func (s *Store) modifyAttachments(petitionID string, fn func([]*Attachment) ([]*Attachment, error)) error {
+	err := modifyJSON(s.kv, attachmentsKey(petitionID), func(initial []byte) (interface{}, error) {
+		var attachments []*Attachment
+		if initial != nil {
+			if err := json.Unmarshal(initial, &attachments); err != nil {
+				return nil, errors.Wrap(err, "failed to decode attachments")
+			}
+		}
+		return fn(attachments)
+	})
+	if err != nil {
+		return err
+	}
+	s.notifyChange(KindPetition, petitionID)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAllowedAttachmentType(t *testing.T) {
+	config := &configuration{AllowedAttachmentTypes: "image/*, application/pdf"}
+	assert.True(t, config.IsAllowedAttachmentType("image/png"))
+	assert.True(t, config.IsAllowedAttachmentType("application/PDF"))
+	assert.False(t, config.IsAllowedAttachmentType("application/zip"))
+	assert.False(t, config.IsAllowedAttachmentType("imagex/png"))
+
+	assert.True(t, (&configuration{}).IsAllowedAttachmentType("application/zip"))
+	assert.Equal(t, int64(defaultMaxAttachmentSize*1024*1024), (&configuration{}).MaxAttachmentBytes())
+}
+
+// uploadRequest builds a multipart upload of a single file.
+func uploadRequest(t *testing.T, path, userID, filename string, data []byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	r := httptest.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Mattermost-User-ID", userID)
+	return r
+}
+
+func TestAttachments(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	p.setConfiguration(&configuration{MaxAttachmentSize: 1, AllowedAttachmentTypes: "application/pdf"})
+	petition := createTestPetition(t, p, "user1")
+	base := "/requests/" + petition.ID + "/attachments"
+
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	api.On("GetDirectChannel", "bot", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("UploadFile", []byte("%PDF-1.4"), "dm", "đơn kiến nghị.pdf").Return(&model.FileInfo{Id: "file1"}, nil)
+	api.On("UploadFile", []byte("%PDF-1.4"), "dm", "ảnh.pdf").Return(&model.FileInfo{Id: "file2"}, nil)
+	for _, fileID := range []string{"file1", "file2"} {
+		fileIDs := model.StringArray{fileID}
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.UserId == "bot" && post.ChannelId == "dm" && assert.ObjectsAreEqual(fileIDs, post.FileIds)
+		})).Return(&model.Post{Id: "post-" + fileID}, nil).Once()
+	}
+	api.On("GetFile", "file1").Return([]byte("%PDF-1.4"), nil)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, uploadRequest(t, base, "user1", "đơn kiến nghị.pdf", []byte("%PDF-1.4")))
+	require.Equal(t, http.StatusOK, w.Code)
+	var attachment Attachment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&attachment))
+	assert.Equal(t, "application/pdf", attachment.MimeType)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, uploadRequest(t, base, "user1", "archive.zip", []byte("PK")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, uploadRequest(t, base, "user1", "big.pdf", make([]byte, 1024*1024+1)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, uploadRequest(t, base, "user2", "other.pdf", []byte("%PDF-1.4")))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodGet, base+"/file1", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "%PDF-1.4", w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	w = doRequest(p, http.MethodGet, base+"/file1", "user2", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests/"+petition.ID, "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var detail PetitionDetail
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&detail))
+	assert.Equal(t, petition.ID, detail.ID)
+	require.Len(t, detail.Attachments, 1)
+	assert.Equal(t, "file1", detail.Attachments[0].ID)
+
+	// Deleting an attachment deletes the post holding its file, and so the file.
+	api.On("DeletePost", "post-file1").Return(nil).Once()
+	w = doRequest(p, http.MethodDelete, base+"/file1", "user1", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// So does deleting the petition.
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, uploadRequest(t, base, "user1", "ảnh.pdf", []byte("%PDF-1.4")))
+	require.Equal(t, http.StatusOK, w.Code)
+	api.On("DeletePost", "post-file2").Return(nil).Once()
+	w = doRequest(p, http.MethodDelete, "/requests/"+petition.ID, "admin", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
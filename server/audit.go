@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	auditHeadKey       = "audit_head"
+	auditRecordKeyBase = "audit_"
+)
+
+// Target kinds of audit records, besides the kinds of records reported to change listeners.
+const (
+	auditKindComment    = "comment"
+	auditKindAttachment = "attachment"
+	auditKindImport     = "import"
+)
+
+// AuditChange holds the JSON values of a field before and after a mutation. A missing value
+// means the field did not exist, as when a record is created or deleted.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditRecord is one entry of the audit log. Records are numbered from 1 and each one carries
+// the hash of its predecessor, so that altering, removing or reordering records breaks the
+// chain.
+type AuditRecord struct {
+	Seq        int64                   `json:"seq"`
+	CreateAt   int64                   `json:"create_at"`
+	ActorID    string                  `json:"actor_id"`
+	Action     string                  `json:"action"`
+	TargetKind string                  `json:"target_kind,omitempty"`
+	TargetID   string                  `json:"target_id,omitempty"`
+	RequestID  string                  `json:"request_id,omitempty"`
+	Changes    map[string]*AuditChange `json:"changes,omitempty"`
+	PrevHash   string                  `json:"prev_hash"`
+	Hash       string                  `json:"hash"`
+}
+
+// auditHead points at the last record of the audit log.
+type auditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+func auditRecordKey(seq int64) string {
+	return fmt.Sprintf("%s%016d", auditRecordKeyBase, seq)
+}
+
+// computeHash returns the hash of the record's contents, excluding the hash itself.
+func (r *AuditRecord) computeHash() (string, error) {
+	unhashed := *r
+	unhashed.Hash = ""
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode audit record")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// auditSnapshot encodes v for diffing. Snapshots are taken inside atomic updates, before the
+// record is modified, since the modification may alter values shared with the original.
+func auditSnapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	return data
+}
+
+// snapshotFields splits a JSON snapshot into its top-level fields. Snapshots that are not
+// objects are held in a single field named value.
+func snapshotFields(snapshot json.RawMessage) map[string]json.RawMessage {
+	if snapshot == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return map[string]json.RawMessage{"value": snapshot}
+	}
+	return fields
+}
+
+// diffSnapshots returns the top-level fields that differ between two JSON snapshots.
+func diffSnapshots(before, after json.RawMessage) map[string]*AuditChange {
+	beforeFields, afterFields := snapshotFields(before), snapshotFields(after)
+
+	changes := map[string]*AuditChange{}
+	for field, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[field]) {
+			changes[field] = &AuditChange{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes[field] = &AuditChange{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func (s *Store) getAuditHead() (*auditHead, []byte, error) {
+	data, err := s.kv.Get(auditHeadKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	head := &auditHead{}
+	if data != nil {
+		if err := json.Unmarshal(data, head); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to decode audit head")
+		}
+	}
+	return head, data, nil
+}
+
+// AppendAuditRecord chains record to the end of the audit log, setting its sequence number,
+// timestamp and hashes. Records are created with compare-and-set and never overwritten; the head
+// is advanced afterwards, and a head left behind by an interrupted append is caught up by the
+// next one.
+func (s *Store) AppendAuditRecord(record *AuditRecord) error {
+	for i := 0; i < maxAtomicRetries; i++ {
+		head, headData, err := s.getAuditHead()
+		if err != nil {
+			return err
+		}
+
+		next, err := s.GetAuditRecord(head.Seq + 1)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if next != nil {
+			if err := s.advanceAuditHead(headData, next); err != nil {
+				return err
+			}
+			continue
+		}
+
+		record.Seq = head.Seq + 1
+		record.CreateAt = model.GetMillis()
+		record.PrevHash = head.Hash
+		if record.Hash, err = record.computeHash(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode audit record")
+		}
+		ok, err := s.kv.CompareAndSet(auditRecordKey(record.Seq), nil, data)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		return s.advanceAuditHead(headData, record)
+	}
+	return errors.New("failed to append audit record: too many concurrent appends")
+}
+
+// advanceAuditHead moves the head from the state read as headData to record, unless another
+// append already moved it.
+func (s *Store) advanceAuditHead(headData []byte, record *AuditRecord) error {
+	data, err := json.Marshal(&auditHead{Seq: record.Seq, Hash: record.Hash})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit head")
+	}
+	_, err = s.kv.CompareAndSet(auditHeadKey, headData, data)
+	return err
+}
+
+// GetAuditRecord returns the audit record with the given sequence number.
+func (s *Store) GetAuditRecord(seq int64) (*AuditRecord, error) {
+	var record AuditRecord
+	found, err := getJSON(s.kv, auditRecordKey(seq), &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &record, nil
+}
+
+// LastAuditSeq returns the sequence number of the last audit record, or 0 if the log is empty.
+func (s *Store) LastAuditSeq() (int64, error) {
+	head, _, err := s.getAuditHead()
+	if err != nil {
+		return 0, err
+	}
+	return head.Seq, nil
+}
+
+// AuditVerification is the outcome of checking the audit log's hash chain. When the chain is
+// broken, FailedSeq is the first record found to be missing or altered.
+type AuditVerification struct {
+	Valid     bool   `json:"valid"`
+	Records   int64  `json:"records"`
+	HeadHash  string `json:"head_hash"`
+	FailedSeq int64  `json:"failed_seq,omitempty"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+// VerifyAuditLog walks the audit log from its first record and checks that every record is
+// present, unaltered and chained to its predecessor. Truncating the end of the log together with
+// the head goes unnoticed by the chain alone, so the reported head hash is worth keeping
+// outside of Mattermost.
+func (s *Store) VerifyAuditLog() (*AuditVerification, error) {
+	head, _, err := s.getAuditHead()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AuditVerification{Valid: true, Records: head.Seq, HeadHash: head.Hash}
+	fail := func(seq int64, problem string) (*AuditVerification, error) {
+		result.Valid = false
+		result.FailedSeq = seq
+		result.Problem = problem
+		return result, nil
+	}
+
+	prevHash := ""
+	for seq := int64(1); seq <= head.Seq; seq++ {
+		record, err := s.GetAuditRecord(seq)
+		if err == ErrNotFound {
+			return fail(seq, "record is missing")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Seq != seq {
+			return fail(seq, fmt.Sprintf("record holds sequence number %d", record.Seq))
+		}
+		if record.PrevHash != prevHash {
+			return fail(seq, "record is not chained to its predecessor")
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return nil, err
+		}
+		if hash != record.Hash {
+			return fail(seq, "record contents do not match its hash")
+		}
+		prevHash = record.Hash
+	}
+	if prevHash != head.Hash {
+		return fail(head.Seq, "head does not match the last record")
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	changes := diffSnapshots(json.RawMessage(`{"a":1,"b":"x","c":true}`), json.RawMessage(`{"a":1,"b":"y","d":null}`))
+	assert.Equal(t, map[string]*AuditChange{
+		"b": {Before: json.RawMessage(`"x"`), After: json.RawMessage(`"y"`)},
+		"c": {Before: json.RawMessage(`true`)},
+		"d": {After: json.RawMessage(`null`)},
+	}, changes)
+
+	assert.Nil(t, diffSnapshots(json.RawMessage(`{"a":1}`), json.RawMessage(`{"a":1}`)))
+	assert.Equal(t, map[string]*AuditChange{"value": {After: json.RawMessage(`3`)}}, diffSnapshots(nil, auditSnapshot(3)))
+}
+
+func TestAuditChain(t *testing.T) {
+	kv := newMemKVStore()
+	store := NewStore(kv)
+
+	for _, action := range []string{"one", "two", "three"} {
+		require.NoError(t, store.AppendAuditRecord(&AuditRecord{ActorID: "user1", Action: action}))
+	}
+	second, err := store.GetAuditRecord(2)
+	require.NoError(t, err)
+	first, err := store.GetAuditRecord(1)
+	require.NoError(t, err)
+	assert.Equal(t, "", first.PrevHash)
+	assert.Equal(t, first.Hash, second.PrevHash)
+
+	result, err := store.VerifyAuditLog()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(3), result.Records)
+
+	// An append interrupted before advancing the head is caught up by the next one.
+	data, _ := kv.Get(auditHeadKey)
+	require.NoError(t, store.AppendAuditRecord(&AuditRecord{Action: "four"}))
+	require.NoError(t, kv.Set(auditHeadKey, data))
+	require.NoError(t, store.AppendAuditRecord(&AuditRecord{Action: "five"}))
+	fifth, err := store.GetAuditRecord(5)
+	require.NoError(t, err)
+	assert.Equal(t, "five", fifth.Action)
+	result, err = store.VerifyAuditLog()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	second.ActorID = "user2"
+	data, _ = json.Marshal(second)
+	require.NoError(t, kv.Set(auditRecordKey(2), data))
+	result, err = store.VerifyAuditLog()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(2), result.FailedSeq)
+
+	require.NoError(t, kv.Delete(auditRecordKey(2)))
+	result, err = store.VerifyAuditLog()
+	require.NoError(t, err)
+	assert.Equal(t, &AuditVerification{Records: 5, HeadHash: result.HeadHash, FailedSeq: 2, Problem: "record is missing"}, result)
+}
+
+func queryAudit(t *testing.T, p *Plugin, query string) ([]*AuditRecord, *httptest.ResponseRecorder) {
+	w := doRequest(p, http.MethodGet, "/audit"+query, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var records []*AuditRecord
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&records))
+	return records, w
+}
+
+func TestAuditMutations(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(false)
+	petition := createTestPetition(t, p, "user1")
+
+	r := httptest.NewRequest(http.MethodPut, "/requests/"+petition.ID, strings.NewReader(`{"title":"Pothole on Main street"}`))
+	r.Header.Set("Mattermost-User-ID", "user1")
+	r.Header.Set(headerRequestID, "req1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req1", w.Header().Get(headerRequestID))
+
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]int{"priority": 9})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/requests/duplicates", "user1", map[string]string{"title": "Pothole", "category_id": petition.CategoryID})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerRequestID), "read-only routes are not audited")
+
+	records, _ := queryAudit(t, p, "")
+	require.Len(t, records, 2)
+	update := records[0]
+	assert.Equal(t, "petition.update", update.Action)
+	assert.Equal(t, "user1", update.ActorID)
+	assert.Equal(t, KindPetition, update.TargetKind)
+	assert.Equal(t, petition.ID, update.TargetID)
+	assert.Equal(t, "req1", update.RequestID)
+	assert.Equal(t, &AuditChange{Before: json.RawMessage(`"Pothole"`), After: json.RawMessage(`"Pothole on Main street"`)}, update.Changes["title"])
+	assert.Equal(t, "petition.create", records[1].Action)
+	assert.Nil(t, records[1].Changes["id"].Before)
+
+	w = doRequest(p, http.MethodDelete, "/requests/"+petition.ID, "admin", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	records, w = queryAudit(t, p, "?action=petition.&target="+petition.ID+"&per_page=2")
+	require.Len(t, records, 2)
+	assert.Equal(t, "petition.delete", records[0].Action)
+	assert.Nil(t, records[0].Changes["title"].After)
+	cursor := w.Header().Get(headerNextCursor)
+	require.NotEmpty(t, cursor)
+	records, w = queryAudit(t, p, "?action=petition.&target="+petition.ID+"&per_page=2&cursor="+cursor)
+	require.Len(t, records, 1)
+	assert.Equal(t, "petition.create", records[0].Action)
+	assert.Empty(t, w.Header().Get(headerNextCursor))
+
+	records, _ = queryAudit(t, p, "?actor=user2")
+	assert.Empty(t, records)
+
+	w = doRequest(p, http.MethodGet, "/audit/verify", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result AuditVerification
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(3), result.Records)
+
+	w = doRequest(p, http.MethodGet, "/audit", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
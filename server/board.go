@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	boardKeyPrefix = "board_"
+	boardIndexKey  = "board_ids"
+)
+
+// BoardColumn is a column of a kanban board. Status columns hold the petitions in a workflow
+// state; columns without a status are buckets holding the petitions moved into them, whatever
+// their state. Order lists the IDs of the column's petitions as last arranged on the board.
+type BoardColumn struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Status string   `json:"status,omitempty"`
+	Order  []string `json:"order"`
+}
+
+// Board is a kanban view of petitions, optionally limited to a category.
+type Board struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	CategoryID string         `json:"category_id,omitempty"`
+	Columns    []*BoardColumn `json:"columns"`
+	CreatorID  string         `json:"creator_id"`
+	CreateAt   int64          `json:"create_at"`
+	UpdateAt   int64          `json:"update_at"`
+}
+
+// defaultBoardColumns returns one column per workflow state.
+func defaultBoardColumns() []*BoardColumn {
+	return []*BoardColumn{
+		{Name: "Pending", Status: StatusPending},
+		{Name: "In progress", Status: StatusInProgress},
+		{Name: "Resolved", Status: StatusResolved},
+		{Name: "Rejected", Status: StatusRejected},
+	}
+}
+
+func boardKey(id string) string {
+	return boardKeyPrefix + id
+}
+
+// SetColumns replaces the board's columns, keeping the order of cards in columns that retain
+// their ID and generating IDs for new columns.
+func (b *Board) SetColumns(columns []*BoardColumn) error {
+	if len(columns) == 0 {
+		return newBadRequestError("a board needs at least one column")
+	}
+
+	existing := map[string]*BoardColumn{}
+	for _, column := range b.Columns {
+		existing[column.ID] = column
+	}
+	statuses := map[string]bool{}
+	result := make([]*BoardColumn, 0, len(columns))
+	for _, column := range columns {
+		name := strings.TrimSpace(column.Name)
+		if name == "" {
+			return newBadRequestError("column name is required")
+		}
+		if column.Status != "" {
+			if !isValidStatus(column.Status) {
+				return newBadRequestError("invalid column status")
+			}
+			if statuses[column.Status] {
+				return newBadRequestError("each status may only have one column")
+			}
+			statuses[column.Status] = true
+		}
+
+		updated := &BoardColumn{ID: column.ID, Name: name, Status: column.Status, Order: []string{}}
+		if previous, ok := existing[column.ID]; ok && column.ID != "" {
+			updated.Order = previous.Order
+			delete(existing, column.ID)
+		} else {
+			updated.ID = model.NewId()
+		}
+		result = append(result, updated)
+	}
+	b.Columns = result
+	return nil
+}
+
+// NewBoard returns a board with a freshly generated ID. Without columns, the board has one
+// column per workflow state.
+func NewBoard(name, categoryID, creatorID string, columns []*BoardColumn) (*Board, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, newBadRequestError("board name is required")
+	}
+	if len(columns) == 0 {
+		columns = defaultBoardColumns()
+	}
+
+	now := model.GetMillis()
+	board := &Board{
+		ID:         model.NewId(),
+		Name:       name,
+		CategoryID: categoryID,
+		CreatorID:  creatorID,
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+	if err := board.SetColumns(columns); err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+// Column returns the column with the given ID, or nil.
+func (b *Board) Column(id string) *BoardColumn {
+	for _, column := range b.Columns {
+		if column.ID == id {
+			return column
+		}
+	}
+	return nil
+}
+
+// Layout distributes petitions over the board's columns. A petition listed by a bucket belongs
+// to the first such bucket; any other petition belongs to the column of its status, if any.
+// Within a column, cards follow the column's order, and cards not yet arranged follow, oldest
+// first. Petitions outside the board's category are left out.
+func (b *Board) Layout(petitions []*Petition) [][]*Petition {
+	byID := make(map[string]*Petition, len(petitions))
+	for _, petition := range petitions {
+		if b.CategoryID == "" || petition.CategoryID == b.CategoryID {
+			byID[petition.ID] = petition
+		}
+	}
+
+	cards := make([][]*Petition, len(b.Columns))
+	placed := map[string]bool{}
+	for i, column := range b.Columns {
+		if column.Status != "" {
+			continue
+		}
+		for _, id := range column.Order {
+			if petition, ok := byID[id]; ok && !placed[id] {
+				cards[i] = append(cards[i], petition)
+				placed[id] = true
+			}
+		}
+	}
+
+	for i, column := range b.Columns {
+		if column.Status == "" {
+			continue
+		}
+		for _, id := range column.Order {
+			if petition, ok := byID[id]; ok && !placed[id] && petition.Status == column.Status {
+				cards[i] = append(cards[i], petition)
+				placed[id] = true
+			}
+		}
+		for _, petition := range petitions {
+			if _, ok := byID[petition.ID]; ok && !placed[petition.ID] && petition.Status == column.Status {
+				cards[i] = append(cards[i], petition)
+				placed[petition.ID] = true
+			}
+		}
+	}
+	return cards
+}
+
+// Place moves the petition to position index of the column with the given ID, given the current
+// petitions. The orders of every column are rewritten from the current layout, which drops
+// petitions that left them.
+func (b *Board) Place(petitions []*Petition, petitionID, columnID string, index int) error {
+	target := -1
+	for i, column := range b.Columns {
+		if column.ID == columnID {
+			target = i
+		}
+	}
+	if target < 0 {
+		return newBadRequestError("unknown column")
+	}
+
+	for i, cards := range b.Layout(petitions) {
+		order := make([]string, 0, len(cards)+1)
+		for _, petition := range cards {
+			if petition.ID != petitionID {
+				order = append(order, petition.ID)
+			}
+		}
+		if i == target {
+			if index < 0 || index > len(order) {
+				index = len(order)
+			}
+			order = append(order[:index], append([]string{petitionID}, order[index:]...)...)
+		}
+		b.Columns[i].Order = order
+	}
+	b.UpdateAt = model.GetMillis()
+	return nil
+}
+
+// SaveBoard stores a new board and indexes it.
+func (s *Store) SaveBoard(board *Board) error {
+	if err := setJSON(s.kv, boardKey(board.ID), board); err != nil {
+		return err
+	}
+	return addToIndex(s.kv, boardIndexKey, board.ID)
+}
+
+// GetBoard returns the board with the given ID.
+func (s *Store) GetBoard(id string) (*Board, error) {
+	var board Board
+	found, err := getJSON(s.kv, boardKey(id), &board)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &board, nil
+}
+
+// GetBoards returns every board in creation order.
+func (s *Store) GetBoards() ([]*Board, error) {
+	ids, err := getIndex(s.kv, boardIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	boards := make([]*Board, 0, len(ids))
+	for _, id := range ids {
+		board, err := s.GetBoard(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		boards = append(boards, board)
+	}
+	return boards, nil
+}
+
+// UpdateBoard atomically applies fn to the board with the given ID and returns the result.
+func (s *Store) UpdateBoard(id string, fn func(*Board) error) (*Board, error) {
+	var updated *Board
+	err := modifyJSON(s.kv, boardKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var board Board
+		if err := json.Unmarshal(initial, &board); err != nil {
+			return nil, errors.Wrap(err, "failed to decode board")
+		}
+		if err := fn(&board); err != nil {
+			return nil, err
+		}
+		updated = &board
+		return &board, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteBoard removes the board with the given ID.
+func (s *Store) DeleteBoard(id string) error {
+	if err := removeFromIndex(s.kv, boardIndexKey, id); err != nil {
+		return errors.Wrap(err, "failed to unindex board")
+	}
+	return s.kv.Delete(boardKey(id))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func cardIDs(cards []*Petition) []string {
+	ids := make([]string, len(cards))
+	for i, card := range cards {
+		ids[i] = card.ID
+	}
+	return ids
+}
+
+func TestBoardLayout(t *testing.T) {
+	board, err := NewBoard("Triage", "", "user1", []*BoardColumn{
+		{Name: "Urgent"},
+		{Name: "Open", Status: StatusPending},
+		{Name: "Done", Status: StatusResolved},
+	})
+	require.NoError(t, err)
+	urgent, open, done := board.Columns[0].ID, board.Columns[1].ID, board.Columns[2].ID
+
+	petitions := []*Petition{
+		{ID: "a", Status: StatusPending},
+		{ID: "b", Status: StatusPending},
+		{ID: "c", Status: StatusPending},
+		{ID: "d", Status: StatusResolved},
+		{ID: "e", Status: StatusRejected},
+	}
+	layout := func() [][]string {
+		var ids [][]string
+		for _, cards := range board.Layout(petitions) {
+			ids = append(ids, cardIDs(cards))
+		}
+		return ids
+	}
+	assert.Equal(t, [][]string{{}, {"a", "b", "c"}, {"d"}}, layout())
+
+	require.NoError(t, board.Place(petitions, "c", open, 0))
+	assert.Equal(t, [][]string{{}, {"c", "a", "b"}, {"d"}}, layout())
+	require.NoError(t, board.Place(petitions, "d", urgent, 5))
+	require.NoError(t, board.Place(petitions, "a", urgent, 0))
+	assert.Equal(t, [][]string{{"a", "d"}, {"c", "b"}, {}}, layout())
+
+	// Petitions that left a status column's state drop out of it.
+	petitions[1].Status = StatusResolved
+	require.NoError(t, board.Place(petitions, "d", done, 0))
+	assert.Equal(t, [][]string{{"a"}, {"c"}, {"d", "b"}}, layout())
+
+	assert.Error(t, board.Place(petitions, "a", "bogus", 0))
+	assert.Error(t, board.SetColumns([]*BoardColumn{{Name: "One", Status: StatusPending}, {Name: "Two", Status: StatusPending}}))
+}
+
+func TestBoardMove(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	first := createTestPetition(t, p, "user1")
+	second := createTestPetition(t, p, "user1")
+
+	w := doRequest(p, http.MethodPost, "/boards", "admin", map[string]string{"name": "Triage"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var board BoardView
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&board))
+	require.Len(t, board.Columns, 4)
+	pending, resolved := board.Columns[0].ID, board.Columns[2].ID
+
+	move := func(userID, petitionID, columnID string, index int) *BoardView {
+		w := doRequest(p, http.MethodPost, "/boards/"+board.ID+"/move", userID, map[string]interface{}{"petition_id": petitionID, "column_id": columnID, "index": index})
+		if w.Code != http.StatusOK {
+			return nil
+		}
+		var view BoardView
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&view))
+		return &view
+	}
+
+	view := move("admin", second.ID, pending, 0)
+	require.NotNil(t, view)
+	assert.Equal(t, []string{second.ID, first.ID}, cardIDs(view.Columns[0].Cards))
+
+	// The submitter may not resolve their own petition, so the card stays put.
+	assert.Nil(t, move("user1", first.ID, resolved, 0))
+	w = doRequest(p, http.MethodPost, "/boards/"+board.ID+"/move", "user2", map[string]interface{}{"petition_id": first.ID, "column_id": resolved})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/requests/"+first.ID+"/subtasks", "user1", map[string]interface{}{"title": "Inspect", "required": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodPost, "/boards/"+board.ID+"/move", "admin", map[string]interface{}{"petition_id": first.ID, "column_id": resolved})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	view = move("admin", second.ID, resolved, 0)
+	require.NotNil(t, view)
+	assert.Equal(t, []string{first.ID}, cardIDs(view.Columns[0].Cards))
+	assert.Equal(t, []string{second.ID}, cardIDs(view.Columns[2].Cards))
+	petition, err := p.store.GetPetition(second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusResolved, petition.Status)
+
+	// A transition is audited along with the board change placing the card.
+	records, _ := queryAudit(t, p, "?action=board.move&per_page=2")
+	require.Len(t, records, 2)
+	assert.Equal(t, auditKindBoard, records[0].TargetKind)
+	assert.Equal(t, KindPetition, records[1].TargetKind)
+	assert.Equal(t, second.ID, records[1].TargetID)
+	assert.Equal(t, records[0].RequestID, records[1].RequestID)
+
+	// Cards are only shown to users who may see their petitions.
+	w = doRequest(p, http.MethodGet, "/boards/"+board.ID, "user2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(view))
+	assert.Empty(t, view.Columns[0].Cards)
+	assert.Empty(t, view.Columns[2].Cards)
+	w = doRequest(p, http.MethodGet, "/boards", "user2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), second.ID)
+
+	columns := []*BoardColumn{{Name: "Later"}}
+	for _, column := range board.Columns {
+		columns = append(columns, &BoardColumn{ID: column.ID, Name: column.Name, Status: column.Status})
+	}
+	w = doRequest(p, http.MethodPut, "/boards/"+board.ID, "user1", map[string]interface{}{"columns": columns})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPut, "/boards/"+board.ID, "admin", map[string]interface{}{"columns": columns})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&board))
+	assert.Equal(t, []string{second.ID}, cardIDs(board.Columns[3].Cards))
+
+	view = move("admin", second.ID, board.Columns[0].ID, 0)
+	require.NotNil(t, view)
+	assert.Equal(t, []string{second.ID}, cardIDs(view.Columns[0].Cards))
+	assert.Empty(t, view.Columns[3].Cards)
+}
+
+func TestUndoTransition(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	petition := createTestPetition(t, p, "user1")
+	transition := func(status string) {
+		_, err := p.store.UpdatePetition(petition.ID, func(petition *Petition) error {
+			return petition.SetStatus(status)
+		})
+		require.NoError(t, err)
+	}
+
+	transition(StatusInProgress)
+	p.undoTransition(petition.ID, StatusPending, StatusInProgress)
+	current, err := p.store.GetPetition(petition.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, current.Status)
+	assert.Equal(t, petition.StatusHistory, current.StatusHistory)
+
+	// A transition made meanwhile by someone else is kept.
+	transition(StatusInProgress)
+	transition(StatusRejected)
+	p.undoTransition(petition.ID, StatusPending, StatusInProgress)
+	current, err = p.store.GetPetition(petition.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRejected, current.Status)
+	assert.Len(t, current.StatusHistory, len(petition.StatusHistory)+2)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	calendarTokenKeyPrefix = "calendar_token_"
+	calendarUserKeyPrefix  = "calendar_user_"
+)
+
+// CalendarToken describes a user's calendar feed token. The token itself is only returned when
+// it is generated; the store keeps its hash.
+type CalendarToken struct {
+	UserID    string `json:"user_id"`
+	TokenHash string `json:"-"`
+	Token     string `json:"token,omitempty"`
+	URL       string `json:"url,omitempty"`
+	CreateAt  int64  `json:"create_at"`
+}
+
+// calendarTokenRecord is the stored form of CalendarToken, whose hash is not exposed to clients.
+type calendarTokenRecord struct {
+	UserID    string `json:"user_id"`
+	TokenHash string `json:"token_hash"`
+	CreateAt  int64  `json:"create_at"`
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func calendarTokenKey(tokenHash string) string {
+	return calendarTokenKeyPrefix + tokenHash
+}
+
+func calendarUserKey(userID string) string {
+	return calendarUserKeyPrefix + userID
+}
+
+// GetCalendarToken describes userID's calendar feed token, without the token itself.
+func (s *Store) GetCalendarToken(userID string) (*CalendarToken, error) {
+	var record calendarTokenRecord
+	found, err := getJSON(s.kv, calendarUserKey(userID), &record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &CalendarToken{UserID: record.UserID, TokenHash: record.TokenHash, CreateAt: record.CreateAt}, nil
+}
+
+// CreateCalendarToken generates a calendar feed token for userID, revoking the previous one.
+func (s *Store) CreateCalendarToken(userID string) (*CalendarToken, error) {
+	token := model.NewId() + model.NewId()
+	record := &calendarTokenRecord{UserID: userID, TokenHash: hashCalendarToken(token), CreateAt: model.GetMillis()}
+	if err := setJSON(s.kv, calendarTokenKey(record.TokenHash), record); err != nil {
+		return nil, err
+	}
+	if err := s.RevokeCalendarToken(userID); err != nil {
+		return nil, err
+	}
+	if err := setJSON(s.kv, calendarUserKey(userID), record); err != nil {
+		return nil, err
+	}
+	return &CalendarToken{UserID: userID, TokenHash: record.TokenHash, Token: token, CreateAt: record.CreateAt}, nil
+}
+
+// RevokeCalendarToken revokes userID's calendar feed token, if any.
+func (s *Store) RevokeCalendarToken(userID string) error {
+	previous, err := s.GetCalendarToken(userID)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Delete(calendarTokenKey(previous.TokenHash)); err != nil {
+		return err
+	}
+	return s.kv.Delete(calendarUserKey(userID))
+}
+
+// ResolveCalendarToken returns the ID of the user owning token.
+func (s *Store) ResolveCalendarToken(token string) (string, error) {
+	var record calendarTokenRecord
+	found, err := getJSON(s.kv, calendarTokenKey(hashCalendarToken(token)), &record)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrNotFound
+	}
+	return record.UserID, nil
+}
+
+// calendarProductID identifies the plugin as the producer of calendar feeds.
+const calendarProductID = "-//Kien Nghi//Petitions//EN"
+
+// icsTimeLayout formats UTC times in iCalendar.
+const icsTimeLayout = "20060102T150405Z"
+
+// maxICSLineOctets is the length at which iCalendar content lines are folded.
+const maxICSLineOctets = 75
+
+func formatICSTime(millis int64) string {
+	return time.UnixMilli(millis).UTC().Format(icsTimeLayout)
+}
+
+// escapeICSText escapes a TEXT property value.
+func escapeICSText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(value)
+}
+
+// icsWriter renders iCalendar content lines, folding long lines without splitting characters.
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	// Continuation lines start with a space, which counts towards their length.
+	limit := maxICSLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = maxICSLineOctets - 1
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// CalendarEntry is an item shown in a calendar feed: an issue due date or a petition deadline.
+type CalendarEntry struct {
+	UID         string
+	Todo        bool
+	Summary     string
+	Description string
+	At          int64
+
+	// UpdateAt is the time the item last changed, if known.
+	UpdateAt int64
+}
+
+// calendarEntries returns the entries of userID's feed: the open issues with a due date in the
+// user's lists, and the SLA deadlines of the open petitions assigned to them, by date.
+func calendarEntries(userID string, issues []*Issue, petitions []*Petition, categories []*Category) []*CalendarEntry {
+	slas := map[string]*Category{}
+	for _, category := range categories {
+		slas[category.ID] = category
+	}
+
+	var entries []*CalendarEntry
+	for _, issue := range issues {
+		if issue.DueAt == 0 || issue.list(userID) == "" {
+			continue
+		}
+		entries = append(entries, &CalendarEntry{
+			UID:         "issue-" + issue.ID,
+			Todo:        true,
+			Summary:     issue.Message,
+			Description: issue.Description,
+			At:          issue.DueAt,
+		})
+	}
+	for _, petition := range petitions {
+		category, ok := slas[petition.CategoryID]
+		if !ok || !petition.IsOpen() || petition.AssigneeID != userID {
+			continue
+		}
+		deadline := category.Deadline(petition)
+		if deadline == 0 {
+			continue
+		}
+		entries = append(entries, &CalendarEntry{
+			UID:         "petition-" + petition.ID,
+			Summary:     fmt.Sprintf("Petition deadline: %s", petition.Title),
+			Description: petition.Content,
+			At:          deadline,
+			UpdateAt:    petition.UpdateAt,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At < entries[j].At })
+	return entries
+}
+
+// renderCalendar renders entries as an iCalendar document. Issues become VTODO components due at
+// their due date, and petition deadlines VEVENT components starting at the deadline.
+func renderCalendar(name string, entries []*CalendarEntry, now time.Time) string {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", calendarProductID)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", escapeICSText(name))
+	stamp := now.UTC().Format(icsTimeLayout)
+	for _, entry := range entries {
+		component := "VEVENT"
+		if entry.Todo {
+			component = "VTODO"
+		}
+		w.line("BEGIN", component)
+		w.line("UID", entry.UID+"@xlkn")
+		w.line("DTSTAMP", stamp)
+		if entry.UpdateAt != 0 {
+			w.line("LAST-MODIFIED", formatICSTime(entry.UpdateAt))
+		}
+		w.line("SUMMARY", escapeICSText(entry.Summary))
+		if entry.Description != "" {
+			w.line("DESCRIPTION", escapeICSText(entry.Description))
+		}
+		if entry.Todo {
+			w.line("DUE", formatICSTime(entry.At))
+			w.line("STATUS", "NEEDS-ACTION")
+		} else {
+			w.line("DTSTART", formatICSTime(entry.At))
+			w.line("DTEND", formatICSTime(entry.At))
+			w.line("TRANSP", "TRANSPARENT")
+		}
+		w.line("END", component)
+	}
+	w.line("END", "VCALENDAR")
+	return w.b.String()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCalendar(t *testing.T) {
+	due := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	calendar := renderCalendar("Todos", []*CalendarEntry{
+		{UID: "issue-1", Todo: true, Summary: "Call back; bring forms, stamps", At: due.UnixMilli()},
+		{UID: "petition-2", Summary: "Petition deadline: " + strings.Repeat("Đường hỏng ", 10), Description: "Line 1\nLine 2", At: due.UnixMilli()},
+	}, due)
+
+	lines := strings.Split(strings.TrimSuffix(calendar, "\r\n"), "\r\n")
+	for _, line := range lines {
+		assert.LessOrEqual(t, len(line), maxICSLineOctets)
+	}
+	assert.Equal(t, "BEGIN:VCALENDAR", lines[0])
+	assert.Equal(t, "END:VCALENDAR", lines[len(lines)-1])
+
+	unfolded := strings.ReplaceAll(calendar, "\r\n ", "")
+	assert.Contains(t, unfolded, "BEGIN:VTODO\r\nUID:issue-1@xlkn\r\n")
+	assert.Contains(t, unfolded, "SUMMARY:Call back\\; bring forms\\, stamps\r\n")
+	assert.Contains(t, unfolded, "DUE:20240301T093000Z\r\n")
+	assert.Contains(t, unfolded, "SUMMARY:Petition deadline: "+strings.Repeat("Đường hỏng ", 10)+"\r\n")
+	assert.Contains(t, unfolded, "DESCRIPTION:Line 1\\nLine 2\r\n")
+	assert.Contains(t, unfolded, "DTSTART:20240301T093000Z\r\n")
+}
+
+func TestCalendarFeed(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://chat.example.com/")}})
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "an"}, nil)
+
+	w := doRequest(p, http.MethodGet, "/calendar/token", "user1", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/add", "user1", map[string]interface{}{"message": "Renew permit", "due_at": 1709285400000})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodPost, "/add", "user1", map[string]interface{}{"message": "Someday"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	category, err := NewCategory("Roads", "", "")
+	require.NoError(t, err)
+	category.SLAHours = 48
+	require.NoError(t, p.store.SaveCategory(category))
+	petition := &Petition{ID: model.NewId(), Title: "Pothole", Priority: 2, CategoryID: category.ID, Status: StatusInProgress, CreatorID: "user2", AssigneeID: "user1", CreateAt: 1709200000000}
+	require.NoError(t, p.store.SavePetition(petition))
+
+	w = doRequest(p, http.MethodPost, "/calendar/token", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var token CalendarToken
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&token))
+	require.NotEmpty(t, token.Token)
+	assert.Equal(t, "https://chat.example.com/plugins/"+manifest.Id+"/calendar/"+token.Token+".ics", token.URL)
+
+	w = doRequest(p, http.MethodGet, "/calendar/token", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), token.Token)
+
+	w = doRequest(p, http.MethodGet, calendarFeedPath(token.Token), "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	feed := w.Body.String()
+	assert.Contains(t, feed, "SUMMARY:Renew permit\r\nDUE:20240301T093000Z\r\n")
+	assert.NotContains(t, feed, "Someday")
+	assert.Contains(t, feed, "SUMMARY:Petition deadline: Pothole\r\n")
+	assert.Contains(t, feed, "DTSTART:20240302T094640Z\r\n")
+
+	// Regenerating the token revokes the previous feed URL.
+	w = doRequest(p, http.MethodPost, "/calendar/token", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var regenerated CalendarToken
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&regenerated))
+	w = doRequest(p, http.MethodGet, calendarFeedPath(token.Token), "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(p, http.MethodGet, calendarFeedPath(regenerated.Token), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodDelete, "/calendar/token", "user1", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(p, http.MethodGet, calendarFeedPath(regenerated.Token), "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCalendarFeedOfDeactivatedUser(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetUser", mock.Anything).Return(&model.User{Id: "user1", DeleteAt: 1}, nil)
+
+	w := doRequest(p, http.MethodPost, "/calendar/token", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var token CalendarToken
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&token))
+	assert.Equal(t, "/plugins/"+manifest.Id+"/calendar/"+token.Token+".ics", token.URL)
+
+	w = doRequest(p, http.MethodGet, calendarFeedPath(token.Token), "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	categoryKeyPrefix = "category_"
+	categoryIndexKey  = "category_ids"
+)
+
+// Category groups petitions by subject and names the user who receives new petitions filed
+// under it.
+type Category struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	AssigneeID  string `json:"assignee_id,omitempty"`
+	CreateAt    int64  `json:"create_at"`
+
+	// SLAHours is the number of hours within which petitions filed under the category are due
+	// to be resolved. Zero sets no deadline.
+	SLAHours int `json:"sla_hours,omitempty"`
+}
+
+// Deadline returns the time by which petition is due to be resolved under the category's SLA,
+// or zero if the category sets none.
+func (c *Category) Deadline(petition *Petition) int64 {
+	if c.SLAHours <= 0 {
+		return 0
+	}
+	return petition.CreateAt + (time.Duration(c.SLAHours) * time.Hour).Milliseconds()
+}
+
+func categoryKey(id string) string {
+	return categoryKeyPrefix + id
+}
+
+// NewCategory returns a category with a freshly generated ID.
+func NewCategory(name, description, assigneeID string) (*Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, newBadRequestError("category name is required")
+	}
+
+	return &Category{
+		ID:          model.NewId(),
+		Name:        name,
+		Description: description,
+		AssigneeID:  assigneeID,
+		CreateAt:    model.GetMillis(),
+	}, nil
+}
+
+// SaveCategory stores a category.
+func (s *Store) SaveCategory(category *Category) error {
+	if err := setJSON(s.kv, categoryKey(category.ID), category); err != nil {
+		return err
+	}
+	if err := addToIndex(s.kv, categoryIndexKey, category.ID); err != nil {
+		return err
+	}
+	s.notifyChange(KindCategory, category.ID)
+	return nil
+}
+
+// GetCategory returns the category with the given ID.
+func (s *Store) GetCategory(id string) (*Category, error) {
+	var category Category
+	found, err := getJSON(s.kv, categoryKey(id), &category)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &category, nil
+}
+
+// GetCategories returns every category in creation order.
+func (s *Store) GetCategories() ([]*Category, error) {
+	ids, err := getIndex(s.kv, categoryIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := make([]*Category, 0, len(ids))
+	for _, id := range ids {
+		category, err := s.GetCategory(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
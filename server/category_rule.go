@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const categoryRulesKey = "category_rules"
+
+// Kinds of categorization rules.
+const (
+	// RuleKindKeywords fires when the text contains any of the rule's keywords, scoring one
+	// point per keyword found.
+	RuleKindKeywords = "keywords"
+
+	// RuleKindRegex fires when the rule's regular expression matches the text, scoring one point.
+	RuleKindRegex = "regex"
+
+	// RuleKindTerms sums the weights of the rule's terms found in the text, firing when the sum
+	// reaches the rule's threshold.
+	RuleKindTerms = "terms"
+)
+
+// Limits of categorization rules.
+const (
+	maxRuleTerms         = 100
+	maxRuleTermLength    = 100
+	maxRulePatternLength = 500
+)
+
+// CategoryRule suggests a category for petitions whose title or content it matches. Keywords
+// and terms are matched as whole words, ignoring case and accents; patterns are matched
+// case-insensitively against the text both as typed and with accents stripped.
+type CategoryRule struct {
+	ID         string             `json:"id"`
+	CategoryID string             `json:"category_id"`
+	Kind       string             `json:"kind"`
+	Keywords   []string           `json:"keywords,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	Terms      map[string]float64 `json:"terms,omitempty"`
+	Threshold  float64            `json:"threshold,omitempty"`
+
+	// AutoApply sets the category of new petitions the rule fires for, instead of only
+	// suggesting it.
+	AutoApply bool   `json:"auto_apply"`
+	CreatorID string `json:"creator_id"`
+	CreateAt  int64  `json:"create_at"`
+}
+
+// IsValid checks the fields supplied by clients.
+func (r *CategoryRule) IsValid() error {
+	if r.CategoryID == "" {
+		return newBadRequestError("category is required")
+	}
+	switch r.Kind {
+	case RuleKindKeywords:
+		if len(r.Keywords) == 0 || len(r.Keywords) > maxRuleTerms {
+			return newBadRequestError(fmt.Sprintf("a rule lists between 1 and %d keywords", maxRuleTerms))
+		}
+		for _, keyword := range r.Keywords {
+			if err := validateRuleTerm(keyword); err != nil {
+				return err
+			}
+		}
+	case RuleKindRegex:
+		if r.Pattern == "" || len(r.Pattern) > maxRulePatternLength {
+			return newBadRequestError(fmt.Sprintf("a pattern has between 1 and %d characters", maxRulePatternLength))
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return newBadRequestError("invalid pattern: " + err.Error())
+		}
+	case RuleKindTerms:
+		if len(r.Terms) == 0 || len(r.Terms) > maxRuleTerms {
+			return newBadRequestError(fmt.Sprintf("a rule lists between 1 and %d terms", maxRuleTerms))
+		}
+		for term, weight := range r.Terms {
+			if err := validateRuleTerm(term); err != nil {
+				return err
+			}
+			if math.IsNaN(weight) || math.IsInf(weight, 0) {
+				return newBadRequestError("invalid term weight")
+			}
+		}
+		if r.Threshold <= 0 || math.IsInf(r.Threshold, 0) {
+			return newBadRequestError("threshold must be positive")
+		}
+	default:
+		return newBadRequestError("invalid rule kind")
+	}
+	return nil
+}
+
+func validateRuleTerm(term string) error {
+	if len(tokenize(term)) == 0 || len(term) > maxRuleTermLength {
+		return newBadRequestError("invalid term")
+	}
+	return nil
+}
+
+// NewCategoryRule returns a rule with a freshly generated ID. Terms rules without a threshold
+// fire from a score of 1.
+func NewCategoryRule(rule CategoryRule, creatorID string) (*CategoryRule, error) {
+	rule.ID = model.NewId()
+	rule.CreatorID = creatorID
+	rule.CreateAt = model.GetMillis()
+	if rule.Kind == RuleKindTerms && rule.Threshold == 0 {
+		rule.Threshold = 1
+	}
+	if err := rule.IsValid(); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ruleText is the text of a petition prepared for matching rules.
+type ruleText struct {
+	raw    string
+	folded string
+
+	// words is the folded text as space-separated words, padded with spaces so that phrases
+	// are matched as whole words.
+	words string
+}
+
+func newRuleText(title, content string) *ruleText {
+	raw := title + "\n" + content
+	return &ruleText{
+		raw:    raw,
+		folded: foldText(raw),
+		words:  " " + strings.Join(tokenize(raw), " ") + " ",
+	}
+}
+
+// contains reports whether the text contains term as whole words.
+func (t *ruleText) contains(term string) bool {
+	words := tokenize(term)
+	return len(words) > 0 && strings.Contains(t.words, " "+strings.Join(words, " ")+" ")
+}
+
+// Match returns the rule's score for text and what matched, or a zero score if the rule does
+// not fire.
+func (r *CategoryRule) Match(text *ruleText) (float64, []string) {
+	var score float64
+	var matched []string
+	switch r.Kind {
+	case RuleKindKeywords:
+		for _, keyword := range r.Keywords {
+			if text.contains(keyword) {
+				score++
+				matched = append(matched, keyword)
+			}
+		}
+	case RuleKindRegex:
+		pattern, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return 0, nil
+		}
+		match := pattern.FindString(text.raw)
+		if match == "" {
+			match = pattern.FindString(text.folded)
+		}
+		if match != "" {
+			score = 1
+			matched = []string{match}
+		}
+	case RuleKindTerms:
+		terms := make([]string, 0, len(r.Terms))
+		for term := range r.Terms {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		for _, term := range terms {
+			if text.contains(term) {
+				score += r.Terms[term]
+				matched = append(matched, term)
+			}
+		}
+		if score < r.Threshold {
+			return 0, nil
+		}
+	}
+	return score, matched
+}
+
+// RuleMatch is a rule that fired for a text.
+type RuleMatch struct {
+	RuleID     string   `json:"rule_id"`
+	CategoryID string   `json:"category_id"`
+	Score      float64  `json:"score"`
+	Matched    []string `json:"matched"`
+	AutoApply  bool     `json:"auto_apply"`
+}
+
+// matchCategoryRules returns the rules firing for a petition's title and content, the best
+// first. Rules with equal scores keep their order.
+func matchCategoryRules(rules []*CategoryRule, title, content string) []*RuleMatch {
+	text := newRuleText(title, content)
+	matches := []*RuleMatch{}
+	for _, rule := range rules {
+		score, matched := rule.Match(text)
+		if score <= 0 {
+			continue
+		}
+		matches = append(matches, &RuleMatch{
+			RuleID:     rule.ID,
+			CategoryID: rule.CategoryID,
+			Score:      score,
+			Matched:    matched,
+			AutoApply:  rule.AutoApply,
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// CategorySuggestion records the category a rule suggested for a petition when it was filed,
+// and what became of the suggestion.
+type CategorySuggestion struct {
+	RuleID     string `json:"rule_id"`
+	CategoryID string `json:"category_id"`
+
+	// Applied is set when the rule set the petition's category.
+	Applied bool `json:"applied,omitempty"`
+
+	// Overridden is set when the submitter chose another category, or the category was
+	// changed after the rule set it.
+	Overridden bool `json:"overridden,omitempty"`
+}
+
+// GetCategoryRules returns every categorization rule in the order they are evaluated.
+func (s *Store) GetCategoryRules() ([]*CategoryRule, error) {
+	var rules []*CategoryRule
+	if _, err := getJSON(s.kv, categoryRulesKey, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// modifyCategoryRules atomically replaces the categorization rules with the result of fn. A
+// nil result leaves them untouched.
+func (s *Store) modifyCategoryRules(fn func([]*CategoryRule) ([]*CategoryRule, error)) error {
+	return modifyJSON(s.kv, categoryRulesKey, func(initial []byte) (interface{}, error) {
+		var rules []*CategoryRule
+		if initial != nil {
+			if err := json.Unmarshal(initial, &rules); err != nil {
+				return nil, errors.Wrap(err, "failed to decode category rules")
+			}
+		}
+		updated, err := fn(rules)
+		if updated == nil {
+			return nil, err
+		}
+		return updated, err
+	})
+}
+
+// AddCategoryRule appends a rule, which is evaluated after the existing ones.
+func (s *Store) AddCategoryRule(rule *CategoryRule) error {
+	return s.modifyCategoryRules(func(rules []*CategoryRule) ([]*CategoryRule, error) {
+		return append(rules, rule), nil
+	})
+}
+
+// DeleteCategoryRule removes the rule with the given ID and returns it.
+func (s *Store) DeleteCategoryRule(id string) (*CategoryRule, error) {
+	var deleted *CategoryRule
+	err := s.modifyCategoryRules(func(rules []*CategoryRule) ([]*CategoryRule, error) {
+		for i, rule := range rules {
+			if rule.ID == id {
+				deleted = rule
+				return append(rules[:i:i], rules[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// CategoryRuleStats counts what became of one rule's suggestions: Applied counts the categories
+// it set that were kept, Accepted the suggestions the submitter had already chosen, and
+// Overridden the suggestions replaced by another category.
+type CategoryRuleStats struct {
+	RuleID       string  `json:"rule_id"`
+	Suggested    int     `json:"suggested"`
+	Applied      int     `json:"applied"`
+	Accepted     int     `json:"accepted"`
+	Overridden   int     `json:"overridden"`
+	OverrideRate float64 `json:"override_rate"`
+}
+
+// categoryRuleStats counts the suggestions recorded on petitions, per rule. Rules that were
+// deleted keep their statistics while petitions refer to them.
+func categoryRuleStats(rules []*CategoryRule, petitions []*Petition) []*CategoryRuleStats {
+	byRule := map[string]*CategoryRuleStats{}
+	stats := []*CategoryRuleStats{}
+	get := func(ruleID string) *CategoryRuleStats {
+		if byRule[ruleID] == nil {
+			byRule[ruleID] = &CategoryRuleStats{RuleID: ruleID}
+			stats = append(stats, byRule[ruleID])
+		}
+		return byRule[ruleID]
+	}
+	for _, rule := range rules {
+		get(rule.ID)
+	}
+	for _, petition := range petitions {
+		suggestion := petition.CategorySuggestion
+		if suggestion == nil {
+			continue
+		}
+		s := get(suggestion.RuleID)
+		s.Suggested++
+		switch {
+		case suggestion.Overridden:
+			s.Overridden++
+		case suggestion.Applied:
+			s.Applied++
+		default:
+			s.Accepted++
+		}
+	}
+	for _, s := range stats {
+		if s.Suggested > 0 {
+			s.OverrideRate = math.Round(float64(s.Overridden)/float64(s.Suggested)*1000) / 1000
+		}
+	}
+	return stats
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategoryRuleMatch(t *testing.T) {
+	text := newRuleText("Ổ gà trên đường Lê Lợi", "Xe máy bị ngã vì ổ gà")
+
+	keywords := &CategoryRule{Kind: RuleKindKeywords, Keywords: []string{"o ga", "đèn", "Lê Lợi"}}
+	score, matched := keywords.Match(text)
+	assert.Equal(t, 2.0, score)
+	assert.Equal(t, []string{"o ga", "Lê Lợi"}, matched)
+
+	// Keywords match whole words only.
+	score, _ = (&CategoryRule{Kind: RuleKindKeywords, Keywords: []string{"ga tr"}}).Match(text)
+	assert.Zero(t, score)
+
+	regex := &CategoryRule{Kind: RuleKindRegex, Pattern: `duong (le loi|nguyen hue)`}
+	score, matched = regex.Match(text)
+	assert.Equal(t, 1.0, score)
+	assert.Equal(t, []string{"duong le loi"}, matched)
+
+	terms := &CategoryRule{Kind: RuleKindTerms, Terms: map[string]float64{"ổ gà": 1.5, "xe máy": 0.5, "nước": 2}, Threshold: 2}
+	score, matched = terms.Match(text)
+	assert.Equal(t, 2.0, score)
+	assert.Equal(t, []string{"xe máy", "ổ gà"}, matched)
+	terms.Threshold = 3
+	score, _ = terms.Match(text)
+	assert.Zero(t, score)
+}
+
+func TestCategoryRuleIsValid(t *testing.T) {
+	_, err := NewCategoryRule(CategoryRule{CategoryID: "roads", Kind: RuleKindRegex, Pattern: "("}, "admin")
+	assert.Error(t, err)
+	_, err = NewCategoryRule(CategoryRule{CategoryID: "roads", Kind: RuleKindKeywords, Keywords: []string{"!!"}}, "admin")
+	assert.Error(t, err)
+	_, err = NewCategoryRule(CategoryRule{CategoryID: "roads", Kind: "magic"}, "admin")
+	assert.Error(t, err)
+
+	rule, err := NewCategoryRule(CategoryRule{CategoryID: "roads", Kind: RuleKindTerms, Terms: map[string]float64{"road": 1}}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, rule.Threshold)
+}
+
+func TestCategoryRules(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+
+	roads, err := NewCategory("Roads", "", "")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(roads))
+	lighting, err := NewCategory("Lighting", "", "")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(lighting))
+
+	createRule := func(rule map[string]interface{}) *CategoryRule {
+		w := doRequest(p, http.MethodPost, "/category-rules", "admin", rule)
+		require.Equal(t, http.StatusOK, w.Code)
+		var created CategoryRule
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+		return &created
+	}
+	w := doRequest(p, http.MethodPost, "/category-rules", "user1", map[string]interface{}{"category_id": roads.ID, "kind": RuleKindKeywords, "keywords": []string{"pothole"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPost, "/category-rules", "admin", map[string]interface{}{"category_id": "missing", "kind": RuleKindKeywords, "keywords": []string{"pothole"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	roadRule := createRule(map[string]interface{}{"category_id": roads.ID, "kind": RuleKindKeywords, "keywords": []string{"pothole", "ổ gà"}, "auto_apply": true})
+	lightRule := createRule(map[string]interface{}{"category_id": lighting.ID, "kind": RuleKindTerms, "terms": map[string]float64{"street light": 2, "dark": 1}})
+
+	w = doRequest(p, http.MethodPost, "/category-rules/test", "admin", map[string]string{"title": "Dark street light", "content": "Next to a pothole"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var test CategoryRuleTest
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&test))
+	require.Len(t, test.Matches, 2)
+	assert.Equal(t, lightRule.ID, test.Suggestion.RuleID)
+	assert.Equal(t, 3.0, test.Suggestion.Score)
+	assert.Equal(t, roadRule.ID, test.Matches[1].RuleID)
+
+	w = doRequest(p, http.MethodPost, "/requests/category-suggestion", "user1", map[string]string{"title": "O ga"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var suggestion CategorySuggestionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&suggestion))
+	assert.Equal(t, CategorySuggestionResponse{CategoryID: roads.ID, AutoApply: true}, suggestion)
+
+	create := func(title, categoryID string) *Petition {
+		w := doRequest(p, http.MethodPost, "/requests", "user1", map[string]interface{}{"title": title, "priority": 2, "category_id": categoryID})
+		require.Equal(t, http.StatusOK, w.Code)
+		var petition Petition
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&petition))
+		return &petition
+	}
+
+	// Auto-applied rules set the category, even when none was chosen.
+	applied := create("Pothole on Main street", "")
+	assert.Equal(t, roads.ID, applied.CategoryID)
+	assert.Equal(t, &CategorySuggestion{RuleID: roadRule.ID, CategoryID: roads.ID, Applied: true}, applied.CategorySuggestion)
+	create("Another pothole", lighting.ID)
+
+	// Suggestions only record whether the submitter followed them.
+	overridden := create("Dark street light", roads.ID)
+	assert.Equal(t, roads.ID, overridden.CategoryID)
+	assert.True(t, overridden.CategorySuggestion.Overridden)
+	create("Broken street light", lighting.ID)
+	unmatched := create("Noise at night", roads.ID)
+	assert.Nil(t, unmatched.CategorySuggestion)
+
+	// Moving a petition out of the category set by a rule overrides it.
+	w = doRequest(p, http.MethodPut, "/requests/"+applied.ID, "admin", map[string]interface{}{"category_id": lighting.ID})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/category-rules/stats", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats []*CategoryRuleStats
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Equal(t, []*CategoryRuleStats{
+		{RuleID: roadRule.ID, Suggested: 2, Applied: 1, Overridden: 1, OverrideRate: 0.5},
+		{RuleID: lightRule.ID, Suggested: 2, Accepted: 1, Overridden: 1, OverrideRate: 0.5},
+	}, stats)
+
+	w = doRequest(p, http.MethodDelete, "/category-rules/"+roadRule.ID, "admin", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(p, http.MethodDelete, "/category-rules/"+roadRule.ID, "admin", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	rules, err := p.store.GetCategoryRules()
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelIssues(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	members := map[string]bool{"user1": true, "user2": true}
+	api.On("GetChannelMember", "channel1", mock.Anything).Return(func(_, userID string) *model.ChannelMember {
+		return &model.ChannelMember{ChannelId: "channel1", UserId: userID}
+	}, func(_, userID string) *model.AppError {
+		if !members[userID] {
+			return model.NewAppError("GetChannelMember", "not_found", nil, "", http.StatusNotFound)
+		}
+		return nil
+	})
+	refreshes := 0
+	api.On("PublishWebSocketEvent", channelRefreshEvent, map[string]interface{}{"channel_id": "channel1"}, &model.WebsocketBroadcast{ChannelId: "channel1"}).Run(func(mock.Arguments) {
+		refreshes++
+	})
+
+	base := "/channels/channel1/issues"
+	w := doRequest(p, http.MethodPost, base, "user1", map[string]string{"message": "Book the room"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var issue Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&issue))
+	assert.Equal(t, "channel1", issue.ChannelID)
+	assert.Empty(t, issue.AssigneeID)
+	assert.Equal(t, 1, refreshes)
+
+	w = doRequest(p, http.MethodGet, base, "user3", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Shared issues stay out of personal lists and routes.
+	w = doRequest(p, http.MethodGet, "/list?list=out", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var personal []*Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&personal))
+	assert.Empty(t, personal)
+	w = doRequest(p, http.MethodPost, "/remove", "user1", map[string]string{"id": issue.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/claim", "user2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/claim", "user1", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	for _, path := range []string{"/accept", "/complete"} {
+		w = doRequest(p, http.MethodPost, path, "user2", map[string]string{"id": issue.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+	w = doRequest(p, http.MethodPost, "/change_assignment", "user1", map[string]string{"id": issue.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/subtasks", "user2", map[string]interface{}{"title": "Check calendar", "required": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	var subtask Subtask
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&subtask))
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/complete", "user1", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/subtasks/"+subtask.ID+"/toggle", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Members who left the channel lose access.
+	members["user2"] = false
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/complete", "user2", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPost, base+"/"+issue.ID+"/complete", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodGet, base, "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var open []*Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&open))
+	assert.Empty(t, open)
+	w = doRequest(p, http.MethodGet, base+"?state=completed", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var completed []*Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&completed))
+	require.Len(t, completed, 1)
+	assert.Equal(t, "user2", completed[0].AssigneeID)
+	assert.Equal(t, 100, completed[0].Completion)
+
+	w = doRequest(p, http.MethodDelete, base+"/"+issue.ID, "user1", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 6, refreshes)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// ErrSubtasksOpen is returned when completing an issue or petition whose required subtasks are
+// still open.
+var ErrSubtasksOpen = errors.New("required subtasks are still open")
+
+// Subtask is a single entry of the ordered checklist held by an issue or a petition.
+type Subtask struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	AssigneeID string `json:"assignee_id,omitempty"`
+	Required   bool   `json:"required"`
+	Done       bool   `json:"done"`
+	DoneAt     int64  `json:"done_at,omitempty"`
+	DoneBy     string `json:"done_by,omitempty"`
+	CreateAt   int64  `json:"create_at"`
+}
+
+// Checklist is an ordered list of subtasks.
+type Checklist []*Subtask
+
+// Completion returns the percentage of subtasks that are done, rounded down. An empty checklist
+// reports zero.
+func (c Checklist) Completion() int {
+	if len(c) == 0 {
+		return 0
+	}
+
+	done := 0
+	for _, s := range c {
+		if s.Done {
+			done++
+		}
+	}
+	return done * 100 / len(c)
+}
+
+// OpenRequired returns the number of required subtasks that are not done yet.
+func (c Checklist) OpenRequired() int {
+	open := 0
+	for _, s := range c {
+		if s.Required && !s.Done {
+			open++
+		}
+	}
+	return open
+}
+
+// Add appends a new subtask to the checklist and returns it.
+func (c *Checklist) Add(title, assigneeID string, required bool) (*Subtask, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, newBadRequestError("subtask title is required")
+	}
+
+	subtask := &Subtask{
+		ID:         model.NewId(),
+		Title:      title,
+		AssigneeID: assigneeID,
+		Required:   required,
+		CreateAt:   model.GetMillis(),
+	}
+	*c = append(*c, subtask)
+	return subtask, nil
+}
+
+// Toggle flips the done flag of the subtask with the given ID.
+func (c Checklist) Toggle(subtaskID, userID string) (*Subtask, error) {
+	for _, s := range c {
+		if s.ID != subtaskID {
+			continue
+		}
+
+		s.Done = !s.Done
+		if s.Done {
+			s.DoneAt = model.GetMillis()
+			s.DoneBy = userID
+		} else {
+			s.DoneAt = 0
+			s.DoneBy = ""
+		}
+		return s, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Remove deletes the subtask with the given ID.
+func (c *Checklist) Remove(subtaskID string) error {
+	for i, s := range *c {
+		if s.ID == subtaskID {
+			*c = append((*c)[:i], (*c)[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Reorder rearranges the checklist to follow order, which must name every subtask exactly once.
+func (c *Checklist) Reorder(order []string) error {
+	if len(order) != len(*c) {
+		return newBadRequestError("order must list every subtask exactly once")
+	}
+
+	byID := make(map[string]*Subtask, len(*c))
+	for _, s := range *c {
+		byID[s.ID] = s
+	}
+
+	reordered := make(Checklist, 0, len(order))
+	for _, id := range order {
+		s, ok := byID[id]
+		if !ok {
+			return newBadRequestError("order must list every subtask exactly once")
+		}
+		delete(byID, id)
+		reordered = append(reordered, s)
+	}
+
+	*c = reordered
+	return nil
+}
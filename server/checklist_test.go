@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecklist(t *testing.T) {
+	var c Checklist
+	assert.Equal(t, 0, c.Completion())
+
+	first, err := c.Add("Collect documents", "", true)
+	require.NoError(t, err)
+	second, err := c.Add("Call citizen", "user1", false)
+	require.NoError(t, err)
+	_, err = c.Add("  ", "", false)
+	assert.Error(t, err)
+
+	assert.Equal(t, 0, c.Completion())
+	assert.Equal(t, 1, c.OpenRequired())
+
+	toggled, err := c.Toggle(first.ID, "user1")
+	require.NoError(t, err)
+	assert.True(t, toggled.Done)
+	assert.Equal(t, "user1", toggled.DoneBy)
+	assert.Equal(t, 50, c.Completion())
+	assert.Equal(t, 0, c.OpenRequired())
+
+	_, err = c.Toggle("missing", "user1")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, c.Reorder([]string{second.ID, first.ID}))
+	assert.Equal(t, second.ID, c[0].ID)
+	assert.Error(t, c.Reorder([]string{second.ID}))
+	assert.Error(t, c.Reorder([]string{second.ID, second.ID}))
+
+	require.NoError(t, c.Remove(second.ID))
+	assert.Len(t, c, 1)
+	assert.Equal(t, 100, c.Completion())
+	assert.Equal(t, ErrNotFound, c.Remove(second.ID))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// clusterEventChange announces a record written through one cluster node to the others.
+const clusterEventChange = "record_changed"
+
+// clusterChange is the payload of clusterEventChange.
+type clusterChange struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
+// broadcastChange is a store change listener that publishes every write to the other cluster
+// nodes, so that they keep their in-memory search indexes and statistics current.
+func (p *Plugin) broadcastChange(kind, id string) {
+	data, err := json.Marshal(&clusterChange{Kind: kind, ID: id})
+	if err != nil {
+		p.API.LogWarn("Failed to encode cluster event", "error", err.Error())
+		return
+	}
+	if err := p.API.PublishPluginClusterEvent(
+		model.PluginClusterEvent{Id: clusterEventChange, Data: data},
+		model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable},
+	); err != nil {
+		p.API.LogWarn("Failed to publish cluster event", "error", err.Error())
+	}
+}
+
+// OnPluginClusterEvent applies the writes made through other cluster nodes to this node's
+// search index and statistics.
+func (p *Plugin) OnPluginClusterEvent(c *plugin.Context, ev model.PluginClusterEvent) {
+	if ev.Id != clusterEventChange {
+		return
+	}
+	var change clusterChange
+	if err := json.Unmarshal(ev.Data, &change); err != nil {
+		p.API.LogWarn("Failed to decode cluster event", "error", err.Error())
+		return
+	}
+	p.search.handleChange(change.Kind, change.ID)
+	p.stats.handleChange(change.Kind, change.ID)
+}
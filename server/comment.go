@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const commentsKeyPrefix = "comments_"
+
+// mentionPattern matches @username mentions in comment markdown.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([a-z0-9._-]+)`)
+
+// Comment is a markdown message attached to a petition.
+type Comment struct {
+	ID         string   `json:"id"`
+	PetitionID string   `json:"petition_id"`
+	UserID     string   `json:"user_id"`
+	Message    string   `json:"message"`
+	Mentions   []string `json:"mentions,omitempty"`
+	CreateAt   int64    `json:"create_at"`
+	UpdateAt   int64    `json:"update_at"`
+}
+
+func commentsKey(petitionID string) string {
+	return commentsKeyPrefix + petitionID
+}
+
+// parseMentions returns the distinct usernames mentioned in message, in order of appearance.
+func parseMentions(message string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(strings.ToLower(message), -1) {
+		username := strings.TrimRight(match[1], ".")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// NewComment returns a comment by userID on the given petition.
+func NewComment(petitionID, userID, message string) (*Comment, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, newBadRequestError("comment message is required")
+	}
+
+	now := model.GetMillis()
+	return &Comment{
+		ID:         model.NewId(),
+		PetitionID: petitionID,
+		UserID:     userID,
+		Message:    message,
+		CreateAt:   now,
+		UpdateAt:   now,
+	}, nil
+}
+
+// GetComments returns the comments on a petition, oldest first.
+func (s *Store) GetComments(petitionID string) ([]*Comment, error) {
+	var comments []*Comment
+	if _, err := getJSON(s.kv, commentsKey(petitionID), &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// SaveComment appends a comment to its petition.
+func (s *Store) SaveComment(comment *Comment) error {
+	return s.modifyComments(comment.PetitionID, func(comments []*Comment) ([]*Comment, error) {
+		return append(comments, comment), nil
+	})
+}
+
+// UpdateComment atomically applies fn to the given comment and returns the result.
+func (s *Store) UpdateComment(petitionID, commentID string, fn func(*Comment) error) (*Comment, error) {
+	var updated *Comment
+	err := s.modifyComments(petitionID, func(comments []*Comment) ([]*Comment, error) {
+		for _, comment := range comments {
+			if comment.ID != commentID {
+				continue
+			}
+			if err := fn(comment); err != nil {
+				return nil, err
+			}
+			comment.UpdateAt = model.GetMillis()
+			updated = comment
+			return comments, nil
+		}
+		return nil, ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteComment removes the given comment if check accepts it.
+func (s *Store) DeleteComment(petitionID, commentID string, check func(*Comment) error) error {
+	return s.modifyComments(petitionID, func(comments []*Comment) ([]*Comment, error) {
+		for i, comment := range comments {
+			if comment.ID != commentID {
+				continue
+			}
+			if err := check(comment); err != nil {
+				return nil, err
+			}
+			return append(comments[:i], comments[i+1:]...), nil
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// DeleteComments removes every comment on a petition.
+func (s *Store) DeleteComments(petitionID string) error {
+	if err := s.kv.Delete(commentsKey(petitionID)); err != nil {
+		return err
+	}
+	s.notifyChange(KindPetition, petitionID)
+	return nil
+}
+
+func (s *Store) modifyComments(petitionID string, fn func([]*Comment) ([]*Comment, error)) error {
+	err := modifyJSON(s.kv, commentsKey(petitionID), func(initial []byte) (interface{}, error) {
+		var comments []*Comment
+		if initial != nil {
+			if err := json.Unmarshal(initial, &comments); err != nil {
+				return nil, errors.Wrap(err, "failed to decode comments")
+			}
+		}
+		return fn(comments)
+	})
+	if err != nil {
+		return err
+	}
+	s.notifyChange(KindPetition, petitionID)
+	return nil
+}
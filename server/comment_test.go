@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob.smith"}, parseMentions("@Alice please ask @bob.smith. Thanks @alice"))
+	assert.Empty(t, parseMentions("mail me at someone@example.com"))
+	assert.Equal(t, []string{"an"}, parseMentions("**@an**"))
+}
+
+func TestComments(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	petition := createTestPetition(t, p, "user1")
+
+	api.On("GetUser", mock.Anything).Return(func(userID string) *model.User {
+		return &model.User{Id: userID, Username: "name-" + userID}
+	}, nil)
+	api.On("GetUserByUsername", "user3").Return(&model.User{Id: "user3", Username: "user3"}, nil)
+	api.On("GetUserByUsername", "user4").Return(&model.User{Id: "user4", Username: "user4"}, nil)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(false)
+	editor, err := NewRoleAssignment(RoleEditor, "user3", "", "", "admin")
+	require.NoError(t, err)
+	_, err = p.store.AddRoleAssignment(editor)
+	require.NoError(t, err)
+	api.On("GetUserByUsername", "ghost").Return(nil, model.NewAppError("", "", nil, "", http.StatusNotFound))
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(func(userID, _ string) *model.Channel {
+		return &model.Channel{Id: "dm-" + userID}
+	}, nil)
+	var notified []string
+	api.On("CreatePost", mock.Anything).Run(func(args mock.Arguments) {
+		notified = append(notified, args.Get(0).(*model.Post).ChannelId)
+	}).Return(&model.Post{}, nil)
+
+	w := doRequest(p, http.MethodPost, "/requests/forward/"+petition.ID, "user1", map[string]string{
+		"assignee_id": "user2",
+		"action":      "Xử lý",
+		"message":     "Please check with @user3, @user4 and @ghost",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	// user4 may not see the petition, so the mention does not notify them.
+	assert.ElementsMatch(t, []string{"dm-user2", "dm-user3"}, notified)
+
+	notified = nil
+	w = doRequest(p, http.MethodPost, "/requests/"+petition.ID+"/comments", "user2", map[string]string{"message": "On it"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var comment Comment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&comment))
+	assert.Equal(t, []string{"dm-user1"}, notified)
+
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID+"/comments/"+comment.ID, "user1", map[string]string{"message": "Hijack"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	notified = nil
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID+"/comments/"+comment.ID, "user2", map[string]string{"message": "Done, @user3 and @user4"})
+	require.Equal(t, http.StatusOK, w.Code)
+	// Mentions added by an edit do not reach users who may not see the petition either.
+	assert.Equal(t, []string{"dm-user3"}, notified)
+
+	w = doRequest(p, http.MethodGet, "/requests/"+petition.ID+"/timeline", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var timeline []*TimelineEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&timeline))
+	require.Len(t, timeline, 3)
+	assert.Equal(t, TimelineProcess, timeline[0].Type)
+	assert.Equal(t, TimelineComment, timeline[1].Type)
+	assert.Equal(t, "Done, @user3 and @user4", timeline[2].Comment.Message)
+
+	w = doRequest(p, http.MethodDelete, "/requests/"+petition.ID+"/comments/"+comment.ID, "user2", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests/"+petition.ID+"/comments", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var comments []*Comment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&comments))
+	assert.Len(t, comments, 1)
+}
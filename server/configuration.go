@@ -2,6 +2,9 @@ package main
 
 import (
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +21,60 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// MaxAttachmentSize is the largest petition attachment accepted, in megabytes.
+	MaxAttachmentSize int
+
+	// AllowedAttachmentTypes is a comma-separated list of MIME types accepted for petition
+	// attachments. A type may end in "/*" to allow a whole family, e.g. "image/*". An empty list
+	// allows every type.
+	AllowedAttachmentTypes string
+
+	// MetricsToken, when set, lets Prometheus scrape the metrics route by sending it in the
+	// X-Metrics-Token header or the token query parameter.
+	MetricsToken string
+
+	// RateLimitPerMinute is the number of requests a user may send to each route per minute. Zero
+	// disables rate limiting.
+	RateLimitPerMinute int
+
+	// RateLimitBurst is the number of requests a user may send to a route at once. Zero allows
+	// a minute's worth of requests.
+	RateLimitBurst int
+
+	// RateLimitOverrides is a comma-separated list of per-route limits replacing
+	// RateLimitPerMinute, e.g. "GET /list=300,/requests=30". A route is its path template,
+	// optionally preceded by a method.
+	RateLimitOverrides string
+
+	// IncomingWebhookToken is the token external forms send in the X-Webhook-Token header to
+	// submit petitions. The incoming webhook is disabled while it is empty.
+	IncomingWebhookToken string
+
+	// IncomingWebhookCategoryID is the category of the petitions submitted through the incoming
+	// webhook.
+	IncomingWebhookCategoryID string
+
+	// IncomingWebhookBotUsername names the bot account filing submitted petitions. The plugin's
+	// bot files them when it is empty.
+	IncomingWebhookBotUsername string
+
+	// EnableEmailNotifications emails petition events to users, according to their preferences,
+	// through the server's mail settings.
+	EnableEmailNotifications bool
+
+	// EmailBatchMinutes is how long email notifications wait for further events to be sent in the
+	// same email.
+	EmailBatchMinutes int
+
+	// TopicsURL is the address of the hot-topics crawler's topic list. Topics are not fetched
+	// while it is empty, and the last fetched list keeps being served.
+	TopicsURL string
+
+	// HotTopicID is the ID of the topic highlighted as the hot topic.
+	HotTopicID string
+
+	// TopicsRefreshMinutes is how often the topics are fetched from the crawler.
+	TopicsRefreshMinutes int
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -27,6 +84,124 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// defaultMaxAttachmentSize is the attachment size limit, in megabytes, used when none is
+// configured.
+const defaultMaxAttachmentSize = 10
+
+// EmailBatchWindow returns how long email notifications wait for further events.
+func (c *configuration) EmailBatchWindow() time.Duration {
+	if c.EmailBatchMinutes <= 0 {
+		return 0
+	}
+	return time.Duration(c.EmailBatchMinutes) * time.Minute
+}
+
+// defaultTopicsRefreshMinutes is the topic refresh interval, in minutes, used when none is
+// configured.
+const defaultTopicsRefreshMinutes = 60
+
+// TopicsRefreshInterval returns how often the topics are fetched from the crawler.
+func (c *configuration) TopicsRefreshInterval() time.Duration {
+	minutes := c.TopicsRefreshMinutes
+	if minutes <= 0 {
+		minutes = defaultTopicsRefreshMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// MaxAttachmentBytes returns the configured attachment size limit in bytes.
+func (c *configuration) MaxAttachmentBytes() int64 {
+	size := c.MaxAttachmentSize
+	if size <= 0 {
+		size = defaultMaxAttachmentSize
+	}
+	return int64(size) * 1024 * 1024
+}
+
+// IsAllowedAttachmentType reports whether attachments of the given MIME type are accepted.
+func (c *configuration) IsAllowedAttachmentType(mimeType string) bool {
+	if strings.TrimSpace(c.AllowedAttachmentTypes) == "" {
+		return true
+	}
+
+	mimeType = strings.ToLower(mimeType)
+	for _, allowed := range strings.Split(c.AllowedAttachmentTypes, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == mimeType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid reports the first setting holding an unusable value.
+func (c *configuration) IsValid() error {
+	if c.MaxAttachmentSize < 0 {
+		return errors.New("MaxAttachmentSize must not be negative")
+	}
+	for _, allowed := range strings.Split(c.AllowedAttachmentTypes, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "" {
+			continue
+		}
+		if parts := strings.Split(allowed, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("AllowedAttachmentTypes contains an invalid MIME type %q", allowed)
+		}
+	}
+	if c.RateLimitPerMinute < 0 || c.RateLimitBurst < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	if _, err := c.rateLimitOverrides(); err != nil {
+		return err
+	}
+	if c.IncomingWebhookToken != "" && c.IncomingWebhookCategoryID == "" {
+		return errors.New("IncomingWebhookCategoryID is required when the incoming webhook is enabled")
+	}
+	return nil
+}
+
+// rateLimitOverrides parses RateLimitOverrides into limits keyed by route, with or without a
+// method.
+func (c *configuration) rateLimitOverrides() (map[string]int, error) {
+	overrides := map[string]int{}
+	for _, entry := range strings.Split(c.RateLimitOverrides, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		perMinute, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || err != nil || perMinute < 0 {
+			return nil, errors.Errorf("RateLimitOverrides contains an invalid entry %q", entry)
+		}
+		overrides[strings.Join(strings.Fields(route), " ")] = perMinute
+	}
+	return overrides, nil
+}
+
+// RateLimit returns the number of requests per minute and the burst a user may send to the route
+// with the given method and path template. A zero limit means the route is not limited.
+func (c *configuration) RateLimit(method, route string) (perMinute, burst int) {
+	perMinute = c.RateLimitPerMinute
+	if overrides, err := c.rateLimitOverrides(); err == nil {
+		if limit, ok := overrides[route]; ok {
+			perMinute = limit
+		}
+		if limit, ok := overrides[method+" "+route]; ok {
+			perMinute = limit
+		}
+	}
+
+	burst = c.RateLimitBurst
+	if burst == 0 {
+		burst = perMinute
+	}
+	return perMinute, burst
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
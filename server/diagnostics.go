@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Build metadata of the server binary, set at link time by the Makefile from the same values as
+// the manifest version.
+var (
+	buildVersion = "dev"
+	buildHash    = "unknown"
+)
+
+// kvProbeKey is read to check that the key-value store is reachable. It is never written.
+const kvProbeKey = "health_probe"
+
+// JobRun describes a run of a background job.
+type JobRun struct {
+	Job      string `json:"job"`
+	StartAt  int64  `json:"start_at"`
+	EndAt    int64  `json:"end_at,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// jobTracker records the runs of the plugin's background jobs on this node, for diagnostics
+// and metrics.
+type jobTracker struct {
+	metrics *metrics
+
+	mu      sync.Mutex
+	running map[*JobRun]bool
+	last    map[string]*JobRun
+}
+
+func newJobTracker(m *metrics) *jobTracker {
+	return &jobTracker{metrics: m, running: map[*JobRun]bool{}, last: map[string]*JobRun{}}
+}
+
+// Start records the start of a run of job. The returned function records its end and whether
+// it failed.
+func (t *jobTracker) Start(job string) func(err error) {
+	start := time.Now()
+	run := &JobRun{Job: job, StartAt: model.GetMillisForTime(start)}
+	t.mu.Lock()
+	t.running[run] = true
+	t.mu.Unlock()
+
+	return func(err error) {
+		elapsed := time.Since(start)
+		t.metrics.ObserveJob(job, elapsed)
+
+		finished := *run
+		finished.EndAt = finished.StartAt + elapsed.Milliseconds()
+		finished.Duration = elapsed.Milliseconds()
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.running, run)
+		t.last[job] = &finished
+	}
+}
+
+// Running returns the runs in progress, oldest first.
+func (t *jobTracker) Running() []*JobRun {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	runs := make([]*JobRun, 0, len(t.running))
+	for run := range t.running {
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartAt < runs[j].StartAt })
+	return runs
+}
+
+// LastRuns returns the last finished run of each job.
+func (t *jobTracker) LastRuns() map[string]*JobRun {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	runs := make(map[string]*JobRun, len(t.last))
+	for job, run := range t.last {
+		copied := *run
+		runs[job] = &copied
+	}
+	return runs
+}
+
+// Ping checks that the key-value store answers.
+func (s *Store) Ping() error {
+	_, err := s.kv.Get(kvProbeKey)
+	return err
+}
+
+// CountRecords returns the number of stored records of each type.
+func (s *Store) CountRecords() (map[string]int, error) {
+	counts := map[string]int{}
+	for name, indexKey := range map[string]string{
+		"petitions":  petitionIndexKey,
+		"categories": categoryIndexKey,
+		"boards":     boardIndexKey,
+	} {
+		ids, err := getIndex(s.kv, indexKey)
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = len(ids)
+	}
+
+	keys, err := s.listKeysWithPrefix(issueKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	counts["issues"] = len(keys)
+
+	assignments, err := s.GetRoleAssignments()
+	if err != nil {
+		return nil, err
+	}
+	counts["role_assignments"] = len(assignments)
+
+	seq, err := s.LastAuditSeq()
+	if err != nil {
+		return nil, err
+	}
+	counts["audit_records"] = int(seq)
+	return counts, nil
+}
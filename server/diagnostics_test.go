@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationIsValid(t *testing.T) {
+	assert.NoError(t, (&configuration{}).IsValid())
+	assert.NoError(t, (&configuration{MaxAttachmentSize: 5, AllowedAttachmentTypes: "image/*, application/pdf"}).IsValid())
+	assert.Error(t, (&configuration{MaxAttachmentSize: -1}).IsValid())
+	assert.Error(t, (&configuration{AllowedAttachmentTypes: "image/*,pdf"}).IsValid())
+}
+
+func TestJobTracker(t *testing.T) {
+	tracker := newJobTracker(newMetrics())
+
+	finish := tracker.Start("import")
+	require.Len(t, tracker.Running(), 1)
+	assert.Equal(t, "import", tracker.Running()[0].Job)
+	finish(errors.New("boom"))
+
+	assert.Empty(t, tracker.Running())
+	last := tracker.LastRuns()["import"]
+	require.NotNil(t, last)
+	assert.Equal(t, "boom", last.Error)
+	assert.GreaterOrEqual(t, last.EndAt, last.StartAt)
+}
+
+func TestHealthAndDiagnostics(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	createTestPetition(t, p, "user1")
+
+	w := doRequest(p, http.MethodGet, "/health", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var health Health
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&health))
+	assert.Equal(t, healthStatusOK, health.Status)
+	assert.Equal(t, buildVersion, health.Version)
+	assert.True(t, health.Checks["kv_store"].OK)
+
+	p.setConfiguration(&configuration{AllowedAttachmentTypes: "pdf"})
+	w = doRequest(p, http.MethodGet, "/health", "user1", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	w = doRequest(p, http.MethodGet, "/diagnostics", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	p.jobs.Start("import")(nil)
+	w = doRequest(p, http.MethodGet, "/diagnostics", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var diagnostics Diagnostics
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&diagnostics))
+	assert.Equal(t, healthStatusDegraded, diagnostics.Status)
+	assert.False(t, diagnostics.Checks["configuration"].OK)
+	assert.Equal(t, 1, diagnostics.Records["petitions"])
+	assert.Equal(t, 1, diagnostics.Records["categories"])
+	assert.Contains(t, diagnostics.Jobs.LastRuns, "import")
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	_ "embed" // Embeds the dossier fonts.
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gorilla/mux"
+)
+
+// The DejaVu Sans fonts cover the full Vietnamese alphabet and are embedded into generated PDFs,
+// so no font needs to be installed on the server.
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	dossierFontRegular []byte
+
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	dossierFontBold []byte
+)
+
+const (
+	dossierFont        = "DejaVu"
+	dossierLineHeight  = 6
+	dossierLabelWidth  = 45
+	dossierHeadingSize = 13
+	dossierBodySize    = 10
+)
+
+// dossier renders a single petition to PDF.
+type dossier struct {
+	pdf *fpdf.Fpdf
+	e   *exporter
+}
+
+func newDossier(e *exporter) *dossier {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(dossierFont, "", dossierFontRegular)
+	pdf.AddUTF8FontFromBytes(dossierFont, "B", dossierFontBold)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont(dossierFont, "", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	return &dossier{pdf: pdf, e: e}
+}
+
+func (d *dossier) heading(text string) {
+	d.pdf.Ln(4)
+	d.pdf.SetFont(dossierFont, "B", dossierHeadingSize)
+	d.pdf.CellFormat(0, 8, text, "B", 1, "L", false, 0, "")
+	d.pdf.Ln(2)
+	d.pdf.SetFont(dossierFont, "", dossierBodySize)
+}
+
+func (d *dossier) field(label, value string) {
+	d.pdf.SetFont(dossierFont, "B", dossierBodySize)
+	d.pdf.CellFormat(dossierLabelWidth, dossierLineHeight, label, "", 0, "L", false, 0, "")
+	d.pdf.SetFont(dossierFont, "", dossierBodySize)
+	d.pdf.MultiCell(0, dossierLineHeight, value, "", "L", false)
+}
+
+func (d *dossier) paragraph(text string) {
+	d.pdf.SetFont(dossierFont, "", dossierBodySize)
+	d.pdf.MultiCell(0, dossierLineHeight, text, "", "L", false)
+}
+
+func (d *dossier) empty() {
+	d.pdf.SetFont(dossierFont, "", dossierBodySize)
+	d.pdf.CellFormat(0, dossierLineHeight, "—", "", 1, "L", false, 0, "")
+}
+
+// table writes a bordered table whose columns have the given widths in millimeters.
+func (d *dossier) table(widths []float64, headers []string, rows [][]string) {
+	d.pdf.SetFont(dossierFont, "B", dossierBodySize)
+	for i, header := range headers {
+		d.pdf.CellFormat(widths[i], dossierLineHeight+1, header, "1", 0, "L", false, 0, "")
+	}
+	d.pdf.Ln(-1)
+
+	d.pdf.SetFont(dossierFont, "", dossierBodySize)
+	for _, row := range rows {
+		lines := 1
+		for i, value := range row {
+			if n := len(d.pdf.SplitText(value, widths[i]-2)); n > lines {
+				lines = n
+			}
+		}
+		height := float64(lines) * dossierLineHeight
+		_, pageHeight := d.pdf.GetPageSize()
+		_, _, _, bottomMargin := d.pdf.GetMargins()
+		if d.pdf.GetY()+height > pageHeight-bottomMargin {
+			d.pdf.AddPage()
+		}
+
+		left, top := d.pdf.GetX(), d.pdf.GetY()
+		x := left
+		for i, value := range row {
+			d.pdf.Rect(x, top, widths[i], height, "D")
+			d.pdf.SetXY(x, top)
+			d.pdf.MultiCell(widths[i], dossierLineHeight, value, "", "L", false)
+			x += widths[i]
+		}
+		d.pdf.SetXY(left, top+height)
+	}
+}
+
+// formatSize returns a human readable file size.
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return strconv.FormatInt(size, 10) + " B"
+}
+
+// render writes the petition, its forwarding chain, comments and attachment list.
+func (d *dossier) render(petition *Petition, comments []*Comment, attachments []*Attachment) {
+	e := d.e
+	d.pdf.AddPage()
+
+	d.pdf.SetFont(dossierFont, "B", 16)
+	d.pdf.MultiCell(0, 8, petition.Title, "", "L", false)
+	d.pdf.Ln(2)
+
+	d.heading("Details")
+	d.field("ID", petition.ID)
+	d.field("Status", petition.Status)
+	d.field("Priority", strconv.Itoa(petition.Priority))
+	d.field("Category", e.categoryName(petition.CategoryID))
+	d.field("Filed by", e.username(petition.CreatorID))
+	d.field("Assignee", e.username(petition.AssigneeID))
+	d.field("Created", e.formatTime(petition.CreateAt))
+	d.field("Updated", e.formatTime(petition.UpdateAt))
+	if len(petition.Subtasks) > 0 {
+		d.field("Completion", strconv.Itoa(petition.Completion)+"%")
+	}
+
+	d.heading("Content")
+	if petition.Content == "" {
+		d.empty()
+	} else {
+		d.paragraph(petition.Content)
+	}
+
+	if len(petition.Subtasks) > 0 {
+		d.heading("Checklist")
+		rows := make([][]string, 0, len(petition.Subtasks))
+		for _, subtask := range petition.Subtasks {
+			done := ""
+			if subtask.Done {
+				done = "✓ " + e.formatTime(subtask.DoneAt)
+			}
+			rows = append(rows, []string{subtask.Title, e.username(subtask.AssigneeID), done})
+		}
+		d.table([]float64{100, 40, 40}, []string{"Subtask", "Assignee", "Done"}, rows)
+	}
+
+	d.heading("Forwarding chain")
+	if len(petition.Processes) == 0 {
+		d.empty()
+	} else {
+		rows := make([][]string, 0, len(petition.Processes))
+		for i, process := range petition.Processes {
+			rows = append(rows, []string{
+				strconv.Itoa(i + 1),
+				e.username(process.ActorID),
+				e.username(process.UserID),
+				process.Action,
+				e.formatTime(process.CreateAt),
+			})
+		}
+		d.table([]float64{10, 40, 40, 50, 40}, []string{"#", "From", "To", "Action", "Date"}, rows)
+	}
+
+	d.heading("Comments")
+	if len(comments) == 0 {
+		d.empty()
+	}
+	for _, comment := range comments {
+		d.pdf.SetFont(dossierFont, "B", dossierBodySize)
+		d.pdf.CellFormat(0, dossierLineHeight, e.username(comment.UserID)+" — "+e.formatTime(comment.CreateAt), "", 1, "L", false, 0, "")
+		d.paragraph(comment.Message)
+		d.pdf.Ln(2)
+	}
+
+	d.heading("Attachments")
+	if len(attachments) == 0 {
+		d.empty()
+	} else {
+		rows := make([][]string, 0, len(attachments))
+		for _, attachment := range attachments {
+			rows = append(rows, []string{
+				attachment.Name,
+				attachment.MimeType,
+				formatSize(attachment.Size),
+				e.username(attachment.UserID),
+				e.formatTime(attachment.CreateAt),
+			})
+		}
+		d.table([]float64{60, 35, 20, 30, 35}, []string{"Name", "Type", "Size", "Uploaded by", "Date"}, rows)
+	}
+}
+
+func (p *Plugin) handlePetitionDossier(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	petition, err := p.getVisiblePetition(userID, mux.Vars(r)["id"])
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	location := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		if location, err = time.LoadLocation(tz); err != nil {
+			p.handleError(w, newBadRequestError("unknown time zone"))
+			return
+		}
+	}
+
+	comments, err := p.store.GetComments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	attachments, err := p.store.GetAttachments(petition.ID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	e, err := p.newExporter(location)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	d := newDossier(e)
+	d.render(petition, comments, attachments)
+	if err := d.pdf.Error(); err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "petition-"+petition.ID+".pdf"))
+	if err := d.pdf.Output(w); err != nil {
+		p.API.LogError("Failed to write petition dossier", "error", err.Error())
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "2.0 MB", formatSize(2*1024*1024))
+}
+
+func TestPetitionDossier(t *testing.T) {
+	p := setupExportTest(t)
+	p.API.(*plugintest.API).On("HasPermissionTo", "user3", model.PermissionManageSystem).Return(false)
+
+	petition, err := p.store.GetPetition("p1")
+	require.NoError(t, err)
+	petition.Content = strings.Repeat("Mặt đường bị sụt lún nghiêm trọng. ", 200)
+	petition.Subtasks = []*Subtask{{ID: "s1", Title: "Khảo sát hiện trường", Done: true, DoneAt: 1704074400000}}
+	require.NoError(t, p.store.SavePetition(petition))
+	require.NoError(t, p.store.SaveComment(&Comment{ID: "c1", PetitionID: "p1", UserID: "user2", Message: "Đã tiếp nhận", CreateAt: 1704072600000}))
+
+	w := doRequest(p, http.MethodGet, "/requests/p1/pdf?tz=Asia/Ho_Chi_Minh", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "petition-p1.pdf")
+	assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF"))
+
+	w = doRequest(p, http.MethodGet, "/requests/p1/pdf?tz=Nowhere/Special", "user1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests/p1/pdf", "user3", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
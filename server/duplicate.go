@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// duplicateShingleSize is the number of consecutive words in each shingle compared.
+	duplicateShingleSize = 2
+
+	// duplicateThreshold is the similarity from which a petition is reported as a likely
+	// duplicate.
+	duplicateThreshold = 0.3
+
+	// maxDuplicates bounds the number of likely duplicates reported.
+	maxDuplicates = 5
+)
+
+// DuplicateCandidate is an open petition likely to duplicate another. Only what a submitter
+// needs to recognize the petition is exposed.
+type DuplicateCandidate struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Status     string  `json:"status"`
+	CreateAt   int64   `json:"create_at"`
+	Similarity float64 `json:"similarity"`
+}
+
+// shingles returns the set of runs of size consecutive tokens. Texts shorter than size form a
+// single shingle.
+func shingles(tokens []string, size int) map[string]bool {
+	set := map[string]bool{}
+	if len(tokens) == 0 {
+		return set
+	}
+	if len(tokens) < size {
+		set[strings.Join(tokens, " ")] = true
+		return set
+	}
+	for i := 0; i+size <= len(tokens); i++ {
+		set[strings.Join(tokens[i:i+size], " ")] = true
+	}
+	return set
+}
+
+// jaccard returns the Jaccard similarity of two sets.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for shingle := range a {
+		if b[shingle] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// petitionShingles returns the shingles of a petition's title and content, folded so that
+// accents and case do not matter.
+func petitionShingles(title, content string) map[string]bool {
+	return shingles(tokenize(title+" "+content), duplicateShingleSize)
+}
+
+// petitionSimilarity returns the similarity of the texts of two petitions, between 0 and 1.
+func petitionSimilarity(a, b *Petition) float64 {
+	return jaccard(petitionShingles(a.Title, a.Content), petitionShingles(b.Title, b.Content))
+}
+
+// isDuplicateCandidate reports whether other is an open petition in the same category as
+// petition, so that it may duplicate it.
+func isDuplicateCandidate(petition, other *Petition) bool {
+	return other.ID != petition.ID && other.CategoryID == petition.CategoryID && other.IsOpen()
+}
+
+// findDuplicates returns the open petitions among others in petition's category whose text is
+// similar to it, most similar first.
+func findDuplicates(petition *Petition, others []*Petition) []*DuplicateCandidate {
+	shingled := petitionShingles(petition.Title, petition.Content)
+	duplicates := []*DuplicateCandidate{}
+	for _, other := range others {
+		if !isDuplicateCandidate(petition, other) {
+			continue
+		}
+		similarity := jaccard(shingled, petitionShingles(other.Title, other.Content))
+		if similarity < duplicateThreshold {
+			continue
+		}
+		duplicates = append(duplicates, &DuplicateCandidate{
+			ID:         other.ID,
+			Title:      other.Title,
+			Status:     other.Status,
+			CreateAt:   other.CreateAt,
+			Similarity: math.Round(similarity*1000) / 1000,
+		})
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		if duplicates[i].Similarity != duplicates[j].Similarity {
+			return duplicates[i].Similarity > duplicates[j].Similarity
+		}
+		return duplicates[i].CreateAt < duplicates[j].CreateAt
+	})
+	if len(duplicates) > maxDuplicates {
+		duplicates = duplicates[:maxDuplicates]
+	}
+	return duplicates
+}
+
+// Link records that the petition relates to otherID.
+func (p *Petition) Link(otherID string) {
+	if !containsString(p.LinkedIDs, otherID) {
+		p.LinkedIDs = append(p.LinkedIDs, otherID)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPetitionSimilarity(t *testing.T) {
+	a := &Petition{Title: "Ổ gà trên đường Lê Lợi", Content: "Đường Lê Lợi có nhiều ổ gà nguy hiểm"}
+	b := &Petition{Title: "O ga tren duong Le Loi", Content: "duong le loi co nhieu o ga nguy hiem"}
+	assert.Equal(t, 1.0, petitionSimilarity(a, b))
+
+	c := &Petition{Title: "Đèn đường bị hỏng", Content: "Khu phố 3 mất điện chiếu sáng"}
+	assert.Less(t, petitionSimilarity(a, c), duplicateThreshold)
+
+	assert.Equal(t, map[string]bool{"pothole": true}, shingles([]string{"pothole"}, 2))
+	assert.Equal(t, 0.0, jaccard(map[string]bool{}, map[string]bool{"a": true}))
+}
+
+func TestFindDuplicates(t *testing.T) {
+	petition := &Petition{ID: "new", CategoryID: "roads", Title: "Pothole on Main street"}
+	others := []*Petition{
+		{ID: "same", CategoryID: "roads", Status: StatusPending, Title: "Pothole on Main street", CreateAt: 2},
+		{ID: "close", CategoryID: "roads", Status: StatusInProgress, Title: "Big pothole on Main street", CreateAt: 1},
+		{ID: "closed", CategoryID: "roads", Status: StatusResolved, Title: "Pothole on Main street"},
+		{ID: "other", CategoryID: "water", Status: StatusPending, Title: "Pothole on Main street"},
+		{ID: "unrelated", CategoryID: "roads", Status: StatusPending, Title: "Broken street light"},
+		{ID: "new", CategoryID: "roads", Status: StatusPending, Title: "Pothole on Main street"},
+	}
+	duplicates := findDuplicates(petition, others)
+	require.Len(t, duplicates, 2)
+	assert.Equal(t, "same", duplicates[0].ID)
+	assert.Equal(t, 1.0, duplicates[0].Similarity)
+	assert.Equal(t, "close", duplicates[1].ID)
+	assert.Equal(t, 0.75, duplicates[1].Similarity)
+}
+
+func TestDuplicatePetitions(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(false)
+	api.On("GetUser", mock.Anything).Return(func(userID string) *model.User {
+		return &model.User{Id: userID, Username: userID}
+	}, nil)
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	editor, err := NewRoleAssignment(RoleEditor, "user3", "", "", "admin")
+	require.NoError(t, err)
+	_, err = p.store.AddRoleAssignment(editor)
+	require.NoError(t, err)
+
+	original := createTestPetition(t, p, "user1")
+
+	// Checking before filing creates nothing, and only reports petitions the user may see.
+	check := map[string]interface{}{
+		"title":       "Pothole",
+		"content":     "Main street",
+		"category_id": original.CategoryID,
+	}
+	w := doRequest(p, http.MethodPost, "/requests/duplicates", "user3", check)
+	require.Equal(t, http.StatusOK, w.Code)
+	var candidates []*DuplicateCandidate
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&candidates))
+	require.Len(t, candidates, 1)
+	assert.Equal(t, original.ID, candidates[0].ID)
+	w = doRequest(p, http.MethodPost, "/requests/duplicates", "user2", check)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&candidates))
+	assert.Empty(t, candidates)
+
+	w = doRequest(p, http.MethodPost, "/requests", "user2", map[string]interface{}{
+		"title":       "Pothole",
+		"content":     "Main street",
+		"priority":    3,
+		"category_id": original.CategoryID,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var created createPetitionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Empty(t, created.Duplicates)
+	duplicate := created.Petition
+
+	// Unrelated petitions the submitter cannot see are out of reach.
+	w = doRequest(p, http.MethodPost, "/requests", "user1", map[string]interface{}{
+		"title":       "Broken street light",
+		"priority":    3,
+		"category_id": original.CategoryID,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var unrelated createPetitionResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&unrelated))
+	assert.Empty(t, unrelated.Duplicates)
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/link", "user2", map[string]string{"target_id": unrelated.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/link", "user4", map[string]string{"target_id": original.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	// However similar, petitions the submitter cannot see are out of reach too.
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/link", "user2", map[string]string{"target_id": original.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/merge", "user2", map[string]string{"target_id": original.ID})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/link", "user3", map[string]string{"target_id": original.ID})
+	require.Equal(t, http.StatusOK, w.Code)
+	linked, err := p.store.GetPetition(original.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{duplicate.ID}, linked.LinkedIDs)
+
+	// Merging into a closed petition leaves the petition as it was.
+	closed := createTestPetition(t, p, "user1")
+	_, err = p.store.UpdatePetition(closed.ID, func(petition *Petition) error {
+		petition.enterStatus(StatusResolved)
+		return nil
+	})
+	require.NoError(t, err)
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/merge", "user3", map[string]string{"target_id": closed.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	unmerged, err := p.store.GetPetition(duplicate.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, unmerged.Status)
+	assert.Empty(t, unmerged.MergedIntoID)
+	assert.Equal(t, []string{original.ID}, unmerged.LinkedIDs)
+	assert.Len(t, unmerged.StatusHistory, len(duplicate.StatusHistory))
+
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/merge", "user3", map[string]string{"target_id": original.ID})
+	require.Equal(t, http.StatusOK, w.Code)
+	var merged Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&merged))
+	assert.Equal(t, StatusRejected, merged.Status)
+	assert.Equal(t, original.ID, merged.MergedIntoID)
+	assert.Equal(t, []string{original.ID}, merged.LinkedIDs)
+
+	// The submitter of the merged petition follows the target from now on.
+	target, err := p.store.GetPetition(original.ID)
+	require.NoError(t, err)
+	assert.Contains(t, target.Watchers, "user2")
+	assert.Equal(t, []string{duplicate.ID}, target.LinkedIDs)
+	comments, err := p.store.GetComments(original.ID)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].Message, "Main street")
+
+	// Both petitions changed by the merge are audited.
+	records, _ := queryAudit(t, p, "?action=petition.merge")
+	var audited []string
+	for _, record := range records {
+		audited = append(audited, record.TargetID)
+	}
+	assert.ElementsMatch(t, []string{duplicate.ID, original.ID}, audited)
+
+	// A merged petition is closed and can no longer be merged.
+	w = doRequest(p, http.MethodPost, "/requests/"+duplicate.ID+"/merge", "user3", map[string]string{"target_id": original.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
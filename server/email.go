@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	emailPreferencesKeyPrefix = "email_prefs_"
+	emailBatchKeyPrefix       = "email_batch_"
+	emailBatchIndexKey        = "email_batch_users"
+)
+
+// Petition events users may receive email notifications about.
+const (
+	EmailEventAssigned  = "assigned"
+	EmailEventForwarded = "forwarded"
+	EmailEventEscalated = "escalated"
+	EmailEventResolved  = "resolved"
+)
+
+// emailEvents lists the email notification events in the order they are presented.
+var emailEvents = []string{EmailEventAssigned, EmailEventForwarded, EmailEventEscalated, EmailEventResolved}
+
+func isValidEmailEvent(event string) bool {
+	for _, known := range emailEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// EmailPreferences records, by event, whether a user receives email notifications. Events
+// missing from the map are enabled.
+type EmailPreferences map[string]bool
+
+// Enabled reports whether the user receives email notifications about event.
+func (prefs EmailPreferences) Enabled(event string) bool {
+	enabled, ok := prefs[event]
+	return !ok || enabled
+}
+
+func emailPreferencesKey(userID string) string {
+	return emailPreferencesKeyPrefix + userID
+}
+
+// GetEmailPreferences returns userID's email preferences, listing every event.
+func (s *Store) GetEmailPreferences(userID string) (EmailPreferences, error) {
+	var stored EmailPreferences
+	if _, err := getJSON(s.kv, emailPreferencesKey(userID), &stored); err != nil {
+		return nil, err
+	}
+	prefs := EmailPreferences{}
+	for _, event := range emailEvents {
+		prefs[event] = stored.Enabled(event)
+	}
+	return prefs, nil
+}
+
+// UpdateEmailPreferences applies changes to userID's email preferences and returns them. Unknown
+// events are rejected.
+func (s *Store) UpdateEmailPreferences(userID string, changes EmailPreferences) (EmailPreferences, error) {
+	for event := range changes {
+		if !isValidEmailEvent(event) {
+			return nil, newBadRequestError(fmt.Sprintf("unknown email event %s", event))
+		}
+	}
+	err := modifyJSON(s.kv, emailPreferencesKey(userID), func(initial []byte) (interface{}, error) {
+		prefs := EmailPreferences{}
+		if initial != nil {
+			if err := json.Unmarshal(initial, &prefs); err != nil {
+				return nil, errors.Wrap(err, "failed to decode email preferences")
+			}
+		}
+		for event, enabled := range changes {
+			prefs[event] = enabled
+		}
+		return prefs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEmailPreferences(userID)
+}
+
+// EmailNotification is a petition event waiting to be emailed.
+type EmailNotification struct {
+	Event         string `json:"event"`
+	PetitionID    string `json:"petition_id"`
+	PetitionTitle string `json:"petition_title"`
+	Priority      int    `json:"priority,omitempty"`
+	ActorID       string `json:"actor_id"`
+	CreateAt      int64  `json:"create_at"`
+}
+
+// EmailBatch collects the notifications of a user sent together in one email, once the batch
+// window following the first of them has passed.
+type EmailBatch struct {
+	UserID        string               `json:"user_id"`
+	Notifications []*EmailNotification `json:"notifications"`
+	Failures      int                  `json:"failures,omitempty"`
+	CreateAt      int64                `json:"create_at"`
+
+	// LeaseUntil is the time until which a node sending the batch holds it, and after a failure
+	// the time of the next attempt.
+	LeaseUntil int64 `json:"lease_until,omitempty"`
+}
+
+func emailBatchKey(userID string) string {
+	return emailBatchKeyPrefix + userID
+}
+
+// QueueEmailNotification adds notification to userID's pending batch.
+func (s *Store) QueueEmailNotification(userID string, notification *EmailNotification) error {
+	err := modifyJSON(s.kv, emailBatchKey(userID), func(initial []byte) (interface{}, error) {
+		batch := EmailBatch{UserID: userID, CreateAt: notification.CreateAt}
+		if initial != nil {
+			if err := json.Unmarshal(initial, &batch); err != nil {
+				return nil, errors.Wrap(err, "failed to decode email batch")
+			}
+		}
+		if len(batch.Notifications) == 0 {
+			batch.CreateAt = notification.CreateAt
+		}
+		batch.Notifications = append(batch.Notifications, notification)
+		return &batch, nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := addToIndex(s.kv, emailBatchIndexKey, userID); err != nil {
+		return errors.Wrap(err, "failed to index email batch")
+	}
+	return nil
+}
+
+// GetEmailBatchUsers returns the IDs of the users with pending email batches.
+func (s *Store) GetEmailBatchUsers() ([]string, error) {
+	return getIndex(s.kv, emailBatchIndexKey)
+}
+
+// UpdateEmailBatch atomically applies fn to userID's pending batch and returns the result.
+func (s *Store) UpdateEmailBatch(userID string, fn func(*EmailBatch) error) (*EmailBatch, error) {
+	var updated *EmailBatch
+	err := modifyJSON(s.kv, emailBatchKey(userID), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var batch EmailBatch
+		if err := json.Unmarshal(initial, &batch); err != nil {
+			return nil, errors.Wrap(err, "failed to decode email batch")
+		}
+		if err := fn(&batch); err != nil {
+			return nil, err
+		}
+		updated = &batch
+		return &batch, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// RemoveEmptyEmailBatch deletes userID's batch if it holds no notifications. The user leaves the
+// index first, and returns to it if a notification arrived meanwhile, so that no batch goes
+// unnoticed.
+func (s *Store) RemoveEmptyEmailBatch(userID string) error {
+	data, err := s.kv.Get(emailBatchKey(userID))
+	if err != nil || data == nil {
+		return err
+	}
+	var batch EmailBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return errors.Wrap(err, "failed to decode email batch")
+	}
+	if len(batch.Notifications) > 0 {
+		return nil
+	}
+
+	if err := removeFromIndex(s.kv, emailBatchIndexKey, userID); err != nil {
+		return errors.Wrap(err, "failed to unindex email batch")
+	}
+	ok, err := s.kv.CompareAndSet(emailBatchKey(userID), data, nil)
+	if err == nil && !ok {
+		err = addToIndex(s.kv, emailBatchIndexKey, userID)
+	}
+	return err
+}
+
+// defaultEmailLocale is the locale of emails sent to users whose locale has no translation.
+const defaultEmailLocale = "en"
+
+// emailStrings holds the translation of the emails into a locale. Event messages are formats
+// receiving the actor's name, the petition title and, for escalations, the new priority.
+type emailStrings struct {
+	Subject       string
+	SubjectBatch  string
+	Heading       string
+	Footer        string
+	EventMessages map[string]string
+}
+
+// emailTranslations maps locales to the translation of the emails.
+var emailTranslations = map[string]*emailStrings{
+	"en": {
+		Subject:      "[Petitions] %s",
+		SubjectBatch: "[Petitions] %d updates on your petitions",
+		Heading:      "Updates on your petitions",
+		Footer:       "You receive these emails according to your email notification preferences in Mattermost.",
+		EventMessages: map[string]string{
+			EmailEventAssigned:  "%s assigned you the petition “%s”.",
+			EmailEventForwarded: "%s forwarded the petition “%s” to you.",
+			EmailEventEscalated: "%s raised the priority of the petition “%s” to %d.",
+			EmailEventResolved:  "%s resolved the petition “%s”.",
+		},
+	},
+	"vi": {
+		Subject:      "[Kiến nghị] %s",
+		SubjectBatch: "[Kiến nghị] %d cập nhật về kiến nghị của bạn",
+		Heading:      "Cập nhật về kiến nghị của bạn",
+		Footer:       "Bạn nhận được email này theo cài đặt thông báo email của bạn trong Mattermost.",
+		EventMessages: map[string]string{
+			EmailEventAssigned:  "%s đã giao cho bạn kiến nghị “%s”.",
+			EmailEventForwarded: "%s đã chuyển kiến nghị “%s” cho bạn.",
+			EmailEventEscalated: "%s đã nâng mức ưu tiên của kiến nghị “%s” lên %d.",
+			EmailEventResolved:  "%s đã giải quyết kiến nghị “%s”.",
+		},
+	},
+}
+
+// emailTranslation returns the translation for locale, falling back to its base language and
+// then to the default locale.
+func emailTranslation(locale string) *emailStrings {
+	locale = strings.ToLower(locale)
+	if translation, ok := emailTranslations[locale]; ok {
+		return translation
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if translation, ok := emailTranslations[base]; ok {
+			return translation
+		}
+	}
+	return emailTranslations[defaultEmailLocale]
+}
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<body style="font-family: sans-serif; color: #3d3c40;">
+<h2 style="font-size: 18px;">{{.Heading}}</h2>
+<ul>
+{{- range .Messages}}
+<li style="margin-bottom: 8px;">{{.}}</li>
+{{- end}}
+</ul>
+<p style="font-size: 12px; color: #8a8a8a;">{{.Footer}}</p>
+</body>
+</html>
+`))
+
+// renderEmail returns the subject and HTML body of the email sending notifications in locale.
+// actorName resolves the names of the users who triggered the notifications.
+func renderEmail(locale string, notifications []*EmailNotification, actorName func(userID string) string) (string, string, error) {
+	translation := emailTranslation(locale)
+	messages := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		format, ok := translation.EventMessages[notification.Event]
+		if !ok {
+			continue
+		}
+		args := []interface{}{actorName(notification.ActorID), notification.PetitionTitle}
+		if notification.Event == EmailEventEscalated {
+			args = append(args, notification.Priority)
+		}
+		messages = append(messages, fmt.Sprintf(format, args...))
+	}
+	if len(messages) == 0 {
+		return "", "", errors.New("no notification to send")
+	}
+
+	subject := fmt.Sprintf(translation.SubjectBatch, len(messages))
+	if len(messages) == 1 {
+		subject = fmt.Sprintf(translation.Subject, messages[0])
+	}
+	var body bytes.Buffer
+	err := emailTemplate.Execute(&body, map[string]interface{}{
+		"Locale":   locale,
+		"Heading":  translation.Heading,
+		"Messages": messages,
+		"Footer":   translation.Footer,
+	})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to render email")
+	}
+	return subject, body.String(), nil
+}
+
+// newEmailNotification returns the notification of event about petition, triggered by actorID.
+func newEmailNotification(event string, petition *Petition, actorID string) *EmailNotification {
+	return &EmailNotification{
+		Event:         event,
+		PetitionID:    petition.ID,
+		PetitionTitle: petition.Title,
+		Priority:      petition.Priority,
+		ActorID:       actorID,
+		CreateAt:      model.GetMillis(),
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// emailQueue names the email job and its queue in metrics and diagnostics.
+const emailQueue = "email"
+
+const (
+	// emailPollInterval is how often pending batches are checked for their window passing.
+	emailPollInterval = 30 * time.Second
+
+	// emailLease is how long a node sending a batch holds it.
+	emailLease = time.Minute
+
+	// emailRetryDelay is the delay before retrying a batch that could not be sent.
+	emailRetryDelay = 5 * time.Minute
+
+	// emailMaxFailures is the number of failed attempts after which a batch is dropped.
+	emailMaxFailures = 5
+)
+
+// errBatchNotDue is returned by batch updates to skip batches whose window has not passed or
+// that another node is sending.
+var errBatchNotDue = errors.New("batch is not due")
+
+// emailDispatcher emails the pending notification batches through the server's mail settings.
+// Batches are persisted in the key-value store and every cluster node may send them: a node
+// leases a batch before sending it.
+type emailDispatcher struct {
+	store   *Store
+	api     plugin.API
+	metrics *metrics
+	jobs    *jobTracker
+	now     func() time.Time
+
+	// window returns how long notifications wait for others to be sent with them.
+	window func() time.Duration
+}
+
+func newEmailDispatcher(store *Store, api plugin.API, m *metrics, jobs *jobTracker, window func() time.Duration) *emailDispatcher {
+	return &emailDispatcher{
+		store:   store,
+		api:     api,
+		metrics: m,
+		jobs:    jobs,
+		now:     time.Now,
+		window:  window,
+	}
+}
+
+// Run sends the batches coming due until stop is closed.
+func (d *emailDispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+	for {
+		d.ProcessDue()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue sends every batch whose window has passed and that no other node is sending.
+func (d *emailDispatcher) ProcessDue() {
+	userIDs, err := d.store.GetEmailBatchUsers()
+	if err != nil {
+		d.api.LogError("Failed to load email batches", "error", err.Error())
+		return
+	}
+	d.metrics.SetQueueSize(emailQueue, len(userIDs))
+	if len(userIDs) == 0 {
+		return
+	}
+
+	var failure error
+	finish := d.jobs.Start(emailQueue)
+	defer func() { finish(failure) }()
+	for _, userID := range userIDs {
+		if err := d.flush(userID); err != nil {
+			d.api.LogError("Failed to send email notifications", "user_id", userID, "error", err.Error())
+			failure = err
+		}
+	}
+	if userIDs, err := d.store.GetEmailBatchUsers(); err == nil {
+		d.metrics.SetQueueSize(emailQueue, len(userIDs))
+	}
+}
+
+// flush leases userID's batch if it is due, emails its notifications and removes them from the
+// batch, keeping those queued meanwhile for the next email.
+func (d *emailDispatcher) flush(userID string) error {
+	now := model.GetMillisForTime(d.now())
+	batch, err := d.store.UpdateEmailBatch(userID, func(batch *EmailBatch) error {
+		if len(batch.Notifications) > 0 && (batch.CreateAt+d.window().Milliseconds() > now || batch.LeaseUntil > now) {
+			return errBatchNotDue
+		}
+		batch.LeaseUntil = now + emailLease.Milliseconds()
+		return nil
+	})
+	if err == errBatchNotDue {
+		return nil
+	}
+	if err == ErrNotFound {
+		return d.store.RemoveEmptyEmailBatch(userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	sent := len(batch.Notifications)
+	sendErr := d.send(batch)
+	_, err = d.store.UpdateEmailBatch(userID, func(current *EmailBatch) error {
+		if sendErr != nil && current.Failures+1 < emailMaxFailures {
+			current.Failures++
+			current.LeaseUntil = model.GetMillisForTime(d.now()) + emailRetryDelay.Milliseconds()
+			return nil
+		}
+		current.Notifications = current.Notifications[sent:]
+		current.Failures = 0
+		current.LeaseUntil = 0
+		if len(current.Notifications) > 0 {
+			current.CreateAt = current.Notifications[0].CreateAt
+		}
+		return nil
+	})
+	if err == nil {
+		err = d.store.RemoveEmptyEmailBatch(userID)
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// send emails the notifications of batch in the recipient's locale. Users without an email
+// address, or who were deleted, are skipped.
+func (d *emailDispatcher) send(batch *EmailBatch) error {
+	if len(batch.Notifications) == 0 {
+		return nil
+	}
+	user, appErr := d.api.GetUser(batch.UserID)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get recipient")
+	}
+	if user.Email == "" || user.DeleteAt != 0 {
+		return nil
+	}
+
+	names := map[string]string{}
+	actorName := func(userID string) string {
+		if name, ok := names[userID]; ok {
+			return name
+		}
+		name := "Someone"
+		if actor, appErr := d.api.GetUser(userID); appErr == nil {
+			name = actor.GetDisplayName(model.ShowNicknameFullName)
+		}
+		names[userID] = name
+		return name
+	}
+	subject, body, err := renderEmail(user.Locale, batch.Notifications, actorName)
+	if err != nil {
+		return err
+	}
+	if appErr := d.api.SendMail(user.Email, subject, body); appErr != nil {
+		return errors.Wrap(appErr, "failed to send email")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderEmail(t *testing.T) {
+	actorName := func(userID string) string { return "An <Admin>" }
+	forward := &EmailNotification{Event: EmailEventForwarded, PetitionTitle: "Pothole"}
+	escalate := &EmailNotification{Event: EmailEventEscalated, PetitionTitle: "Pothole", Priority: 1}
+
+	subject, body, err := renderEmail("en", []*EmailNotification{forward}, actorName)
+	require.NoError(t, err)
+	assert.Equal(t, "[Petitions] An <Admin> forwarded the petition “Pothole” to you.", subject)
+	assert.Contains(t, body, "An &lt;Admin&gt; forwarded the petition “Pothole” to you.")
+
+	subject, body, err = renderEmail("vi", []*EmailNotification{forward, escalate}, actorName)
+	require.NoError(t, err)
+	assert.Equal(t, "[Kiến nghị] 2 cập nhật về kiến nghị của bạn", subject)
+	assert.Contains(t, body, "đã nâng mức ưu tiên của kiến nghị “Pothole” lên 1.")
+
+	assert.Equal(t, emailTranslations["vi"], emailTranslation("vi-VN"))
+	assert.Equal(t, emailTranslations["en"], emailTranslation("fr"))
+}
+
+func TestEmailPreferences(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+
+	w := doRequest(p, http.MethodGet, "/email/preferences", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var prefs EmailPreferences
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&prefs))
+	assert.Equal(t, EmailPreferences{"assigned": true, "forwarded": true, "escalated": true, "resolved": true}, prefs)
+
+	w = doRequest(p, http.MethodPut, "/email/preferences", "user1", map[string]bool{"forwarded": false})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&prefs))
+	assert.False(t, prefs.Enabled(EmailEventForwarded))
+	assert.True(t, prefs.Enabled(EmailEventResolved))
+
+	w = doRequest(p, http.MethodPut, "/email/preferences", "user1", map[string]bool{"deleted": true})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Preferences are per user.
+	prefs, err := p.store.GetEmailPreferences("user2")
+	require.NoError(t, err)
+	assert.True(t, prefs.Enabled(EmailEventForwarded))
+}
+
+func TestEmailNotificationsAreBatched(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	p.setConfiguration(&configuration{EnableEmailNotifications: true, EmailBatchMinutes: 5})
+	api.On("GetConfig").Return(&model.Config{EmailSettings: model.EmailSettings{SendEmailNotifications: model.NewBool(true)}})
+	api.On("GetUser", mock.Anything).Return(func(userID string) *model.User {
+		locale := "en"
+		if userID == "user2" {
+			locale = "vi"
+		}
+		return &model.User{Id: userID, Username: userID, Email: userID + "@example.com", Locale: locale}
+	}, nil)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+	var sent []string
+	api.On("SendMail", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		sent = append(sent, args.String(0)+": "+args.String(1))
+	}).Return(nil)
+
+	_, err := p.store.UpdateEmailPreferences("user3", EmailPreferences{EmailEventForwarded: false})
+	require.NoError(t, err)
+
+	petition := createTestPetition(t, p, "user1")
+	for _, step := range []struct{ actorID, assigneeID string }{{"user1", "user2"}, {"user2", "user3"}, {"user3", "user2"}} {
+		w := doRequest(p, http.MethodPost, "/requests/forward/"+petition.ID, step.actorID, map[string]string{"assignee_id": step.assigneeID})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Nothing is sent before the batch window passes.
+	start := time.Now()
+	p.emails.now = func() time.Time { return start }
+	p.emails.ProcessDue()
+	assert.Empty(t, sent)
+
+	p.emails.now = func() time.Time { return start.Add(6 * time.Minute) }
+	p.emails.ProcessDue()
+	assert.Equal(t, []string{"user2@example.com: [Kiến nghị] 2 cập nhật về kiến nghị của bạn"}, sent)
+
+	users, err := p.store.GetEmailBatchUsers()
+	require.NoError(t, err)
+	assert.Empty(t, users)
+
+	// Resolutions reach the creator and the watchers, except whoever resolved the petition.
+	sent = nil
+	w := doRequest(p, http.MethodPut, "/requests/"+petition.ID, "admin", map[string]string{"status": StatusResolved})
+	require.Equal(t, http.StatusOK, w.Code)
+	p.emails.now = func() time.Time { return start.Add(12 * time.Minute) }
+	p.emails.ProcessDue()
+	assert.ElementsMatch(t, []string{
+		"user1@example.com: [Petitions] admin resolved the petition “Pothole”.",
+		"user2@example.com: [Kiến nghị] admin đã giải quyết kiến nghị “Pothole”.",
+		"user3@example.com: [Petitions] admin resolved the petition “Pothole”.",
+	}, sent)
+}
+
+func TestEmailNotificationsRetryFailures(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetUser", "user2").Return(&model.User{Id: "user2", Email: "user2@example.com"}, nil)
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "user1"}, nil)
+	api.On("SendMail", mock.Anything, mock.Anything, mock.Anything).Return(model.NewAppError("SendMail", "smtp", nil, "", http.StatusInternalServerError)).Once()
+	api.On("SendMail", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	api.On("LogError", "Failed to send email notifications", "user_id", "user2", "error", mock.Anything).Once()
+
+	petition := &Petition{ID: model.NewId(), Title: "Pothole"}
+	notification := newEmailNotification(EmailEventAssigned, petition, "user1")
+	require.NoError(t, p.store.QueueEmailNotification("user2", notification))
+	start := time.Now()
+
+	p.emails.now = func() time.Time { return start }
+	p.emails.ProcessDue()
+	batch, err := p.store.UpdateEmailBatch("user2", func(*EmailBatch) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, batch.Failures)
+	assert.Len(t, batch.Notifications, 1)
+
+	// The batch is retried once the retry delay passed.
+	p.emails.now = func() time.Time { return start.Add(emailRetryDelay + time.Second) }
+	p.emails.ProcessDue()
+	users, err := p.store.GetEmailBatchUsers()
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
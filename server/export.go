@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Export formats supported by the export route.
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+// exportTimeLayout formats timestamps in exported files.
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// utf8BOM prefixes CSV exports so that Excel detects the encoding of Vietnamese text.
+const utf8BOM = "\uFEFF"
+
+// exportColumn is one column of the petition export.
+type exportColumn struct {
+	key     string
+	header  string
+	numeric bool
+	value   func(e *exporter, petition *Petition) string
+}
+
+// exportColumns lists every exportable column in default order.
+var exportColumns = []*exportColumn{
+	{key: "id", header: "ID", value: func(e *exporter, p *Petition) string { return p.ID }},
+	{key: "title", header: "Title", value: func(e *exporter, p *Petition) string { return p.Title }},
+	{key: "content", header: "Content", value: func(e *exporter, p *Petition) string { return p.Content }},
+	{key: "priority", header: "Priority", numeric: true, value: func(e *exporter, p *Petition) string { return strconv.Itoa(p.Priority) }},
+	{key: "category", header: "Category", value: func(e *exporter, p *Petition) string { return e.categoryName(p.CategoryID) }},
+	{key: "status", header: "Status", value: func(e *exporter, p *Petition) string { return p.Status }},
+	{key: "creator", header: "Creator", value: func(e *exporter, p *Petition) string { return e.username(p.CreatorID) }},
+	{key: "assignee", header: "Assignee", value: func(e *exporter, p *Petition) string { return e.username(p.AssigneeID) }},
+	{key: "completion", header: "Completion (%)", numeric: true, value: func(e *exporter, p *Petition) string { return strconv.Itoa(p.Completion) }},
+	{key: "create_at", header: "Created", value: func(e *exporter, p *Petition) string { return e.formatTime(p.CreateAt) }},
+	{key: "update_at", header: "Updated", value: func(e *exporter, p *Petition) string { return e.formatTime(p.UpdateAt) }},
+}
+
+// historyHeaders are the headers of the process history sheet.
+var historyHeaders = []string{"Petition ID", "Petition title", "Step", "From", "To", "Action", "Date"}
+
+// parseExportColumns returns the columns named in the comma-separated list, or every column if
+// the list is empty.
+func parseExportColumns(list string) ([]*exportColumn, error) {
+	if strings.TrimSpace(list) == "" {
+		return exportColumns, nil
+	}
+
+	var columns []*exportColumn
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		var column *exportColumn
+		for _, candidate := range exportColumns {
+			if candidate.key == key {
+				column = candidate
+				break
+			}
+		}
+		if column == nil {
+			return nil, newBadRequestError("unknown column " + key)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// exporter resolves the names and timestamps written to exported files, caching lookups.
+type exporter struct {
+	plugin     *Plugin
+	location   *time.Location
+	categories map[string]string
+	usernames  map[string]string
+}
+
+func (p *Plugin) newExporter(location *time.Location) (*exporter, error) {
+	categories, err := p.store.GetCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load categories")
+	}
+
+	e := &exporter{
+		plugin:     p,
+		location:   location,
+		categories: make(map[string]string, len(categories)),
+		usernames:  map[string]string{},
+	}
+	for _, category := range categories {
+		e.categories[category.ID] = category.Name
+	}
+	return e, nil
+}
+
+func (e *exporter) categoryName(id string) string {
+	if name, ok := e.categories[id]; ok {
+		return name
+	}
+	return id
+}
+
+func (e *exporter) username(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if name, ok := e.usernames[userID]; ok {
+		return name
+	}
+
+	name := userID
+	if user, appErr := e.plugin.API.GetUser(userID); appErr == nil {
+		name = user.Username
+	}
+	e.usernames[userID] = name
+	return name
+}
+
+func (e *exporter) formatTime(millis int64) string {
+	if millis == 0 {
+		return ""
+	}
+	return time.UnixMilli(millis).In(e.location).Format(exportTimeLayout)
+}
+
+func (e *exporter) row(columns []*exportColumn, petition *Petition) []xlsxCell {
+	cells := make([]xlsxCell, len(columns))
+	for i, column := range columns {
+		cells[i] = xlsxCell{Value: column.value(e, petition), Numeric: column.numeric}
+	}
+	return cells
+}
+
+func (e *exporter) historyRows(petition *Petition) [][]xlsxCell {
+	rows := make([][]xlsxCell, 0, len(petition.Processes))
+	for i, process := range petition.Processes {
+		rows = append(rows, []xlsxCell{
+			{Value: petition.ID},
+			{Value: petition.Title},
+			{Value: strconv.Itoa(i + 1), Numeric: true},
+			{Value: e.username(process.ActorID)},
+			{Value: e.username(process.UserID)},
+			{Value: process.Action},
+			{Value: e.formatTime(process.CreateAt)},
+		})
+	}
+	return rows
+}
+
+func headerCells(headers []string) []xlsxCell {
+	cells := make([]xlsxCell, len(headers))
+	for i, header := range headers {
+		cells[i] = xlsxCell{Value: header}
+	}
+	return cells
+}
+
+// handleExportPetitions streams the petitions matching the /requests filters as CSV or XLSX.
+// Only the IDs and sort keys of matching petitions are held in memory; petitions are reloaded
+// one at a time while writing.
+func (p *Plugin) handleExportPetitions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if format != ExportFormatCSV && format != ExportFormatXLSX {
+		p.handleError(w, newBadRequestError("format must be csv or xlsx"))
+		return
+	}
+	history := query.Get("history") == "true"
+	if history && format != ExportFormatXLSX {
+		p.handleError(w, newBadRequestError("process history is only available in xlsx exports"))
+		return
+	}
+
+	columns, err := parseExportColumns(query.Get("columns"))
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	location := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		if location, err = time.LoadLocation(tz); err != nil {
+			p.handleError(w, newBadRequestError("unknown time zone"))
+			return
+		}
+	}
+	filter, err := ParsePetitionFilter(query)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	pageReq, err := parsePageRequest(query, petitionSortFields...)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	pageReq.PerPage = 0
+	pageReq.After = nil
+
+	a, err := p.newAccess(userID)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	sortKeyOf := petitionSortKey(pageReq.Sort)
+	var keys []sortKey
+	err = p.store.ForEachPetition(func(petition *Petition) error {
+		if filter.Matches(petition) && a.CanView(petition) {
+			keys = append(keys, sortKeyOf(petition))
+		}
+		return nil
+	})
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	keys, _ = paginate(keys, func(k sortKey) sortKey { return k }, pageReq)
+
+	e, err := p.newExporter(location)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+
+	// forEach reloads the matching petitions in export order.
+	forEach := func(fn func(*Petition) error) error {
+		for _, key := range keys {
+			petition, err := p.store.GetPetition(key.ID)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(petition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	filename := fmt.Sprintf("petitions-%s.%s", time.Now().In(location).Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == ExportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = p.writeCSVExport(w, e, columns, forEach)
+	} else {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		err = p.writeXLSXExport(w, e, columns, history, forEach)
+	}
+	if err != nil {
+		// Headers and part of the body may already be sent; the truncated file is all the
+		// client will see.
+		p.API.LogError("Failed to export petitions", "error", err.Error())
+	}
+}
+
+// escapeFormula prefixes text a spreadsheet application would read as a formula with an
+// apostrophe, so that values submitted by users and opened from a CSV file are shown as typed
+// rather than evaluated.
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (p *Plugin) writeCSVExport(w http.ResponseWriter, e *exporter, columns []*exportColumn, forEach func(func(*Petition) error) error) error {
+	if _, err := w.Write([]byte(utf8BOM)); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.header
+	}
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	err := forEach(func(petition *Petition) error {
+		for i, column := range columns {
+			record[i] = column.value(e, petition)
+			if !column.numeric {
+				record[i] = escapeFormula(record[i])
+			}
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (p *Plugin) writeXLSXExport(w http.ResponseWriter, e *exporter, columns []*exportColumn, history bool, forEach func(func(*Petition) error) error) error {
+	xw := newXLSXWriter(w)
+
+	if err := xw.StartSheet("Petitions"); err != nil {
+		return err
+	}
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.header
+	}
+	if err := xw.WriteRow(headerCells(headers)); err != nil {
+		return err
+	}
+	if err := forEach(func(petition *Petition) error {
+		return xw.WriteRow(e.row(columns, petition))
+	}); err != nil {
+		return err
+	}
+
+	if history {
+		if err := xw.StartSheet("History"); err != nil {
+			return err
+		}
+		if err := xw.WriteRow(headerCells(historyHeaders)); err != nil {
+			return err
+		}
+		if err := forEach(func(petition *Petition) error {
+			for _, row := range e.historyRows(petition) {
+				if err := xw.WriteRow(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return xw.Close()
+}
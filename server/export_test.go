@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
+
+func TestEscapeFormula(t *testing.T) {
+	for _, value := range []string{"=1+1", "+1", "-1", "@SUM(A1)", "\tx", "\rx"} {
+		assert.Equal(t, "'"+value, escapeFormula(value))
+	}
+	assert.Equal(t, "Kiến nghị = 1", escapeFormula("Kiến nghị = 1"))
+	assert.Equal(t, "", escapeFormula(""))
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	p := setupExportTest(t)
+	require.NoError(t, p.store.SavePetition(&Petition{
+		ID: "p3", Title: `=HYPERLINK("https://example.com","x")`, Priority: 3, CategoryID: "roads", Status: StatusPending,
+		CreatorID: "user1", CreateAt: 1704240000000,
+		Processes: []*Process{{ActorID: "user1", UserID: "user2", Action: "@cmd", CreateAt: 1704240000000}},
+	}))
+
+	w := doRequest(p, http.MethodGet, "/requests/export?columns=id,title,priority&status=pending", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(w.Body.String(), utf8BOM))).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p3", `'=HYPERLINK("https://example.com","x")`, "3"}, records[1])
+
+	w = doRequest(p, http.MethodGet, "/requests/export?format=xlsx&history=true&columns=title&status=pending", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	data := w.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var sheets string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		sheets += string(content)
+	}
+	// Inline strings are never evaluated, so XLSX cells keep the values as typed.
+	assert.Contains(t, sheets, `>=HYPERLINK(`)
+	assert.Contains(t, sheets, `>@cmd<`)
+	assert.NotContains(t, sheets, `&#39;`)
+}
+
+func setupExportTest(t *testing.T) *Plugin {
+	p, api := setupTestPlugin(t)
+	api.On("GetUser", mock.Anything).Return(func(userID string) *model.User {
+		return &model.User{Id: userID, Username: "name-" + userID}
+	}, nil)
+
+	category := &Category{ID: "roads", Name: "Giao thông"}
+	require.NoError(t, p.store.SaveCategory(category))
+	require.NoError(t, p.store.SavePetition(&Petition{
+		ID: "p1", Title: "Kiến nghị sửa đường", Priority: 2, CategoryID: "roads", Status: StatusInProgress,
+		CreatorID: "user1", AssigneeID: "user2", CreateAt: 1704067200000,
+		Processes: []*Process{{ActorID: "user1", UserID: "user2", Action: "Xử lý", CreateAt: 1704070800000}},
+	}))
+	require.NoError(t, p.store.SavePetition(&Petition{
+		ID: "p2", Title: "Đèn hỏng", Priority: 1, CategoryID: "roads", Status: StatusResolved,
+		CreatorID: "user1", CreateAt: 1704153600000,
+	}))
+	return p
+}
+
+func TestExportCSV(t *testing.T) {
+	p := setupExportTest(t)
+
+	w := doRequest(p, http.MethodGet, "/requests/export?columns=id,title,category,assignee,create_at&status=in_progress&tz=Asia/Ho_Chi_Minh", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	require.True(t, strings.HasPrefix(body, utf8BOM))
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(body, utf8BOM))).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ID", "Title", "Category", "Assignee", "Created"},
+		{"p1", "Kiến nghị sửa đường", "Giao thông", "name-user2", "2024-01-01 07:00:00"},
+	}, records)
+
+	w = doRequest(p, http.MethodGet, "/requests/export?columns=bogus", "user1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(p, http.MethodGet, "/requests/export?history=true", "user1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportXLSX(t *testing.T) {
+	p := setupExportTest(t)
+
+	w := doRequest(p, http.MethodGet, "/requests/export?format=xlsx&history=true&columns=title,priority&sort=priority", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	data := w.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	require.Contains(t, files, "[Content_Types].xml")
+	assert.Contains(t, files["xl/workbook.xml"], `<sheet name="History" sheetId="2" r:id="rId2"/>`)
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="B2"><v>1</v></c>`)
+	assert.Less(t, strings.Index(sheet, "Đèn hỏng"), strings.Index(sheet, "Kiến nghị sửa đường"))
+
+	history := files["xl/worksheets/sheet2.xml"]
+	assert.Contains(t, history, "Xử lý")
+	assert.Contains(t, history, "name-user2")
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort fields accepted by the list routes. The first of each list is the default.
+var (
+	petitionSortFields = []string{"create_at", "update_at", "priority", "title", "status"}
+	issueSortFields    = []string{"create_at", "message"}
+)
+
+// PetitionFilter selects petitions by their fields. Zero-valued fields match everything.
+type PetitionFilter struct {
+	Statuses    []string
+	CategoryIDs []string
+	TopicIDs    []string
+	Priorities  []int
+	AssigneeID  string
+	CreatorID   string
+	Since       int64
+	Until       int64
+	Text        []string
+}
+
+// IssueFilter selects issues by their fields. Zero-valued fields match everything.
+type IssueFilter struct {
+	AssigneeID string
+	CreatorID  string
+	Since      int64
+	Until      int64
+	Text       []string
+}
+
+// splitParam returns the values of a query parameter given either repeatedly or as a
+// comma-separated list.
+func splitParam(query url.Values, name string) []string {
+	var values []string
+	for _, raw := range query[name] {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// parseDateParam reads a date given in Unix milliseconds, RFC 3339 or as YYYY-MM-DD in UTC. A
+// bare date used as an upper bound covers the whole day.
+func parseDateParam(query url.Values, name string, endOfDay bool) (int64, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return millis, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Millisecond)
+		}
+		return t.UnixMilli(), nil
+	}
+	return 0, newBadRequestError("invalid " + name + " date")
+}
+
+// parseDateRange reads the from and to query parameters.
+func parseDateRange(query url.Values) (since, until int64, err error) {
+	if since, err = parseDateParam(query, "from", false); err != nil {
+		return 0, 0, err
+	}
+	if until, err = parseDateParam(query, "to", true); err != nil {
+		return 0, 0, err
+	}
+	return since, until, nil
+}
+
+// ParsePetitionFilter reads a petition filter from the query parameters status, category, topic,
+// priority, assignee, creator, from, to and q.
+func ParsePetitionFilter(query url.Values) (*PetitionFilter, error) {
+	filter := &PetitionFilter{
+		Statuses:    splitParam(query, "status"),
+		CategoryIDs: splitParam(query, "category"),
+		TopicIDs:    splitParam(query, "topic"),
+		AssigneeID:  query.Get("assignee"),
+		CreatorID:   query.Get("creator"),
+		Text:        tokenize(query.Get("q")),
+	}
+
+	for _, status := range filter.Statuses {
+		if !isValidStatus(status) {
+			return nil, newBadRequestError("invalid status")
+		}
+	}
+	for _, raw := range splitParam(query, "priority") {
+		priority, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, newBadRequestError("invalid priority")
+		}
+		filter.Priorities = append(filter.Priorities, priority)
+	}
+
+	var err error
+	if filter.Since, filter.Until, err = parseDateRange(query); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// ParseIssueFilter reads an issue filter from the query parameters assignee, creator, from, to
+// and q.
+func ParseIssueFilter(query url.Values) (*IssueFilter, error) {
+	filter := &IssueFilter{
+		AssigneeID: query.Get("assignee"),
+		CreatorID:  query.Get("creator"),
+		Text:       tokenize(query.Get("q")),
+	}
+
+	var err error
+	if filter.Since, filter.Until, err = parseDateRange(query); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAnyString reports whether values holds any of candidates.
+func containsAnyString(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsString(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesText reports whether every query token is a prefix of a word of texts, ignoring case
+// and diacritics.
+func matchesText(query []string, texts ...string) bool {
+	if len(query) == 0 {
+		return true
+	}
+
+	var words []string
+	for _, text := range texts {
+		words = append(words, tokenize(text)...)
+	}
+	for _, token := range query {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func inDateRange(t, since, until int64) bool {
+	return (since == 0 || t >= since) && (until == 0 || t <= until)
+}
+
+// Matches reports whether petition satisfies the filter.
+func (f *PetitionFilter) Matches(petition *Petition) bool {
+	return (len(f.Statuses) == 0 || containsString(f.Statuses, petition.Status)) &&
+		(len(f.CategoryIDs) == 0 || containsString(f.CategoryIDs, petition.CategoryID)) &&
+		(len(f.TopicIDs) == 0 || containsAnyString(f.TopicIDs, petition.TopicIDs)) &&
+		(len(f.Priorities) == 0 || containsInt(f.Priorities, petition.Priority)) &&
+		(f.AssigneeID == "" || petition.AssigneeID == f.AssigneeID) &&
+		(f.CreatorID == "" || petition.CreatorID == f.CreatorID) &&
+		inDateRange(petition.CreateAt, f.Since, f.Until) &&
+		matchesText(f.Text, petition.Title, petition.Content)
+}
+
+// Matches reports whether issue satisfies the filter.
+func (f *IssueFilter) Matches(issue *Issue) bool {
+	return (f.AssigneeID == "" || issue.AssigneeID == f.AssigneeID) &&
+		(f.CreatorID == "" || issue.CreatorID == f.CreatorID) &&
+		inDateRange(issue.CreateAt, f.Since, f.Until) &&
+		matchesText(f.Text, issue.Message, issue.Description)
+}
+
+// petitionSortKey returns the key ordering petitions by the given sort field.
+func petitionSortKey(field string) func(*Petition) sortKey {
+	return func(petition *Petition) sortKey {
+		key := sortKey{ID: petition.ID}
+		switch field {
+		case "update_at":
+			key.Num = petition.UpdateAt
+		case "priority":
+			key.Num = int64(petition.Priority)
+		case "title":
+			key.Str = foldText(petition.Title)
+		case "status":
+			key.Str = petition.Status
+		default:
+			key.Num = petition.CreateAt
+		}
+		return key
+	}
+}
+
+// issueSortKey returns the key ordering issues by the given sort field.
+func issueSortKey(field string) func(*Issue) sortKey {
+	return func(issue *Issue) sortKey {
+		key := sortKey{ID: issue.ID}
+		switch field {
+		case "message":
+			key.Str = foldText(issue.Message)
+		default:
+			key.Num = issue.CreateAt
+		}
+		return key
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePetitionFilter(t *testing.T) {
+	query := url.Values{
+		"status":   {"pending,in_progress"},
+		"priority": {"1", "2"},
+		"from":     {"2024-01-01"},
+		"to":       {"2024-01-31"},
+		"q":        {"Kiến nghị"},
+	}
+	filter, err := ParsePetitionFilter(query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{StatusPending, StatusInProgress}, filter.Statuses)
+	assert.Equal(t, []int{1, 2}, filter.Priorities)
+	assert.Equal(t, int64(1704067200000), filter.Since)
+	assert.Equal(t, int64(1706745599999), filter.Until)
+	assert.Equal(t, []string{"kien", "nghi"}, filter.Text)
+
+	assert.True(t, filter.Matches(&Petition{Status: StatusPending, Priority: 2, CreateAt: 1704067200000, Title: "Kiến nghị"}))
+	assert.False(t, filter.Matches(&Petition{Status: StatusResolved, Priority: 2, CreateAt: 1704067200000, Title: "Kiến nghị"}))
+	assert.False(t, filter.Matches(&Petition{Status: StatusPending, Priority: 2, CreateAt: 1706745600000, Title: "Kiến nghị"}))
+	assert.False(t, filter.Matches(&Petition{Status: StatusPending, Priority: 2, CreateAt: 1704067200000, Title: "Kiến"}))
+
+	_, err = ParsePetitionFilter(url.Values{"status": {"bogus"}})
+	assert.Error(t, err)
+	_, err = ParsePetitionFilter(url.Values{"from": {"yesterday"}})
+	assert.Error(t, err)
+}
+
+func TestListPetitionsPagination(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	_, err := p.store.AddRoleAssignment(&RoleAssignment{ID: "r1", Role: RoleEditor, UserID: "user1"})
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, p.store.SavePetition(&Petition{
+			ID:       fmt.Sprintf("p%d", i),
+			Title:    fmt.Sprintf("Petition %d", i),
+			Priority: 1 + i%2,
+			Status:   StatusPending,
+			CreateAt: int64(1000 + i/2),
+		}))
+	}
+
+	var seen []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 4)
+		w := doRequest(p, http.MethodGet, "/requests?sort=create_at&order=desc&per_page=3&cursor="+cursor, "user1", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "7", w.Header().Get(headerTotalCount))
+
+		var page []*Petition
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+		for _, petition := range page {
+			seen = append(seen, petition.ID)
+		}
+
+		cursor = w.Header().Get(headerNextCursor)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"p6", "p5", "p4", "p3", "p2", "p1", "p0"}, seen)
+
+	w := doRequest(p, http.MethodGet, "/requests?priority=2&sort=title", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var filtered []*Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&filtered))
+	assert.Equal(t, "3", w.Header().Get(headerTotalCount))
+	assert.Empty(t, w.Header().Get(headerNextCursor))
+	require.Len(t, filtered, 3)
+	assert.Equal(t, "p1", filtered[0].ID)
+
+	w = doRequest(p, http.MethodGet, "/requests?sort=title&cursor="+encodeCursor(sortKey{Sort: "create_at"}), "user1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests?per_page="+strconv.Itoa(0), "user1", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
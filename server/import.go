@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// Record types that can be imported.
+const (
+	ImportTypePetitions = "petitions"
+	ImportTypeTodos     = "todos"
+)
+
+// States of an import job.
+const (
+	ImportStatusValidated = "validated"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+const (
+	importKeyPrefix      = "import_"
+	importBatchKeyPrefix = "import_batch_"
+)
+
+// importBatchSize is the number of records created between two progress checkpoints.
+const importBatchSize = 100
+
+// importQueue names the import job and its queue of batches in the plugin's metrics.
+const importQueue = "import"
+
+// maxImportErrors bounds the number of row errors kept in an import report.
+const maxImportErrors = 1000
+
+// importLease is how long a running import may go without recording progress before it is
+// considered abandoned, for example by a plugin restart, and may be resumed.
+const importLease = 2 * time.Minute
+
+// ErrImportRunning is returned when committing an import that is already being committed.
+var ErrImportRunning = errors.New("import is already running")
+
+// ImportRowError explains why a row of an imported file was rejected. Rows are numbered as in a
+// spreadsheet, the header being row 1.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportJob tracks an uploaded file from validation to commit. The validated records are
+// stored separately in batches, and Processed counts the batches already committed so that an
+// interrupted commit resumes where it stopped.
+type ImportJob struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	UserID    string            `json:"user_id"`
+	Status    string            `json:"status"`
+	Total     int               `json:"total"`
+	Valid     int               `json:"valid"`
+	Errors    []*ImportRowError `json:"errors"`
+	Batches   int               `json:"batches"`
+	Processed int               `json:"processed"`
+	Created   int               `json:"created"`
+	Failure   string            `json:"failure,omitempty"`
+	CreateAt  int64             `json:"create_at"`
+	UpdateAt  int64             `json:"update_at"`
+}
+
+// importBatch holds the records of one batch. Records are validated with their final IDs, so
+// replaying a batch after an interruption skips the records it already created.
+type importBatch struct {
+	Petitions []*Petition `json:"petitions,omitempty"`
+	Issues    []*Issue    `json:"issues,omitempty"`
+}
+
+func (b *importBatch) size() int {
+	return len(b.Petitions) + len(b.Issues)
+}
+
+func importKey(id string) string {
+	return importKeyPrefix + id
+}
+
+func importBatchKey(id string, n int) string {
+	return fmt.Sprintf("%s%s_%d", importBatchKeyPrefix, id, n)
+}
+
+// SaveImportJob stores a validated import job along with its batches.
+func (s *Store) SaveImportJob(job *ImportJob, batches []*importBatch) error {
+	for n, batch := range batches {
+		if err := setJSON(s.kv, importBatchKey(job.ID, n), batch); err != nil {
+			return errors.Wrap(err, "failed to save import batch")
+		}
+	}
+	job.Batches = len(batches)
+	return setJSON(s.kv, importKey(job.ID), job)
+}
+
+// GetImportJob returns the import job with the given ID.
+func (s *Store) GetImportJob(id string) (*ImportJob, error) {
+	var job ImportJob
+	found, err := getJSON(s.kv, importKey(id), &job)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+// UpdateImportJob atomically applies fn to the import job with the given ID and returns the
+// result.
+func (s *Store) UpdateImportJob(id string, fn func(*ImportJob) error) (*ImportJob, error) {
+	var updated *ImportJob
+	err := modifyJSON(s.kv, importKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var job ImportJob
+		if err := json.Unmarshal(initial, &job); err != nil {
+			return nil, errors.Wrap(err, "failed to decode import job")
+		}
+		if err := fn(&job); err != nil {
+			return nil, err
+		}
+		job.UpdateAt = model.GetMillis()
+		updated = &job
+		return &job, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// getImportBatch returns batch n of an import job.
+func (s *Store) getImportBatch(id string, n int) (*importBatch, error) {
+	var batch importBatch
+	found, err := getJSON(s.kv, importBatchKey(id, n), &batch)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &batch, nil
+}
+
+// deleteImportBatches removes the batches of an import job, keeping its report.
+func (s *Store) deleteImportBatches(job *ImportJob) error {
+	for n := 0; n < job.Batches; n++ {
+		if err := s.kv.Delete(importBatchKey(job.ID, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImportJob removes an import job and its batches.
+func (s *Store) DeleteImportJob(job *ImportJob) error {
+	if err := s.deleteImportBatches(job); err != nil {
+		return err
+	}
+	return s.kv.Delete(importKey(job.ID))
+}
+
+// importField is a record field that may be read from an imported column.
+type importField struct {
+	name     string
+	required bool
+}
+
+// importFields lists the fields of each import type.
+var importFields = map[string][]importField{
+	ImportTypePetitions: {
+		{name: "title", required: true},
+		{name: "content"},
+		{name: "priority", required: true},
+		{name: "category", required: true},
+		{name: "status"},
+		{name: "creator"},
+		{name: "assignee"},
+		{name: "create_at"},
+	},
+	ImportTypeTodos: {
+		{name: "message", required: true},
+		{name: "description"},
+		{name: "creator"},
+		{name: "assignee"},
+		{name: "create_at"},
+	},
+}
+
+// resolveImportColumns returns the column index of every mapped field. mapping names the
+// column holding each field; fields left out of it are read from a column of the same name, if
+// any.
+func resolveImportColumns(importType string, header []string, mapping map[string]string) (map[string]int, error) {
+	fields := importFields[importType]
+
+	for field := range mapping {
+		known := false
+		for _, candidate := range fields {
+			known = known || candidate.name == field
+		}
+		if !known {
+			return nil, newBadRequestError("unknown field " + field)
+		}
+	}
+
+	findColumn := func(name string) int {
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	columns := map[string]int{}
+	for _, field := range fields {
+		column, mapped := mapping[field.name]
+		if !mapped {
+			column = field.name
+		}
+		index := findColumn(column)
+		if index < 0 && mapped {
+			return nil, newBadRequestError("column " + column + " not found")
+		}
+		if index < 0 && field.required {
+			return nil, newBadRequestError("field " + field.name + " is not mapped")
+		}
+		if index >= 0 {
+			columns[field.name] = index
+		}
+	}
+	return columns, nil
+}
+
+// importTimeLayouts are the timestamp formats accepted in imported files, besides Unix
+// milliseconds. The first matches exported files.
+var importTimeLayouts = []string{exportTimeLayout, time.RFC3339, "2006-01-02", "02/01/2006 15:04", "02/01/2006"}
+
+func parseImportTime(raw string, location *time.Location) (int64, error) {
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return millis, nil
+	}
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, raw, location); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, errors.New("invalid date")
+}
+
+// importer validates the rows of an imported file and turns them into records.
+type importer struct {
+	plugin     *Plugin
+	importType string
+	userID     string
+	teamID     string
+	location   *time.Location
+	columns    map[string]int
+	categories map[string]string
+	users      map[string]string
+}
+
+func (p *Plugin) newImporter(importType, userID, teamID string, location *time.Location) (*importer, error) {
+	categories, err := p.store.GetCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load categories")
+	}
+
+	im := &importer{
+		plugin:     p,
+		importType: importType,
+		userID:     userID,
+		teamID:     teamID,
+		location:   location,
+		categories: make(map[string]string, 2*len(categories)),
+		users:      map[string]string{},
+	}
+	for _, category := range categories {
+		im.categories[category.ID] = category.ID
+		im.categories[foldText(category.Name)] = category.ID
+	}
+	return im, nil
+}
+
+func (im *importer) value(record []string, field string) string {
+	index, ok := im.columns[field]
+	if !ok || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// resolveUser returns the ID of the user with the given username or email address, or an
+// empty string if there is none.
+func (im *importer) resolveUser(ref string) (string, error) {
+	ref = strings.ToLower(strings.TrimPrefix(ref, "@"))
+	if userID, ok := im.users[ref]; ok {
+		return userID, nil
+	}
+
+	var user *model.User
+	var appErr *model.AppError
+	if strings.Contains(ref, "@") {
+		user, appErr = im.plugin.API.GetUserByEmail(ref)
+	} else {
+		user, appErr = im.plugin.API.GetUserByUsername(ref)
+	}
+	userID := ""
+	if appErr != nil {
+		if appErr.StatusCode != http.StatusNotFound {
+			return "", errors.Wrap(appErr, "failed to get user")
+		}
+	} else {
+		userID = user.Id
+	}
+	im.users[ref] = userID
+	return userID, nil
+}
+
+// rowParser collects the errors found while parsing one row.
+type rowParser struct {
+	im     *importer
+	row    int
+	record []string
+	errors []*ImportRowError
+}
+
+func (rp *rowParser) fail(field, message string) {
+	rp.errors = append(rp.errors, &ImportRowError{Row: rp.row, Field: field, Message: message})
+}
+
+func (rp *rowParser) value(field string) string {
+	return rp.im.value(rp.record, field)
+}
+
+func (rp *rowParser) required(field string) string {
+	value := rp.value(field)
+	if value == "" {
+		rp.fail(field, field+" is required")
+	}
+	return value
+}
+
+func (rp *rowParser) user(field string, fallback string) (string, error) {
+	ref := rp.value(field)
+	if ref == "" {
+		return fallback, nil
+	}
+	userID, err := rp.im.resolveUser(ref)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		rp.fail(field, "unknown user "+ref)
+	}
+	return userID, nil
+}
+
+func (rp *rowParser) timestamp(field string) int64 {
+	raw := rp.value(field)
+	if raw == "" {
+		return model.GetMillis()
+	}
+	millis, err := parseImportTime(raw, rp.im.location)
+	if err != nil {
+		rp.fail(field, "invalid date "+raw)
+	}
+	return millis
+}
+
+func (im *importer) parsePetition(rp *rowParser) (*Petition, error) {
+	title := rp.required("title")
+	content := rp.value("content")
+
+	priority := 0
+	if raw := rp.required("priority"); raw != "" {
+		var err error
+		priority, err = strconv.Atoi(raw)
+		if err != nil || priority < MinPriority || priority > MaxPriority {
+			rp.fail("priority", fmt.Sprintf("priority must be between %d and %d", MinPriority, MaxPriority))
+		}
+	}
+
+	categoryID := ""
+	if raw := rp.required("category"); raw != "" {
+		var ok bool
+		if categoryID, ok = im.categories[raw]; !ok {
+			if categoryID, ok = im.categories[foldText(raw)]; !ok {
+				rp.fail("category", "unknown category "+raw)
+			}
+		}
+	}
+
+	status := rp.value("status")
+	if status == "" {
+		status = StatusPending
+	} else if !isValidStatus(status) {
+		rp.fail("status", "invalid status "+status)
+	}
+
+	creatorID, err := rp.user("creator", im.userID)
+	if err != nil {
+		return nil, err
+	}
+	assigneeID, err := rp.user("assignee", "")
+	if err != nil {
+		return nil, err
+	}
+	createAt := rp.timestamp("create_at")
+
+	petition := &Petition{
+		ID:         model.NewId(),
+		TeamID:     im.teamID,
+		Title:      title,
+		Content:    content,
+		Priority:   priority,
+		CategoryID: categoryID,
+		Status:     status,
+		CreatorID:  creatorID,
+		AssigneeID: assigneeID,
+		Watchers:   []string{creatorID},
+		Processes:  []*Process{},
+		Subtasks:   Checklist{},
+		CreateAt:   createAt,
+		UpdateAt:   createAt,
+	}
+	if assigneeID != "" {
+		petition.Watch(assigneeID)
+	}
+	return petition, nil
+}
+
+func (im *importer) parseIssue(rp *rowParser) (*Issue, error) {
+	message := rp.required("message")
+	creatorID, err := rp.user("creator", im.userID)
+	if err != nil {
+		return nil, err
+	}
+	assigneeID, err := rp.user("assignee", "")
+	if err != nil {
+		return nil, err
+	}
+	createAt := rp.timestamp("create_at")
+	if message == "" {
+		return nil, nil
+	}
+
+	issue, err := NewIssue(message, rp.value("description"), "", creatorID, assigneeID)
+	if err != nil {
+		return nil, err
+	}
+	issue.CreateAt = createAt
+	return issue, nil
+}
+
+// validate reads a CSV file and returns the report of a new import job along with the batches
+// of valid records. mapping names the column holding each field.
+func (im *importer) validate(r io.Reader, mapping map[string]string) (*ImportJob, []*importBatch, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, newBadRequestError("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, newBadRequestError("malformed CSV header")
+	}
+	header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	if im.columns, err = resolveImportColumns(im.importType, header, mapping); err != nil {
+		return nil, nil, err
+	}
+
+	now := model.GetMillis()
+	job := &ImportJob{
+		ID:       model.NewId(),
+		Type:     im.importType,
+		UserID:   im.userID,
+		Status:   ImportStatusValidated,
+		Errors:   []*ImportRowError{},
+		CreateAt: now,
+		UpdateAt: now,
+	}
+	var batches []*importBatch
+	batch := &importBatch{}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, newBadRequestError(fmt.Sprintf("malformed CSV on row %d", row))
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		job.Total++
+
+		rp := &rowParser{im: im, row: row, record: record}
+		if im.importType == ImportTypePetitions {
+			petition, err := im.parsePetition(rp)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rp.errors) == 0 {
+				batch.Petitions = append(batch.Petitions, petition)
+			}
+		} else {
+			issue, err := im.parseIssue(rp)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rp.errors) == 0 {
+				batch.Issues = append(batch.Issues, issue)
+			}
+		}
+
+		if len(rp.errors) > 0 {
+			if room := maxImportErrors - len(job.Errors); room > 0 {
+				if len(rp.errors) > room {
+					rp.errors = rp.errors[:room]
+				}
+				job.Errors = append(job.Errors, rp.errors...)
+			}
+			continue
+		}
+		job.Valid++
+		if batch.size() == importBatchSize {
+			batches = append(batches, batch)
+			batch = &importBatch{}
+		}
+	}
+	if batch.size() > 0 {
+		batches = append(batches, batch)
+	}
+
+	return job, batches, nil
+}
+
+// commitImportBatch creates the records of a batch that do not exist yet and returns how many
+// it created, so that a batch committed again after an interruption is not counted twice.
+func (s *Store) commitImportBatch(batch *importBatch) (int, error) {
+	created := 0
+	for _, petition := range batch.Petitions {
+		if _, err := s.GetPetition(petition.ID); err != ErrNotFound {
+			if err != nil {
+				return created, err
+			}
+			continue
+		}
+		if err := s.SavePetition(petition); err != nil {
+			return created, err
+		}
+		created++
+	}
+	for _, issue := range batch.Issues {
+		if _, err := s.GetIssue(issue.ID); err != ErrNotFound {
+			if err != nil {
+				return created, err
+			}
+			continue
+		}
+		if err := s.SaveIssue(issue); err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+// runImport commits the remaining batches of a running import job, recording progress after
+// each batch.
+func (p *Plugin) runImport(job *ImportJob) {
+	var failure error
+	finish := p.jobs.Start(importQueue)
+	remaining := job.Batches - job.Processed
+	p.metrics.AddQueueSize(importQueue, remaining)
+	defer func() {
+		p.metrics.AddQueueSize(importQueue, -remaining)
+		finish(failure)
+	}()
+
+	fail := func(err error) {
+		failure = err
+		p.API.LogError("Import failed", "import_id", job.ID, "error", err.Error())
+		if _, updateErr := p.store.UpdateImportJob(job.ID, func(job *ImportJob) error {
+			job.Status = ImportStatusFailed
+			job.Failure = err.Error()
+			return nil
+		}); updateErr != nil {
+			p.API.LogError("Failed to record import failure", "import_id", job.ID, "error", updateErr.Error())
+		}
+	}
+
+	for n := job.Processed; n < job.Batches; n++ {
+		batch, err := p.store.getImportBatch(job.ID, n)
+		if err != nil {
+			fail(errors.Wrapf(err, "failed to load batch %d", n))
+			return
+		}
+		created, err := p.store.commitImportBatch(batch)
+		if err != nil {
+			fail(errors.Wrapf(err, "failed to commit batch %d", n))
+			return
+		}
+		if job, err = p.store.UpdateImportJob(job.ID, func(job *ImportJob) error {
+			job.Processed = n + 1
+			job.Created += created
+			return nil
+		}); err != nil {
+			fail(errors.Wrap(err, "failed to record progress"))
+			return
+		}
+		remaining--
+		p.metrics.AddQueueSize(importQueue, -1)
+	}
+
+	job, err := p.store.UpdateImportJob(job.ID, func(job *ImportJob) error {
+		job.Status = ImportStatusCompleted
+		return nil
+	})
+	if err != nil {
+		fail(errors.Wrap(err, "failed to complete import"))
+		return
+	}
+	if err := p.store.deleteImportBatches(job); err != nil {
+		p.API.LogWarn("Failed to delete import batches", "import_id", job.ID, "error", err.Error())
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveImportColumns(t *testing.T) {
+	header := []string{"Tiêu đề", "priority", "Lĩnh vực", "Extra"}
+
+	columns, err := resolveImportColumns(ImportTypePetitions, header, map[string]string{"title": "tiêu đề", "category": "Lĩnh vực"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"title": 0, "priority": 1, "category": 2}, columns)
+
+	_, err = resolveImportColumns(ImportTypePetitions, header, map[string]string{"title": "Tiêu đề"})
+	assert.EqualError(t, err, "field category is not mapped")
+	_, err = resolveImportColumns(ImportTypePetitions, header, map[string]string{"title": "Missing", "category": "Lĩnh vực"})
+	assert.EqualError(t, err, "column Missing not found")
+	_, err = resolveImportColumns(ImportTypePetitions, header, map[string]string{"bogus": "Extra"})
+	assert.EqualError(t, err, "unknown field bogus")
+}
+
+func TestParseImportTime(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	require.NoError(t, err)
+
+	for _, raw := range []string{"1704042000000", "2024-01-01 00:00:00", "2024-01-01T00:00:00+07:00", "2024-01-01", "01/01/2024"} {
+		millis, err := parseImportTime(raw, location)
+		require.NoError(t, err, raw)
+		assert.Equal(t, int64(1704042000000), millis, raw)
+	}
+	_, err = parseImportTime("yesterday", location)
+	assert.Error(t, err)
+}
+
+// importRequest builds a multipart import upload.
+func importRequest(t *testing.T, userID string, fields map[string]string, data string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, writer.WriteField(name, value))
+	}
+	part, err := writer.CreateFormFile("file", "import.csv")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/imports", &body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Mattermost-User-ID", userID)
+	return r
+}
+
+func TestImportPetitions(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(false)
+	api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice-id", Username: "alice"}, nil)
+	api.On("GetUserByUsername", "ghost").Return(nil, model.NewAppError("GetUserByUsername", "not_found", nil, "", http.StatusNotFound))
+	api.On("GetUserByEmail", "bob@example.com").Return(&model.User{Id: "bob-id", Username: "bob"}, nil)
+	require.NoError(t, p.store.SaveCategory(&Category{ID: "roads", Name: "Giao thông"}))
+
+	data := utf8BOM + "Tiêu đề,Mức độ,Lĩnh vực,Người gửi,Người xử lý,Ngày\n" +
+		"Sửa đường,2,giao thong,alice,bob@example.com,15/03/2023\n" +
+		",,,,,\n" +
+		"Đèn hỏng,9,Điện,ghost,,hôm qua\n" +
+		"Cây đổ,1,roads,,,\n"
+	fields := map[string]string{
+		"type":    ImportTypePetitions,
+		"mapping": `{"title":"Tiêu đề","priority":"Mức độ","category":"Lĩnh vực","creator":"Người gửi","assignee":"Người xử lý","create_at":"Ngày"}`,
+		"tz":      "Asia/Ho_Chi_Minh",
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, importRequest(t, "user1", fields, data))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, importRequest(t, "admin", fields, data))
+	require.Equal(t, http.StatusOK, w.Code)
+	var job ImportJob
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&job))
+	assert.Equal(t, ImportStatusValidated, job.Status)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, 2, job.Valid)
+	assert.Equal(t, []*ImportRowError{
+		{Row: 4, Field: "priority", Message: "priority must be between 1 and 5"},
+		{Row: 4, Field: "category", Message: "unknown category Điện"},
+		{Row: 4, Field: "creator", Message: "unknown user ghost"},
+		{Row: 4, Field: "create_at", Message: "invalid date hôm qua"},
+	}, job.Errors)
+
+	petitions, err := p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Empty(t, petitions, "validation must not create anything")
+
+	w = doRequest(p, http.MethodPost, "/imports/"+job.ID+"/commit", "admin", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/imports/"+job.ID+"/commit?skip_invalid=true", "admin", nil)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Eventually(t, func() bool {
+		current, err := p.store.GetImportJob(job.ID)
+		return err == nil && current.Status == ImportStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	w = doRequest(p, http.MethodGet, "/imports/"+job.ID, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&job))
+	assert.Equal(t, 1, job.Processed)
+	assert.Equal(t, 2, job.Created)
+
+	petitions, err = p.store.GetPetitions()
+	require.NoError(t, err)
+	require.Len(t, petitions, 2)
+	assert.Equal(t, "Sửa đường", petitions[0].Title)
+	assert.Equal(t, "roads", petitions[0].CategoryID)
+	assert.Equal(t, "alice-id", petitions[0].CreatorID)
+	assert.Equal(t, "bob-id", petitions[0].AssigneeID)
+	assert.Equal(t, []string{"alice-id", "bob-id"}, petitions[0].Watchers)
+	assert.Equal(t, int64(1678813200000), petitions[0].CreateAt)
+	assert.Equal(t, "admin", petitions[1].CreatorID)
+
+	w = doRequest(p, http.MethodPost, "/imports/"+job.ID+"/commit", "admin", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(p, http.MethodDelete, "/imports/"+job.ID, "admin", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(p, http.MethodGet, "/imports/"+job.ID, "admin", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestImportResume(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+
+	im, err := p.newImporter(ImportTypeTodos, "admin", "", time.UTC)
+	require.NoError(t, err)
+	data := "message\n"
+	for i := 0; i < importBatchSize+1; i++ {
+		data += "Việc cần làm\n"
+	}
+	job, batches, err := im.validate(bytes.NewReader([]byte(data)), nil)
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	require.NoError(t, p.store.SaveImportJob(job, batches))
+
+	// Simulate a commit interrupted halfway through the first batch.
+	for _, issue := range batches[0].Issues[:10] {
+		require.NoError(t, p.store.SaveIssue(issue))
+	}
+	_, err = p.store.UpdateImportJob(job.ID, func(job *ImportJob) error {
+		job.Status = ImportStatusRunning
+		return nil
+	})
+	require.NoError(t, err)
+
+	w := doRequest(p, http.MethodPost, "/imports/"+job.ID+"/commit", "admin", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	_, err = p.store.UpdateImportJob(job.ID, func(job *ImportJob) error {
+		job.Status = ImportStatusFailed
+		return nil
+	})
+	require.NoError(t, err)
+	w = doRequest(p, http.MethodPost, "/imports/"+job.ID+"/commit", "admin", nil)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Eventually(t, func() bool {
+		current, err := p.store.GetImportJob(job.ID)
+		return err == nil && current.Status == ImportStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	issues, err := p.store.GetIssuesForUser("admin")
+	require.NoError(t, err)
+	assert.Len(t, issues, importBatchSize+1)
+
+	// Records committed before the interruption are not counted again.
+	job, err = p.store.GetImportJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, importBatchSize+1-10, job.Created)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// incomingKeyPrefix prefixes the keys remembering the petition created for each idempotency key.
+const incomingKeyPrefix = "incoming_key_"
+
+// Limits of the fields of petitions submitted through the incoming webhook.
+const (
+	maxIncomingTitleLength   = 256
+	maxIncomingContentLength = 16000
+	maxIncomingKeyLength     = 255
+)
+
+// incomingReservationTTL is how long an idempotency key stays reserved for a petition that was
+// not filed, after which another submission may take the key over.
+const incomingReservationTTL = time.Minute
+
+// defaultIncomingPriority is the priority of submitted petitions that do not state one.
+const defaultIncomingPriority = 3
+
+// incomingRouteAction is the action recorded when a submitted petition is routed to its
+// category's assignee.
+const incomingRouteAction = "Xử lý"
+
+// ErrIdempotencyKeyInUse is returned when a submission reuses the idempotency key of one that is
+// still being processed.
+var ErrIdempotencyKeyInUse = errors.New("a submission with this idempotency key is in progress")
+
+// IncomingSubmitter identifies the citizen who filled in the external form.
+type IncomingSubmitter struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// IncomingPetition is the JSON document accepted by the incoming webhook.
+type IncomingPetition struct {
+	Title     string             `json:"title"`
+	Content   string             `json:"content"`
+	Priority  *int               `json:"priority"`
+	Submitter *IncomingSubmitter `json:"submitter"`
+}
+
+// IsValid checks the submission against the schema of the incoming webhook.
+func (in *IncomingPetition) IsValid() error {
+	if strings.TrimSpace(in.Title) == "" {
+		return newBadRequestError("title is required")
+	}
+	if utf8.RuneCountInString(in.Title) > maxIncomingTitleLength {
+		return newBadRequestError(fmt.Sprintf("title must be at most %d characters", maxIncomingTitleLength))
+	}
+	if utf8.RuneCountInString(in.Content) > maxIncomingContentLength {
+		return newBadRequestError(fmt.Sprintf("content must be at most %d characters", maxIncomingContentLength))
+	}
+	if in.Priority != nil && (*in.Priority < MinPriority || *in.Priority > MaxPriority) {
+		return newBadRequestError(fmt.Sprintf("priority must be between %d and %d", MinPriority, MaxPriority))
+	}
+	if in.Submitter != nil && in.Submitter.Email != "" && !model.IsValidEmail(in.Submitter.Email) {
+		return newBadRequestError("submitter email is invalid")
+	}
+	return nil
+}
+
+// Petition returns the pending petition filed by creatorID under categoryID for the submission.
+// The submitter's details follow the content.
+func (in *IncomingPetition) Petition(categoryID, creatorID string) *Petition {
+	priority := defaultIncomingPriority
+	if in.Priority != nil {
+		priority = *in.Priority
+	}
+
+	content := strings.TrimSpace(in.Content)
+	if in.Submitter != nil {
+		var details []string
+		for _, detail := range []string{in.Submitter.Name, in.Submitter.Email, in.Submitter.Phone} {
+			if detail = strings.TrimSpace(detail); detail != "" {
+				details = append(details, detail)
+			}
+		}
+		if len(details) > 0 {
+			content = strings.TrimSpace(content + "\n\n---\nSubmitted by: " + strings.Join(details, ", "))
+		}
+	}
+
+	now := model.GetMillis()
+	return &Petition{
+		ID:         model.NewId(),
+		Title:      strings.TrimSpace(in.Title),
+		Content:    content,
+		Priority:   priority,
+		CategoryID: categoryID,
+		Status:     StatusPending,
+		CreatorID:  creatorID,
+		Watchers:   []string{},
+		Processes:  []*Process{},
+		Subtasks:   Checklist{},
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+}
+
+// incomingKeyRecord remembers the petition created for an idempotency key.
+type incomingKeyRecord struct {
+	PetitionID string `json:"petition_id"`
+	CreateAt   int64  `json:"create_at"`
+}
+
+// incomingKey hashes idempotency keys, which are chosen by the client, into keys of bounded
+// length.
+func incomingKey(idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(idempotencyKey))
+	return incomingKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// ReserveIdempotencyKey atomically claims idempotencyKey for petitionID. If the key was already
+// claimed, it returns the petition filed for it instead, or ErrIdempotencyKeyInUse while that
+// petition is not filed yet. Claims whose petition was not filed within incomingReservationTTL,
+// such as those of submissions interrupted by a crash, are taken over.
+func (s *Store) ReserveIdempotencyKey(idempotencyKey, petitionID string) (*Petition, error) {
+	var existing *Petition
+	err := modifyJSON(s.kv, incomingKey(idempotencyKey), func(initial []byte) (interface{}, error) {
+		existing = nil
+		now := model.GetMillis()
+		if initial != nil {
+			var record incomingKeyRecord
+			if err := json.Unmarshal(initial, &record); err != nil {
+				return nil, errors.Wrap(err, "failed to decode idempotency key")
+			}
+			petition, err := s.GetPetition(record.PetitionID)
+			if err == nil {
+				existing = petition
+				return nil, nil
+			}
+			if err != ErrNotFound {
+				return nil, err
+			}
+			if now-record.CreateAt < incomingReservationTTL.Milliseconds() {
+				return nil, ErrIdempotencyKeyInUse
+			}
+		}
+		return &incomingKeyRecord{PetitionID: petitionID, CreateAt: now}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// ReleaseIdempotencyKey forgets idempotencyKey, so that a submission that failed may be retried.
+func (s *Store) ReleaseIdempotencyKey(idempotencyKey string) error {
+	return s.kv.Delete(incomingKey(idempotencyKey))
+}
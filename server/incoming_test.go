@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// doIncomingRequest submits body to the incoming webhook with token and idempotencyKey.
+func doIncomingRequest(p *Plugin, token, idempotencyKey, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/incoming/petitions", bytes.NewBufferString(body))
+	if token != "" {
+		r.Header.Set(headerIncomingToken, token)
+	}
+	if idempotencyKey != "" {
+		r.Header.Set(headerIdempotencyKey, idempotencyKey)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	return w
+}
+
+func TestIncomingPetitionAuthentication(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	body := `{"title": "Broken street light"}`
+
+	w := doIncomingRequest(p, "s3cret", "", body)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	category, err := NewCategory("Lighting", "", "")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(category))
+	p.setConfiguration(&configuration{IncomingWebhookToken: "s3cret", IncomingWebhookCategoryID: category.ID})
+
+	w = doIncomingRequest(p, "", "", body)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doIncomingRequest(p, "wrong", "", body)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Bearer tokens never reach the plugin.
+	r := httptest.NewRequest(http.MethodPost, "/incoming/petitions", bytes.NewBufferString(body))
+	r.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// A user session is not enough either.
+	w = doRequest(p, http.MethodPost, "/incoming/petitions", "user1", map[string]string{"title": "Broken street light"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestIncomingPetitionSchema(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	category, err := NewCategory("Lighting", "", "")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(category))
+	p.setConfiguration(&configuration{IncomingWebhookToken: "s3cret", IncomingWebhookCategoryID: category.ID})
+
+	for name, body := range map[string]string{
+		"malformed":       `{"title":`,
+		"missing title":   `{"content": "No title"}`,
+		"unknown field":   `{"title": "Light", "category_id": "other"}`,
+		"wrong type":      `{"title": "Light", "priority": "high"}`,
+		"priority":        `{"title": "Light", "priority": 9}`,
+		"submitter email": `{"title": "Light", "submitter": {"email": "not-an-email"}}`,
+	} {
+		w := doIncomingRequest(p, "s3cret", "", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+
+	petitions, err := p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Empty(t, petitions)
+}
+
+func TestIncomingPetitionCreatesAndRoutes(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetDirectChannel", "officer", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == "dm"
+	})).Return(&model.Post{}, nil).Twice()
+	category, err := NewCategory("Lighting", "", "officer")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(category))
+	p.setConfiguration(&configuration{IncomingWebhookToken: "s3cret", IncomingWebhookCategoryID: category.ID})
+
+	body := `{"title": "Broken street light", "content": "Corner of 5th", "priority": 2, "submitter": {"name": "Lan", "email": "lan@example.com"}}`
+	w := doIncomingRequest(p, "s3cret", "form-42", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+	var petition Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petition))
+	assert.Equal(t, "Broken street light", petition.Title)
+	assert.Equal(t, "Corner of 5th\n\n---\nSubmitted by: Lan, lan@example.com", petition.Content)
+	assert.Equal(t, 2, petition.Priority)
+	assert.Equal(t, category.ID, petition.CategoryID)
+	assert.Equal(t, "bot", petition.CreatorID)
+	assert.Equal(t, "officer", petition.AssigneeID)
+	assert.Equal(t, StatusInProgress, petition.Status)
+
+	// Retrying the submission returns the same petition without filing another.
+	w = doIncomingRequest(p, "s3cret", "form-42", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(headerIdempotentReplayed))
+	var replayed Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&replayed))
+	assert.Equal(t, petition.ID, replayed.ID)
+
+	petitions, err := p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Len(t, petitions, 1)
+
+	// A submission still being processed cannot be replayed.
+	_, err = p.store.ReserveIdempotencyKey("form-43", model.NewId())
+	require.NoError(t, err)
+	w = doIncomingRequest(p, "s3cret", "form-43", body)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// A reservation left behind by an interrupted submission expires.
+	require.NoError(t, setJSON(p.store.kv, incomingKey("form-43"), &incomingKeyRecord{
+		PetitionID: model.NewId(),
+		CreateAt:   model.GetMillis() - incomingReservationTTL.Milliseconds(),
+	}))
+	w = doIncomingRequest(p, "s3cret", "form-43", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(headerIdempotentReplayed))
+	w = doIncomingRequest(p, "s3cret", "form-43", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(headerIdempotentReplayed))
+
+	petitions, err = p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Len(t, petitions, 2)
+}
+
+func TestIncomingPetitionRequiresCategory(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("LogError", "Incoming webhook category is not usable", "category_id", "missing", "error", mock.Anything).Once()
+	p.setConfiguration(&configuration{IncomingWebhookToken: "s3cret", IncomingWebhookCategoryID: "missing"})
+
+	w := doIncomingRequest(p, "s3cret", "", `{"title": "Broken street light"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
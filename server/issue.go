@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	issueKeyPrefix         = "issue_"
+	userIssuesKeyPrefix    = "user_issues_"
+	channelIssuesKeyPrefix = "channel_issues_"
+)
+
+// Names of the per-user issue lists requested by the webapp.
+const (
+	MyListKey  = "my"
+	InListKey  = "in"
+	OutListKey = "out"
+)
+
+// Issue is a todo item created by one user and assigned to another, or to themselves. Issues
+// on a channel's shared list carry the channel's ID and are assigned to whichever member claims
+// them.
+type Issue struct {
+	ID          string    `json:"id"`
+	ChannelID   string    `json:"channel_id,omitempty"`
+	Message     string    `json:"message"`
+	Description string    `json:"description,omitempty"`
+	PostID      string    `json:"post_id,omitempty"`
+	CreatorID   string    `json:"creator_id"`
+	AssigneeID  string    `json:"assignee_id"`
+	Accepted    bool      `json:"accepted"`
+	CreateAt    int64     `json:"create_at"`
+	CompletedAt int64     `json:"completed_at,omitempty"`
+	DueAt       int64     `json:"due_at,omitempty"`
+	Subtasks    Checklist `json:"subtasks"`
+	Completion  int       `json:"completion"`
+}
+
+// involves reports whether userID created or is assigned to the issue. Issues on a channel's
+// shared list involve no one individually, as access to them follows channel membership.
+func (i *Issue) involves(userID string) bool {
+	return i.ChannelID == "" && (i.CreatorID == userID || i.AssigneeID == userID)
+}
+
+// list returns the name of the list the issue belongs to from the point of view of userID, or
+// an empty string if the issue does not appear in any of that user's lists.
+func (i *Issue) list(userID string) string {
+	if i.CompletedAt != 0 {
+		return ""
+	}
+	switch {
+	case i.AssigneeID == userID && (i.Accepted || i.CreatorID == userID):
+		return MyListKey
+	case i.AssigneeID == userID:
+		return InListKey
+	case i.CreatorID == userID:
+		return OutListKey
+	}
+	return ""
+}
+
+func issueKey(id string) string {
+	return issueKeyPrefix + id
+}
+
+func userIssuesKey(userID string) string {
+	return userIssuesKeyPrefix + userID
+}
+
+func channelIssuesKey(channelID string) string {
+	return channelIssuesKeyPrefix + channelID
+}
+
+// indexKeys returns the index keys listing the issue: its channel's shared list, or the lists
+// of its creator and assignee.
+func (i *Issue) indexKeys() []string {
+	if i.ChannelID != "" {
+		return []string{channelIssuesKey(i.ChannelID)}
+	}
+	return []string{userIssuesKey(i.CreatorID), userIssuesKey(i.AssigneeID)}
+}
+
+// NewIssue returns an issue created by creatorID and assigned to assigneeID.
+func NewIssue(message, description, postID, creatorID, assigneeID string) (*Issue, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, newBadRequestError("message is required")
+	}
+	if assigneeID == "" {
+		assigneeID = creatorID
+	}
+
+	return &Issue{
+		ID:          model.NewId(),
+		Message:     message,
+		Description: description,
+		PostID:      postID,
+		CreatorID:   creatorID,
+		AssigneeID:  assigneeID,
+		Accepted:    assigneeID == creatorID,
+		CreateAt:    model.GetMillis(),
+		Subtasks:    Checklist{},
+	}, nil
+}
+
+// NewChannelIssue returns an unclaimed issue created by creatorID on the shared list of
+// channelID.
+func NewChannelIssue(message, description, postID, creatorID, channelID string) (*Issue, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, newBadRequestError("message is required")
+	}
+
+	return &Issue{
+		ID:          model.NewId(),
+		ChannelID:   channelID,
+		Message:     message,
+		Description: description,
+		PostID:      postID,
+		CreatorID:   creatorID,
+		CreateAt:    model.GetMillis(),
+		Subtasks:    Checklist{},
+	}, nil
+}
+
+// SaveIssue stores a new issue and indexes it for its creator and assignee, or for its channel.
+func (s *Store) SaveIssue(issue *Issue) error {
+	if err := setJSON(s.kv, issueKey(issue.ID), issue); err != nil {
+		return err
+	}
+	for _, key := range issue.indexKeys() {
+		if err := addToIndex(s.kv, key, issue.ID); err != nil {
+			return errors.Wrap(err, "failed to index issue")
+		}
+	}
+	s.notifyChange(KindIssue, issue.ID)
+	return nil
+}
+
+// GetIssue returns the issue with the given ID.
+func (s *Store) GetIssue(id string) (*Issue, error) {
+	var issue Issue
+	found, err := getJSON(s.kv, issueKey(id), &issue)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &issue, nil
+}
+
+// UpdateIssue atomically applies fn to the issue with the given ID and returns the result.
+func (s *Store) UpdateIssue(id string, fn func(*Issue) error) (*Issue, error) {
+	var previous *Issue
+	var updated *Issue
+	err := modifyJSON(s.kv, issueKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var issue Issue
+		if err := json.Unmarshal(initial, &issue); err != nil {
+			return nil, errors.Wrap(err, "failed to decode issue")
+		}
+		previous = &Issue{CreatorID: issue.CreatorID, AssigneeID: issue.AssigneeID}
+		if err := fn(&issue); err != nil {
+			return nil, err
+		}
+		issue.Completion = issue.Subtasks.Completion()
+		updated = &issue
+		return &issue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if updated.ChannelID == "" && previous.AssigneeID != updated.AssigneeID {
+		if previous.AssigneeID != updated.CreatorID {
+			if err := removeFromIndex(s.kv, userIssuesKey(previous.AssigneeID), id); err != nil {
+				return nil, errors.Wrap(err, "failed to unindex issue")
+			}
+		}
+		if err := addToIndex(s.kv, userIssuesKey(updated.AssigneeID), id); err != nil {
+			return nil, errors.Wrap(err, "failed to index issue")
+		}
+	}
+
+	s.notifyChange(KindIssue, id)
+	return updated, nil
+}
+
+// DeleteIssue removes the issue with the given ID.
+func (s *Store) DeleteIssue(issue *Issue) error {
+	for _, key := range issue.indexKeys() {
+		if err := removeFromIndex(s.kv, key, issue.ID); err != nil {
+			return errors.Wrap(err, "failed to unindex issue")
+		}
+	}
+	if err := s.kv.Delete(issueKey(issue.ID)); err != nil {
+		return err
+	}
+	s.notifyChange(KindIssue, issue.ID)
+	return nil
+}
+
+// GetAllIssues returns every issue of every user and channel.
+func (s *Store) GetAllIssues() ([]*Issue, error) {
+	keys, err := s.listKeysWithPrefix(issueKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]*Issue, 0, len(keys))
+	for _, key := range keys {
+		issue, err := s.GetIssue(strings.TrimPrefix(key, issueKeyPrefix))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// GetIssuesForUser returns every issue created by or assigned to userID, oldest first.
+func (s *Store) GetIssuesForUser(userID string) ([]*Issue, error) {
+	return s.getIndexedIssues(userIssuesKey(userID))
+}
+
+// GetChannelIssues returns every issue on the shared list of channelID, oldest first.
+func (s *Store) GetChannelIssues(channelID string) ([]*Issue, error) {
+	return s.getIndexedIssues(channelIssuesKey(channelID))
+}
+
+func (s *Store) getIndexedIssues(indexKey string) ([]*Issue, error) {
+	ids, err := getIndex(s.kv, indexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]*Issue, 0, len(ids))
+	for _, id := range ids {
+		issue, err := s.GetIssue(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// maxAtomicRetries bounds the number of compare-and-set attempts made by modifyJSON before
+// giving up on a heavily contended key.
+const maxAtomicRetries = 10
+
+// ErrNotFound is returned by the stores when a record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// KVStore is the subset of key-value operations the plugin relies on. It is satisfied by the
+// Mattermost plugin API and, in tests, by an in-memory implementation. CompareAndSet deletes the
+// key when newValue is nil.
+type KVStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	CompareAndSet(key string, oldValue, newValue []byte) (bool, error)
+	Delete(key string) error
+	ListKeys(page, perPage int) ([]string, error)
+}
+
+// pluginKVStore implements KVStore on top of the Mattermost plugin API.
+type pluginKVStore struct {
+	api plugin.API
+}
+
+// NewPluginKVStore returns a KVStore backed by the plugin API's key-value store.
+func NewPluginKVStore(api plugin.API) KVStore {
+	return &pluginKVStore{api: api}
+}
+
+func (s *pluginKVStore) Get(key string) ([]byte, error) {
+	data, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get key %s", key)
+	}
+	return data, nil
+}
+
+func (s *pluginKVStore) Set(key string, value []byte) error {
+	if appErr := s.api.KVSet(key, value); appErr != nil {
+		return errors.Wrapf(appErr, "failed to set key %s", key)
+	}
+	return nil
+}
+
+func (s *pluginKVStore) CompareAndSet(key string, oldValue, newValue []byte) (bool, error) {
+	ok, appErr := s.api.KVCompareAndSet(key, oldValue, newValue)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to compare and set key %s", key)
+	}
+	return ok, nil
+}
+
+func (s *pluginKVStore) Delete(key string) error {
+	if appErr := s.api.KVDelete(key); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete key %s", key)
+	}
+	return nil
+}
+
+func (s *pluginKVStore) ListKeys(page, perPage int) ([]string, error) {
+	keys, appErr := s.api.KVList(page, perPage)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to list keys")
+	}
+	return keys, nil
+}
+
+// getJSON loads the value stored under key into v. It reports whether the key existed.
+func getJSON(kv KVStore, key string, v interface{}) (bool, error) {
+	data, err := kv.Get(key)
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, errors.Wrapf(err, "failed to decode key %s", key)
+	}
+	return true, nil
+}
+
+// setJSON stores v under key.
+func setJSON(kv KVStore, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode key %s", key)
+	}
+	return kv.Set(key, data)
+}
+
+// modifyJSON atomically applies fn to the value stored under key, retrying on concurrent
+// modification. fn receives nil if the key does not exist and returns the value to store; a nil
+// return value leaves the key untouched.
+func modifyJSON(kv KVStore, key string, fn func(initial []byte) (interface{}, error)) error {
+	for i := 0; i < maxAtomicRetries; i++ {
+		initial, err := kv.Get(key)
+		if err != nil {
+			return err
+		}
+
+		updated, err := fn(initial)
+		if err != nil {
+			return err
+		}
+		if updated == nil {
+			return nil
+		}
+
+		data, err := json.Marshal(updated)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode key %s", key)
+		}
+		if bytes.Equal(initial, data) {
+			return nil
+		}
+
+		ok, err := kv.CompareAndSet(key, initial, data)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+
+	return errors.Errorf("failed to modify key %s: too many concurrent updates", key)
+}
+
+// addToIndex atomically appends id to the list of IDs stored under key, if absent.
+func addToIndex(kv KVStore, key, id string) error {
+	return modifyJSON(kv, key, func(initial []byte) (interface{}, error) {
+		var ids []string
+		if initial != nil {
+			if err := json.Unmarshal(initial, &ids); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode index %s", key)
+			}
+		}
+		for _, existing := range ids {
+			if existing == id {
+				return nil, nil
+			}
+		}
+		return append(ids, id), nil
+	})
+}
+
+// removeFromIndex atomically removes id from the list of IDs stored under key.
+func removeFromIndex(kv KVStore, key, id string) error {
+	return modifyJSON(kv, key, func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, nil
+		}
+		var ids []string
+		if err := json.Unmarshal(initial, &ids); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode index %s", key)
+		}
+		for i, existing := range ids {
+			if existing == id {
+				return append(ids[:i], ids[i+1:]...), nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+// getIndex returns the list of IDs stored under key.
+func getIndex(kv KVStore, key string) ([]string, error) {
+	var ids []string
+	if _, err := getJSON(kv, key, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
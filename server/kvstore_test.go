@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memKVStore is an in-memory KVStore used by tests.
+type memKVStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemKVStore() *memKVStore {
+	return &memKVStore{data: map[string][]byte{}}
+}
+
+func (s *memKVStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key], nil
+}
+
+func (s *memKVStore) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == nil {
+		delete(s.data, key)
+		return nil
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *memKVStore) CompareAndSet(key string, oldValue, newValue []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.data[key]
+	if (oldValue == nil && ok) || (oldValue != nil && !bytes.Equal(current, oldValue)) {
+		return false, nil
+	}
+	if newValue == nil {
+		delete(s.data, key)
+		return true, nil
+	}
+	s.data[key] = newValue
+	return true, nil
+}
+
+func (s *memKVStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memKVStore) ListKeys(page, perPage int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	start := page * perPage
+	if start >= len(keys) {
+		return []string{}, nil
+	}
+	end := start + perPage
+	if end > len(keys) {
+		end = len(keys)
+	}
+	return keys[start:end], nil
+}
+
+func TestIndex(t *testing.T) {
+	kv := newMemKVStore()
+
+	require.NoError(t, addToIndex(kv, "index", "a"))
+	require.NoError(t, addToIndex(kv, "index", "b"))
+	require.NoError(t, addToIndex(kv, "index", "a"))
+
+	ids, err := getIndex(kv, "index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	require.NoError(t, removeFromIndex(kv, "index", "a"))
+	require.NoError(t, removeFromIndex(kv, "index", "missing"))
+
+	ids, err = getIndex(kv, "index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids)
+}
+
+func TestModifyJSONConcurrent(t *testing.T) {
+	kv := newMemKVStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, modifyJSON(kv, "counter", func(initial []byte) (interface{}, error) {
+				var n int
+				if initial != nil {
+					n = int(initial[0] - '0')
+				}
+				return n + 1, nil
+			}))
+		}()
+	}
+	wg.Wait()
+
+	data, err := kv.Get("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "5", string(data))
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// Kinds of legacy records mapped to plugin records.
+const (
+	legacyKindPetition = "petition"
+	legacyKindCategory = "category"
+)
+
+const legacyKeyPrefix = "legacy_"
+
+// maxLegacyLineSize bounds the size of a single record of a legacy dump.
+const maxLegacyLineSize = 16 * 1024 * 1024
+
+// legacyStatuses maps the folded statuses of the legacy backend to petition statuses. Other
+// legacy statuses name a processing stage and are migrated as in progress.
+var legacyStatuses = map[string]string{
+	"moi":           StatusPending,
+	"cho xu ly":     StatusPending,
+	"chua xu ly":    StatusPending,
+	"tiep nhan":     StatusPending,
+	"hoan thanh":    StatusResolved,
+	"da xu ly":      StatusResolved,
+	"da giai quyet": StatusResolved,
+	"tu choi":       StatusRejected,
+	"da tu choi":    StatusRejected,
+}
+
+// legacyID is a document ID of the legacy backend, given either as a string or in MongoDB
+// extended JSON.
+type legacyID string
+
+func (id *legacyID) UnmarshalJSON(data []byte) error {
+	var oid struct {
+		OID string `json:"$oid"`
+	}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &oid); err != nil {
+			return err
+		}
+		*id = legacyID(oid.OID)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*id = legacyID(s)
+	return nil
+}
+
+// legacyTime is a timestamp in Unix milliseconds, given either as a number, as an ISO 8601
+// string or in MongoDB extended JSON.
+type legacyTime int64
+
+func (t *legacyTime) UnmarshalJSON(data []byte) error {
+	switch {
+	case string(data) == "null":
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		var wrapped struct {
+			Date       json.RawMessage `json:"$date"`
+			NumberLong string          `json:"$numberLong"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return err
+		}
+		if wrapped.NumberLong != "" {
+			return t.UnmarshalJSON([]byte(wrapped.NumberLong))
+		}
+		return t.UnmarshalJSON(wrapped.Date)
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return errors.Errorf("invalid date %s", s)
+		}
+		*t = legacyTime(parsed.UnixMilli())
+		return nil
+	}
+	millis, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid date %s", data)
+	}
+	*t = legacyTime(millis)
+	return nil
+}
+
+// legacyInt is a number the legacy backend may store as a string.
+type legacyInt int
+
+func (n *legacyInt) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Atoi(strings.Trim(string(data), `"`))
+	if err != nil {
+		return errors.Errorf("invalid number %s", data)
+	}
+	*n = legacyInt(value)
+	return nil
+}
+
+// unmarshalLegacyRef decodes a reference that legacy dumps hold either as a bare ID or as the
+// populated document.
+func unmarshalLegacyRef(data []byte, id *legacyID, doc interface{}) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, doc); err != nil {
+			return err
+		}
+		// A document holding only an ObjectID is a bare ID in extended JSON.
+		if *id == "" {
+			return json.Unmarshal(data, id)
+		}
+		return nil
+	}
+	return json.Unmarshal(data, id)
+}
+
+type legacyPerson struct {
+	ID       legacyID `json:"_id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+}
+
+func (p *legacyPerson) UnmarshalJSON(data []byte) error {
+	type plain legacyPerson
+	return unmarshalLegacyRef(data, &p.ID, (*plain)(p))
+}
+
+type legacyCategory struct {
+	ID          legacyID `json:"_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+}
+
+func (c *legacyCategory) UnmarshalJSON(data []byte) error {
+	type plain legacyCategory
+	return unmarshalLegacyRef(data, &c.ID, (*plain)(c))
+}
+
+type legacyAction struct {
+	ID         legacyID `json:"_id"`
+	ActionName string   `json:"actionName"`
+}
+
+func (a *legacyAction) UnmarshalJSON(data []byte) error {
+	type plain legacyAction
+	return unmarshalLegacyRef(data, &a.ID, (*plain)(a))
+}
+
+type legacyProcess struct {
+	People      legacyPerson `json:"people"`
+	Action      legacyAction `json:"action"`
+	CreatedDate legacyTime   `json:"createdDate"`
+	CreatedAt   legacyTime   `json:"createdAt"`
+}
+
+// legacyPetition is a petition as stored by the legacy backend.
+type legacyPetition struct {
+	ID          legacyID        `json:"_id"`
+	Title       string          `json:"title"`
+	Content     string          `json:"content"`
+	Priority    legacyInt       `json:"priority"`
+	Category    legacyCategory  `json:"category"`
+	Status      string          `json:"status"`
+	People      legacyPerson    `json:"people"`
+	Processes   []legacyProcess `json:"processes"`
+	CreatedDate legacyTime      `json:"createdDate"`
+	CreatedAt   legacyTime      `json:"createdAt"`
+	UpdatedDate legacyTime      `json:"updatedDate"`
+	UpdatedAt   legacyTime      `json:"updatedAt"`
+}
+
+// firstTime returns the first non-zero timestamp.
+func firstTime(times ...legacyTime) int64 {
+	for _, t := range times {
+		if t != 0 {
+			return int64(t)
+		}
+	}
+	return 0
+}
+
+// legacyStatus returns the petition status matching a legacy status.
+func legacyStatus(status string, forwarded bool) string {
+	folded := foldText(strings.TrimSpace(status))
+	if isValidStatus(folded) {
+		return folded
+	}
+	if mapped, ok := legacyStatuses[folded]; ok {
+		return mapped
+	}
+	if folded == "" && !forwarded {
+		return StatusPending
+	}
+	return StatusInProgress
+}
+
+func legacyKey(kind, id string) string {
+	return legacyKeyPrefix + kind + "_" + id
+}
+
+// getLegacyMapping returns the plugin ID a legacy record was migrated to, or an empty string.
+func (s *Store) getLegacyMapping(kind, legacyID string) (string, error) {
+	var id string
+	if _, err := getJSON(s.kv, legacyKey(kind, legacyID), &id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// claimLegacyMapping returns the plugin ID a legacy record is migrated to, mapping it to a new
+// ID on first use. The mapping is recorded before the record is created, so a migration
+// interrupted in between recreates the record under the same ID when run again.
+func (s *Store) claimLegacyMapping(kind, legacyID string) (string, error) {
+	var id string
+	err := modifyJSON(s.kv, legacyKey(kind, legacyID), func(initial []byte) (interface{}, error) {
+		if initial != nil {
+			return nil, json.Unmarshal(initial, &id)
+		}
+		id = model.NewId()
+		return id, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// LegacyMigrationError explains why a record of a legacy dump was not migrated. Lines are
+// numbered from 1.
+type LegacyMigrationError struct {
+	Line     int    `json:"line"`
+	LegacyID string `json:"legacy_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LegacyMigrationReport summarizes a migration run. Skipped counts the records migrated by an
+// earlier run.
+type LegacyMigrationReport struct {
+	DryRun     bool                    `json:"dry_run"`
+	Total      int                     `json:"total"`
+	Created    int                     `json:"created"`
+	Skipped    int                     `json:"skipped"`
+	Categories int                     `json:"categories"`
+	Errors     []*LegacyMigrationError `json:"errors"`
+}
+
+// legacyMigrator ingests legacy petitions, caching the users and categories it resolves.
+// Categories are cached both by legacy ID and by folded name.
+type legacyMigrator struct {
+	plugin           *Plugin
+	teamID           string
+	dryRun           bool
+	report           *LegacyMigrationReport
+	users            map[legacyID]string
+	categories       map[string]string
+	legacyCategories map[legacyID]string
+}
+
+func (p *Plugin) newLegacyMigrator(teamID string, dryRun bool) (*legacyMigrator, error) {
+	categories, err := p.store.GetCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load categories")
+	}
+
+	m := &legacyMigrator{
+		plugin:           p,
+		teamID:           teamID,
+		dryRun:           dryRun,
+		report:           &LegacyMigrationReport{DryRun: dryRun, Errors: []*LegacyMigrationError{}},
+		users:            map[legacyID]string{},
+		categories:       make(map[string]string, len(categories)),
+		legacyCategories: map[legacyID]string{},
+	}
+	for _, category := range categories {
+		m.categories[foldText(category.Name)] = category.ID
+	}
+	return m, nil
+}
+
+// resolveUser returns the Mattermost user matching a legacy user by username, then by email.
+func (m *legacyMigrator) resolveUser(person legacyPerson) (string, error) {
+	if person.ID == "" && person.Username == "" && person.Email == "" {
+		return "", newBadRequestError("missing user")
+	}
+	if userID, ok := m.users[person.ID]; ok {
+		return userID, nil
+	}
+
+	lookups := []struct {
+		value string
+		get   func(string) (*model.User, *model.AppError)
+	}{
+		{person.Username, m.plugin.API.GetUserByUsername},
+		{person.Email, m.plugin.API.GetUserByEmail},
+	}
+	for _, lookup := range lookups {
+		if lookup.value == "" {
+			continue
+		}
+		user, appErr := lookup.get(strings.ToLower(lookup.value))
+		if appErr == nil {
+			if person.ID != "" {
+				m.users[person.ID] = user.Id
+			}
+			return user.Id, nil
+		}
+		if appErr.StatusCode != http.StatusNotFound {
+			return "", errors.Wrap(appErr, "failed to get user")
+		}
+	}
+
+	ref := person.Username
+	if ref == "" {
+		ref = person.Email
+	}
+	if ref == "" {
+		ref = string(person.ID)
+	}
+	return "", newBadRequestError("no Mattermost user matches legacy user " + ref)
+}
+
+// resolveCategory returns the category a legacy category was migrated to, or the existing
+// category with the same name. Missing categories are created.
+func (m *legacyMigrator) resolveCategory(legacy legacyCategory) (string, error) {
+	store := m.plugin.store
+	name := strings.TrimSpace(legacy.Description)
+	if name == "" {
+		name = strings.TrimSpace(legacy.Name)
+	}
+
+	if id, ok := m.legacyCategories[legacy.ID]; ok {
+		return id, nil
+	}
+	if legacy.ID != "" {
+		id, err := store.getLegacyMapping(legacyKindCategory, string(legacy.ID))
+		if err != nil {
+			return "", err
+		}
+		if id != "" {
+			if _, err := store.GetCategory(id); err == nil {
+				return id, nil
+			} else if err != ErrNotFound {
+				return "", err
+			}
+		}
+	}
+	if id, ok := m.categories[foldText(name)]; ok && name != "" {
+		return id, nil
+	}
+	if name == "" {
+		return "", newBadRequestError("unknown legacy category " + string(legacy.ID))
+	}
+
+	id := model.NewId()
+	if !m.dryRun {
+		var err error
+		if legacy.ID != "" {
+			if id, err = store.claimLegacyMapping(legacyKindCategory, string(legacy.ID)); err != nil {
+				return "", err
+			}
+		}
+		category := &Category{ID: id, Name: name, CreateAt: model.GetMillis()}
+		if err := store.SaveCategory(category); err != nil {
+			return "", err
+		}
+	}
+	m.categories[foldText(name)] = id
+	if legacy.ID != "" {
+		m.legacyCategories[legacy.ID] = id
+	}
+	m.report.Categories++
+	return id, nil
+}
+
+// convert validates a legacy petition and returns it as a petition without an ID.
+func (m *legacyMigrator) convert(legacy *legacyPetition) (*Petition, error) {
+	creatorID, err := m.resolveUser(legacy.People)
+	if err != nil {
+		return nil, err
+	}
+	categoryID, err := m.resolveCategory(legacy.Category)
+	if err != nil {
+		return nil, err
+	}
+
+	createAt := firstTime(legacy.CreatedDate, legacy.CreatedAt)
+	if createAt == 0 {
+		createAt = model.GetMillis()
+	}
+	petition := &Petition{
+		TeamID:     m.teamID,
+		Title:      strings.TrimSpace(legacy.Title),
+		Content:    legacy.Content,
+		Priority:   int(legacy.Priority),
+		CategoryID: categoryID,
+		Status:     legacyStatus(legacy.Status, len(legacy.Processes) > 0),
+		CreatorID:  creatorID,
+		Watchers:   []string{creatorID},
+		Processes:  []*Process{},
+		Subtasks:   Checklist{},
+		CreateAt:   createAt,
+	}
+
+	// Each legacy process names the user who received the petition; the sender is the previous
+	// recipient, starting from the creator.
+	actorID := creatorID
+	for _, process := range legacy.Processes {
+		userID, err := m.resolveUser(process.People)
+		if err != nil {
+			return nil, err
+		}
+		action := process.Action.ActionName
+		if action == "" {
+			action = string(process.Action.ID)
+		}
+		processAt := firstTime(process.CreatedDate, process.CreatedAt)
+		if processAt == 0 {
+			processAt = createAt
+		}
+		petition.Processes = append(petition.Processes, &Process{
+			ActorID:  actorID,
+			UserID:   userID,
+			Action:   action,
+			CreateAt: processAt,
+		})
+		petition.AssigneeID = userID
+		petition.Watch(userID)
+		actorID = userID
+	}
+
+	petition.UpdateAt = firstTime(legacy.UpdatedDate, legacy.UpdatedAt)
+	if petition.UpdateAt == 0 {
+		petition.UpdateAt = createAt
+		if n := len(petition.Processes); n > 0 {
+			petition.UpdateAt = petition.Processes[n-1].CreateAt
+		}
+	}
+
+	// Legacy petitions carry no status history: handling is taken to start with the first
+	// forwarding, and a closed petition to be closed at its last update.
+	if petition.Status != StatusPending {
+		switch {
+		case len(petition.Processes) > 0:
+			petition.StatusHistory = append(petition.StatusHistory, &StatusChange{Status: StatusInProgress, CreateAt: petition.Processes[0].CreateAt})
+		case petition.Status == StatusInProgress:
+			petition.StatusHistory = append(petition.StatusHistory, &StatusChange{Status: StatusInProgress, CreateAt: petition.UpdateAt})
+		}
+		if !petition.IsOpen() {
+			petition.StatusHistory = append(petition.StatusHistory, &StatusChange{Status: petition.Status, CreateAt: petition.UpdateAt})
+		}
+	}
+
+	if err := petition.IsValid(); err != nil {
+		return nil, err
+	}
+	return petition, nil
+}
+
+// migrate ingests one legacy petition, reporting whether it was migrated by an earlier run.
+func (m *legacyMigrator) migrate(legacy *legacyPetition) (skipped bool, err error) {
+	store := m.plugin.store
+
+	id, err := store.getLegacyMapping(legacyKindPetition, string(legacy.ID))
+	if err != nil {
+		return false, err
+	}
+	if id != "" {
+		if _, err := store.GetPetition(id); err == nil {
+			return true, nil
+		} else if err != ErrNotFound {
+			return false, err
+		}
+	}
+
+	petition, err := m.convert(legacy)
+	if err != nil {
+		return false, err
+	}
+	if m.dryRun {
+		return false, nil
+	}
+
+	if petition.ID, err = store.claimLegacyMapping(legacyKindPetition, string(legacy.ID)); err != nil {
+		return false, err
+	}
+	return false, store.SavePetition(petition)
+}
+
+// run migrates every petition of a JSONL dump. Invalid records are reported and skipped;
+// storage failures abort the run, which may safely be repeated.
+func (m *legacyMigrator) run(r io.Reader) (*LegacyMigrationReport, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLegacyLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if line == 1 {
+			data = bytes.TrimPrefix(data, []byte(utf8BOM))
+		}
+		if len(data) == 0 {
+			continue
+		}
+		m.report.Total++
+
+		var legacy legacyPetition
+		err := json.Unmarshal(data, &legacy)
+		if err == nil && legacy.ID == "" {
+			err = newBadRequestError("missing _id")
+		}
+		if err != nil {
+			m.fail(line, &legacy, errors.Wrap(err, "invalid record"))
+			continue
+		}
+
+		skipped, err := m.migrate(&legacy)
+		var badRequest *badRequestError
+		switch {
+		case errors.As(err, &badRequest):
+			m.fail(line, &legacy, err)
+		case err != nil:
+			return nil, errors.Wrapf(err, "failed to migrate line %d", line)
+		case skipped:
+			m.report.Skipped++
+		default:
+			m.report.Created++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return nil, newBadRequestError(fmt.Sprintf("line %d is too long", line+1))
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, ErrImportTooLarge
+		}
+		return nil, errors.Wrap(err, "failed to read dump")
+	}
+	return m.report, nil
+}
+
+func (m *legacyMigrator) fail(line int, legacy *legacyPetition, err error) {
+	if len(m.report.Errors) < maxImportErrors {
+		m.report.Errors = append(m.report.Errors, &LegacyMigrationError{
+			Line:     line,
+			LegacyID: string(legacy.ID),
+			Message:  err.Error(),
+		})
+	}
+}
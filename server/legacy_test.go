@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyTime(t *testing.T) {
+	for _, raw := range []string{`1704067200000`, `"2024-01-01T00:00:00.000Z"`, `{"$date":"2024-01-01T07:00:00+07:00"}`, `{"$date":{"$numberLong":"1704067200000"}}`} {
+		var value legacyTime
+		require.NoError(t, json.Unmarshal([]byte(raw), &value), raw)
+		assert.Equal(t, legacyTime(1704067200000), value, raw)
+	}
+
+	var value legacyTime
+	assert.Error(t, json.Unmarshal([]byte(`"yesterday"`), &value))
+}
+
+func TestLegacyStatus(t *testing.T) {
+	assert.Equal(t, StatusPending, legacyStatus("", false))
+	assert.Equal(t, StatusInProgress, legacyStatus("", true))
+	assert.Equal(t, StatusInProgress, legacyStatus("Bien tap", true))
+	assert.Equal(t, StatusResolved, legacyStatus("Hoàn thành", true))
+	assert.Equal(t, StatusRejected, legacyStatus("Từ chối", true))
+	assert.Equal(t, StatusResolved, legacyStatus("resolved", true))
+}
+
+func migrateLegacy(p *Plugin, query, dump string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/imports/legacy"+query, strings.NewReader(dump))
+	r.Header.Set("Mattermost-User-ID", "admin")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	return w
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	notFound := model.NewAppError("GetUser", "not_found", nil, "", http.StatusNotFound)
+	api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+	api.On("GetUserByUsername", "username1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetUserByUsername", "username2").Return(nil, notFound)
+	api.On("GetUserByEmail", "two@example.com").Return(&model.User{Id: "user2"}, nil)
+	api.On("GetUserByUsername", "ghost").Return(nil, notFound)
+
+	dump := strings.Join([]string{
+		`{"_id":{"$oid":"65a000000000000000000001"},"title":"Sửa đường","content":"Đường hỏng","priority":"2",` +
+			`"category":{"_id":"c1","description":"Giao thông"},"status":"Bien tap",` +
+			`"people":{"_id":"u1","username":"username1"},"createdDate":{"$date":"2024-01-01T00:00:00Z"},` +
+			`"processes":[{"people":{"_id":"u2","username":"username2","email":"two@example.com"},"action":{"_id":"a1","actionName":"Xử lý"},"createdDate":"2024-01-02T00:00:00Z"}]}`,
+		``,
+		`{"_id":"65a000000000000000000002","title":"Đèn hỏng","priority":1,"category":"c1","people":"u1","createdDate":1704240000000}`,
+		`{"_id":"65a000000000000000000003","title":"Cây đổ","priority":3,"category":{"_id":"c1","description":"Giao thông"},"people":{"_id":"u9","username":"ghost"}}`,
+		`{"request_id":"user-001","title":"Not a petition"}`,
+	}, "\n")
+
+	w := migrateLegacy(p, "?dry_run=true", dump)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report LegacyMigrationReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Categories)
+	require.Len(t, report.Errors, 2)
+	assert.Equal(t, &LegacyMigrationError{Line: 4, LegacyID: "65a000000000000000000003", Message: "no Mattermost user matches legacy user ghost"}, report.Errors[0])
+	assert.Equal(t, 5, report.Errors[1].Line)
+
+	petitions, err := p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Empty(t, petitions)
+	categories, err := p.store.GetCategories()
+	require.NoError(t, err)
+	assert.Empty(t, categories)
+
+	w = migrateLegacy(p, "?team_id=team1", dump)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 0, report.Skipped)
+
+	categories, err = p.store.GetCategories()
+	require.NoError(t, err)
+	require.Len(t, categories, 1)
+	assert.Equal(t, "Giao thông", categories[0].Name)
+
+	petitions, err = p.store.GetPetitions()
+	require.NoError(t, err)
+	require.Len(t, petitions, 2)
+	first := petitions[0]
+	assert.Equal(t, "Sửa đường", first.Title)
+	assert.Equal(t, "team1", first.TeamID)
+	assert.Equal(t, 2, first.Priority)
+	assert.Equal(t, categories[0].ID, first.CategoryID)
+	assert.Equal(t, StatusInProgress, first.Status)
+	assert.Equal(t, "user1", first.CreatorID)
+	assert.Equal(t, "user2", first.AssigneeID)
+	assert.Equal(t, int64(1704067200000), first.CreateAt)
+	assert.Equal(t, int64(1704153600000), first.UpdateAt)
+	assert.Equal(t, []*Process{{ActorID: "user1", UserID: "user2", Action: "Xử lý", CreateAt: 1704153600000}}, first.Processes)
+	assert.Equal(t, []string{"user1", "user2"}, first.Watchers)
+	assert.Equal(t, []*StatusChange{{Status: StatusInProgress, CreateAt: 1704153600000}}, first.StatusHistory)
+	assert.Empty(t, petitions[1].StatusHistory)
+	assert.Equal(t, StatusPending, petitions[1].Status)
+	assert.Equal(t, categories[0].ID, petitions[1].CategoryID)
+
+	w = migrateLegacy(p, "", dump)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, 0, report.Created)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 0, report.Categories)
+
+	petitions, err = p.store.GetPetitions()
+	require.NoError(t, err)
+	assert.Len(t, petitions, 2)
+
+	w = migrateLegacy(p, "?dry_run=true", strings.Repeat("\n", maxImportSize+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsNamespace prefixes the names of the plugin's metrics.
+const metricsNamespace = "xlkn"
+
+// Histogram buckets, in seconds, of request and job durations.
+var (
+	requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	jobDurationBuckets     = []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600}
+)
+
+// Types of metric families, as named by the Prometheus text format.
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// metricSeries is the value of a metric family for one combination of label values.
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// counts holds the cumulative count of each bucket of a histogram.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// metricFamily is a metric and its series, keyed by their joined label values.
+type metricFamily struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+	series     map[string]*metricSeries
+}
+
+func (f *metricFamily) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: labelValues}
+		if f.kind == metricHistogram {
+			series.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = series
+	}
+	return series
+}
+
+func (f *metricFamily) observe(value float64, labelValues ...string) {
+	series := f.get(labelValues)
+	for i, bound := range f.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatLabels renders label pairs, followed by an optional extra pair, as "{a="x",b="y"}".
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (f *metricFamily) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := f.series[key]
+		if f.kind != metricHistogram {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, series.labelValues, "", ""), formatFloat(series.value)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			labels := formatLabels(f.labelNames, series.labelValues, "le", formatFloat(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels, series.counts[i]); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(f.labelNames, series.labelValues, "", "")
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, formatLabels(f.labelNames, series.labelValues, "le", "+Inf"), series.count,
+			f.name, labels, formatFloat(series.sum),
+			f.name, labels, series.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metrics collects the plugin's operational metrics in memory and renders them in the
+// Prometheus text format. Each cluster node reports its own.
+type metrics struct {
+	mu       sync.Mutex
+	families []*metricFamily
+
+	httpRequests    *metricFamily
+	httpDuration    *metricFamily
+	kvOperations    *metricFamily
+	kvErrors        *metricFamily
+	jobDuration     *metricFamily
+	queueSize       *metricFamily
+	websocketEvents *metricFamily
+}
+
+func newMetrics() *metrics {
+	m := &metrics{}
+	family := func(name, help, kind string, buckets []float64, labelNames ...string) *metricFamily {
+		f := &metricFamily{
+			name:       metricsNamespace + "_" + name,
+			help:       help,
+			kind:       kind,
+			labelNames: labelNames,
+			buckets:    buckets,
+			series:     map[string]*metricSeries{},
+		}
+		m.families = append(m.families, f)
+		return f
+	}
+	m.httpRequests = family("http_requests_total", "HTTP requests served, by route, method and status code.", metricCounter, nil, "route", "method", "status")
+	m.httpDuration = family("http_request_duration_seconds", "Latency of HTTP requests, by route and method.", metricHistogram, requestDurationBuckets, "route", "method")
+	m.kvOperations = family("kv_operations_total", "Key-value store operations, by operation.", metricCounter, nil, "operation")
+	m.kvErrors = family("kv_errors_total", "Failed key-value store operations, by operation.", metricCounter, nil, "operation")
+	m.jobDuration = family("job_duration_seconds", "Duration of background job runs, by job.", metricHistogram, jobDurationBuckets, "job")
+	m.queueSize = family("queue_size", "Items waiting in background queues, by queue.", metricGauge, nil, "queue")
+	m.websocketEvents = family("websocket_events_total", "WebSocket events published, by event.", metricCounter, nil, "event")
+	return m
+}
+
+// ObserveRequest records an HTTP request served by route.
+func (m *metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpRequests.get([]string{route, method, strconv.Itoa(status)}).value++
+	m.httpDuration.observe(elapsed.Seconds(), route, method)
+}
+
+// ObserveKVOperation records a key-value store operation and whether it failed.
+func (m *metrics) ObserveKVOperation(operation string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kvOperations.get([]string{operation}).value++
+	if err != nil {
+		m.kvErrors.get([]string{operation}).value++
+	}
+}
+
+// ObserveJob records the duration of a background job run.
+func (m *metrics) ObserveJob(job string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobDuration.observe(elapsed.Seconds(), job)
+}
+
+// AddQueueSize adjusts the number of items waiting in queue by delta.
+func (m *metrics) AddQueueSize(queue string, delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueSize.get([]string{queue}).value += float64(delta)
+}
+
+// SetQueueSize records the number of items waiting in queue.
+func (m *metrics) SetQueueSize(queue string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queueSize.get([]string{queue}).value = float64(size)
+}
+
+// IncWebSocketEvent records the publication of a WebSocket event.
+func (m *metrics) IncWebSocketEvent(event string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.websocketEvents.get([]string{event}).value++
+}
+
+// Write renders every metric in the Prometheus text format.
+func (m *metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, family := range m.families {
+		if err := family.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instrumentedKVStore is a KVStore counting the operations of the wrapped store.
+type instrumentedKVStore struct {
+	kv      KVStore
+	metrics *metrics
+}
+
+func newInstrumentedKVStore(kv KVStore, m *metrics) KVStore {
+	return &instrumentedKVStore{kv: kv, metrics: m}
+}
+
+func (s *instrumentedKVStore) Get(key string) ([]byte, error) {
+	data, err := s.kv.Get(key)
+	s.metrics.ObserveKVOperation("get", err)
+	return data, err
+}
+
+func (s *instrumentedKVStore) Set(key string, value []byte) error {
+	err := s.kv.Set(key, value)
+	s.metrics.ObserveKVOperation("set", err)
+	return err
+}
+
+func (s *instrumentedKVStore) CompareAndSet(key string, oldValue, newValue []byte) (bool, error) {
+	ok, err := s.kv.CompareAndSet(key, oldValue, newValue)
+	s.metrics.ObserveKVOperation("compare_and_set", err)
+	return ok, err
+}
+
+func (s *instrumentedKVStore) Delete(key string) error {
+	err := s.kv.Delete(key)
+	s.metrics.ObserveKVOperation("delete", err)
+	return err
+}
+
+func (s *instrumentedKVStore) ListKeys(page, perPage int) ([]string, error) {
+	keys, err := s.kv.ListKeys(page, perPage)
+	s.metrics.ObserveKVOperation("list_keys", err)
+	return keys, err
+}
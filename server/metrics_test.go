@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics()
+	m.ObserveRequest("/requests/{id}", http.MethodGet, http.StatusOK, 30*time.Millisecond)
+	m.ObserveKVOperation("get", nil)
+	m.ObserveKVOperation("get", errors.New("boom"))
+	m.AddQueueSize(importQueue, 3)
+	m.AddQueueSize(importQueue, -1)
+	m.IncWebSocketEvent(`say "hi"`)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Write(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE xlkn_http_requests_total counter\n")
+	assert.Contains(t, out, `xlkn_http_requests_total{route="/requests/{id}",method="GET",status="200"} 1`+"\n")
+	assert.Contains(t, out, `xlkn_http_request_duration_seconds_bucket{route="/requests/{id}",method="GET",le="0.025"} 0`+"\n")
+	assert.Contains(t, out, `xlkn_http_request_duration_seconds_bucket{route="/requests/{id}",method="GET",le="0.05"} 1`+"\n")
+	assert.Contains(t, out, `xlkn_http_request_duration_seconds_bucket{route="/requests/{id}",method="GET",le="+Inf"} 1`+"\n")
+	assert.Contains(t, out, `xlkn_http_request_duration_seconds_count{route="/requests/{id}",method="GET"} 1`+"\n")
+	assert.Contains(t, out, `xlkn_kv_operations_total{operation="get"} 2`+"\n")
+	assert.Contains(t, out, `xlkn_kv_errors_total{operation="get"} 1`+"\n")
+	assert.Contains(t, out, `xlkn_queue_size{queue="import"} 2`+"\n")
+	assert.Contains(t, out, `xlkn_websocket_events_total{event="say \"hi\""} 1`+"\n")
+}
+
+func TestMetricsRoute(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	p.setConfiguration(&configuration{MetricsToken: "s3cret"})
+	createTestPetition(t, p, "user1")
+
+	w := doRequest(p, http.MethodGet, "/metrics", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doRequest(p, http.MethodGet, "/metrics", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/metrics", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `xlkn_http_requests_total{route="/requests",method="POST",status="200"} 1`)
+	assert.Contains(t, w.Body.String(), `xlkn_kv_operations_total{operation="set"}`)
+
+	scrape := func(path, header, value string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, scrape("/metrics", headerMetricsToken, "s3cret"))
+	assert.Equal(t, http.StatusOK, scrape("/metrics?token=s3cret", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, scrape("/metrics", headerMetricsToken, "guess"))
+	assert.Equal(t, http.StatusUnauthorized, scrape("/metrics?token=guess", "", ""))
+	// The server strips the Authorization header before requests reach the plugin.
+	assert.Equal(t, http.StatusUnauthorized, scrape("/metrics", "Authorization", "Bearer s3cret"))
+}
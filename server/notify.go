@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// sendDirectMessage posts message from the bot to userID's direct channel. Failures are logged
+// rather than returned, as notifications never block the action that triggered them.
+func (p *Plugin) sendDirectMessage(userID, message string) {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get direct channel for notification", "user_id", userID, "error", appErr.Error())
+		return
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		p.API.LogWarn("Failed to send notification", "user_id", userID, "error", appErr.Error())
+	}
+}
+
+// notifyUsers sends message to each of userIDs once, skipping exceptID.
+func (p *Plugin) notifyUsers(userIDs []string, exceptID, message string) {
+	sent := map[string]bool{exceptID: true}
+	for _, userID := range userIDs {
+		if sent[userID] {
+			continue
+		}
+		sent[userID] = true
+		p.sendDirectMessage(userID, message)
+	}
+}
+
+// displayName returns the @-prefixed username of userID, falling back to a generic label.
+func (p *Plugin) displayName(userID string) string {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return "Someone"
+	}
+	return "@" + user.Username
+}
+
+// quote formats message as a markdown block quote.
+func quote(message string) string {
+	return "> " + strings.ReplaceAll(message, "\n", "\n> ")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Page size bounds for paginated list routes. Without per_page or cursor, list routes return
+// every matching record.
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+)
+
+// Response headers carrying pagination metadata, so list bodies remain plain JSON arrays.
+const (
+	headerTotalCount = "X-Total-Count"
+	headerNextCursor = "X-Next-Cursor"
+)
+
+// sortKey orders records by one field, breaking ties by ID so that the ordering is total and
+// stable across requests.
+type sortKey struct {
+	Sort string `json:"s"`
+	Num  int64  `json:"n,omitempty"`
+	Str  string `json:"t,omitempty"`
+	ID   string `json:"i"`
+}
+
+func (k sortKey) less(other sortKey) bool {
+	if k.Num != other.Num {
+		return k.Num < other.Num
+	}
+	if k.Str != other.Str {
+		return k.Str < other.Str
+	}
+	return k.ID < other.ID
+}
+
+// encodeCursor returns the opaque cursor pointing after the record with the given key.
+func encodeCursor(key sortKey) string {
+	data, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (*sortKey, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, newBadRequestError("invalid cursor")
+	}
+	var key sortKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, newBadRequestError("invalid cursor")
+	}
+	return &key, nil
+}
+
+// pageRequest describes the slice of a sorted result set requested by a client.
+type pageRequest struct {
+	Sort    string
+	Desc    bool
+	PerPage int
+	After   *sortKey
+}
+
+// parsePageRequest reads the sort, order, per_page and cursor query parameters. sortFields
+// lists the accepted sort fields; the first one is the default.
+func parsePageRequest(query url.Values, sortFields ...string) (*pageRequest, error) {
+	req := &pageRequest{Sort: sortFields[0]}
+
+	if sortField := query.Get("sort"); sortField != "" {
+		valid := false
+		for _, field := range sortFields {
+			valid = valid || field == sortField
+		}
+		if !valid {
+			return nil, newBadRequestError("invalid sort field")
+		}
+		req.Sort = sortField
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		req.Desc = true
+	default:
+		return nil, newBadRequestError("order must be asc or desc")
+	}
+
+	if raw := query.Get("per_page"); raw != "" {
+		perPage, err := strconv.Atoi(raw)
+		if err != nil || perPage <= 0 {
+			return nil, newBadRequestError("invalid per_page")
+		}
+		if perPage > maxPerPage {
+			perPage = maxPerPage
+		}
+		req.PerPage = perPage
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after.Sort != req.Sort {
+			return nil, newBadRequestError("cursor does not match sort field")
+		}
+		req.After = after
+		if req.PerPage == 0 {
+			req.PerPage = defaultPerPage
+		}
+	}
+
+	return req, nil
+}
+
+// paginate sorts items by key and returns the requested page along with the cursor of the next
+// page, which is empty on the last page.
+func paginate[T any](items []T, key func(T) sortKey, req *pageRequest) ([]T, string) {
+	keys := make([]sortKey, len(items))
+	indexes := make([]int, len(items))
+	for i, item := range items {
+		k := key(item)
+		k.Sort = req.Sort
+		keys[i] = k
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		if req.Desc {
+			return keys[indexes[b]].less(keys[indexes[a]])
+		}
+		return keys[indexes[a]].less(keys[indexes[b]])
+	})
+
+	start := 0
+	if req.After != nil {
+		start = sort.Search(len(indexes), func(i int) bool {
+			if req.Desc {
+				return keys[indexes[i]].less(*req.After)
+			}
+			return req.After.less(keys[indexes[i]])
+		})
+	}
+
+	end := len(indexes)
+	if req.PerPage > 0 && start+req.PerPage < end {
+		end = start + req.PerPage
+	}
+
+	page := make([]T, 0, end-start)
+	for _, i := range indexes[start:end] {
+		page = append(page, items[i])
+	}
+
+	next := ""
+	if end < len(indexes) {
+		next = encodeCursor(keys[indexes[end-1]])
+	}
+	return page, next
+}
+
+// writePageHeaders reports the total number of matching records and the next page cursor.
+func writePageHeaders(w http.ResponseWriter, total int, next string) {
+	w.Header().Set(headerTotalCount, strconv.Itoa(total))
+	if next != "" {
+		w.Header().Set(headerNextCursor, next)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	petitionKeyPrefix = "petition_"
+	petitionIndexKey  = "petition_ids"
+)
+
+// Priority bounds accepted for petitions.
+const (
+	MinPriority = 1
+	MaxPriority = 5
+)
+
+// Workflow states of a petition.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusResolved   = "resolved"
+	StatusRejected   = "rejected"
+)
+
+// Process records one step of a petition's forwarding chain.
+type Process struct {
+	ActorID  string `json:"actor_id"`
+	UserID   string `json:"user_id"`
+	Action   string `json:"action"`
+	CreateAt int64  `json:"create_at"`
+}
+
+// StatusChange records a petition entering a workflow state.
+type StatusChange struct {
+	Status   string `json:"status"`
+	CreateAt int64  `json:"create_at"`
+}
+
+// Petition is a formal request filed by a user and forwarded between handlers until resolved.
+type Petition struct {
+	ID         string     `json:"id"`
+	TeamID     string     `json:"team_id,omitempty"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Priority   int        `json:"priority"`
+	CategoryID string     `json:"category_id"`
+	Status     string     `json:"status"`
+	CreatorID  string     `json:"creator_id"`
+	AssigneeID string     `json:"assignee_id,omitempty"`
+	Watchers   []string   `json:"watchers"`
+	Processes  []*Process `json:"processes"`
+	Subtasks   Checklist  `json:"subtasks"`
+	Completion int        `json:"completion"`
+	TopicIDs   []string   `json:"topic_ids,omitempty"`
+	CreateAt   int64      `json:"create_at"`
+	UpdateAt   int64      `json:"update_at"`
+
+	// StatusHistory lists the status changes since the petition was filed as pending.
+	StatusHistory []*StatusChange `json:"status_history,omitempty"`
+
+	// LinkedIDs lists the petitions reported as related to this one.
+	LinkedIDs []string `json:"linked_ids,omitempty"`
+
+	// MergedIntoID is the petition this one was merged into, closing it.
+	MergedIntoID string `json:"merged_into_id,omitempty"`
+
+	// CategorySuggestion is the category a rule suggested when the petition was filed.
+	CategorySuggestion *CategorySuggestion `json:"category_suggestion,omitempty"`
+}
+
+// PetitionPatch lists the petition fields a client may change. Nil fields are left untouched.
+type PetitionPatch struct {
+	Title      *string `json:"title"`
+	Content    *string `json:"content"`
+	Priority   *int    `json:"priority"`
+	CategoryID *string `json:"category_id"`
+	Status     *string `json:"status"`
+
+	// TopicIDs replaces the topics the petition links to when present.
+	TopicIDs *[]string `json:"topic_ids"`
+}
+
+func petitionKey(id string) string {
+	return petitionKeyPrefix + id
+}
+
+func isValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusInProgress, StatusResolved, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// IsOpen reports whether the petition still awaits resolution.
+func (p *Petition) IsOpen() bool {
+	return p.Status == StatusPending || p.Status == StatusInProgress
+}
+
+// involves reports whether userID filed, handles or watches the petition, or took part in its
+// forwarding chain.
+func (p *Petition) involves(userID string) bool {
+	if p.CreatorID == userID || p.AssigneeID == userID {
+		return true
+	}
+	for _, watcher := range p.Watchers {
+		if watcher == userID {
+			return true
+		}
+	}
+	for _, process := range p.Processes {
+		if process.ActorID == userID || process.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid checks the fields supplied by clients.
+func (p *Petition) IsValid() error {
+	if strings.TrimSpace(p.Title) == "" {
+		return newBadRequestError("title is required")
+	}
+	if p.Priority < MinPriority || p.Priority > MaxPriority {
+		return newBadRequestError("priority is out of range")
+	}
+	if p.CategoryID == "" {
+		return newBadRequestError("category is required")
+	}
+	if !isValidStatus(p.Status) {
+		return newBadRequestError("invalid status")
+	}
+	return nil
+}
+
+// SetStatus moves the petition to status, refusing to resolve it while required subtasks are
+// open.
+func (p *Petition) SetStatus(status string) error {
+	if !isValidStatus(status) {
+		return newBadRequestError("invalid status")
+	}
+	if status == StatusResolved && p.Subtasks.OpenRequired() > 0 {
+		return ErrSubtasksOpen
+	}
+	p.enterStatus(status)
+	return nil
+}
+
+// enterStatus moves the petition to status and records the change in its history.
+func (p *Petition) enterStatus(status string) {
+	p.Status = status
+	p.StatusHistory = append(p.StatusHistory, &StatusChange{Status: status, CreateAt: model.GetMillis()})
+}
+
+// Apply copies the non-nil fields of patch onto the petition.
+func (p *Petition) Apply(patch *PetitionPatch) error {
+	if patch.Title != nil {
+		p.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		p.Content = *patch.Content
+	}
+	if patch.Priority != nil {
+		p.Priority = *patch.Priority
+	}
+	if patch.CategoryID != nil {
+		if p.CategorySuggestion != nil && *patch.CategoryID != p.CategorySuggestion.CategoryID {
+			p.CategorySuggestion.Overridden = true
+		}
+		p.CategoryID = *patch.CategoryID
+	}
+	if patch.TopicIDs != nil {
+		topicIDs, err := normalizeTopicIDs(*patch.TopicIDs)
+		if err != nil {
+			return err
+		}
+		p.TopicIDs = topicIDs
+	}
+	if patch.Status != nil && *patch.Status != p.Status {
+		if err := p.SetStatus(*patch.Status); err != nil {
+			return err
+		}
+	}
+	return p.IsValid()
+}
+
+// Watch subscribes userID to notifications about the petition.
+func (p *Petition) Watch(userID string) {
+	for _, watcher := range p.Watchers {
+		if watcher == userID {
+			return
+		}
+	}
+	p.Watchers = append(p.Watchers, userID)
+}
+
+// Unwatch unsubscribes userID from notifications about the petition.
+func (p *Petition) Unwatch(userID string) {
+	for i, watcher := range p.Watchers {
+		if watcher == userID {
+			p.Watchers = append(p.Watchers[:i], p.Watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Forward hands the petition over to userID, recording the step in its process history.
+func (p *Petition) Forward(actorID, userID, action string) {
+	now := model.GetMillis()
+	p.Processes = append(p.Processes, &Process{
+		ActorID:  actorID,
+		UserID:   userID,
+		Action:   action,
+		CreateAt: now,
+	})
+	p.AssigneeID = userID
+	p.Watch(userID)
+	if p.Status == StatusPending {
+		p.enterStatus(StatusInProgress)
+	}
+}
+
+// SavePetition stores a new petition and indexes it.
+func (s *Store) SavePetition(petition *Petition) error {
+	petition.Completion = petition.Subtasks.Completion()
+	if err := setJSON(s.kv, petitionKey(petition.ID), petition); err != nil {
+		return err
+	}
+	if err := addToIndex(s.kv, petitionIndexKey, petition.ID); err != nil {
+		return err
+	}
+	s.notifyChange(KindPetition, petition.ID)
+	return nil
+}
+
+// GetPetition returns the petition with the given ID.
+func (s *Store) GetPetition(id string) (*Petition, error) {
+	var petition Petition
+	found, err := getJSON(s.kv, petitionKey(id), &petition)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &petition, nil
+}
+
+// UpdatePetition atomically applies fn to the petition with the given ID and returns the result.
+func (s *Store) UpdatePetition(id string, fn func(*Petition) error) (*Petition, error) {
+	var updated *Petition
+	err := modifyJSON(s.kv, petitionKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var petition Petition
+		if err := json.Unmarshal(initial, &petition); err != nil {
+			return nil, errors.Wrap(err, "failed to decode petition")
+		}
+		if err := fn(&petition); err != nil {
+			return nil, err
+		}
+		petition.Completion = petition.Subtasks.Completion()
+		petition.UpdateAt = model.GetMillis()
+		updated = &petition
+		return &petition, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notifyChange(KindPetition, id)
+	return updated, nil
+}
+
+// DeletePetition removes the petition with the given ID.
+func (s *Store) DeletePetition(id string) error {
+	if err := removeFromIndex(s.kv, petitionIndexKey, id); err != nil {
+		return errors.Wrap(err, "failed to unindex petition")
+	}
+	if err := s.kv.Delete(petitionKey(id)); err != nil {
+		return err
+	}
+	s.notifyChange(KindPetition, id)
+	return nil
+}
+
+// ForEachPetition calls fn with every petition, oldest first, loading one petition at a time.
+func (s *Store) ForEachPetition(fn func(*Petition) error) error {
+	ids, err := getIndex(s.kv, petitionIndexKey)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		petition, err := s.GetPetition(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(petition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPetitions returns every petition, oldest first.
+func (s *Store) GetPetitions() ([]*Petition, error) {
+	ids, err := getIndex(s.kv, petitionIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	petitions := make([]*Petition, 0, len(ids))
+	for _, id := range ids {
+		petition, err := s.GetPetition(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		petitions = append(petitions, petition)
+	}
+	return petitions, nil
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
 )
 
 // Plugin implements the interface expected by the Mattermost server to communicate between the server and plugin processes.
@@ -18,11 +21,98 @@ type Plugin struct {
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
+
+	// store persists issues, petitions and categories in the key-value store.
+	store *Store
+
+	// search indexes petitions and issues for full-text search.
+	search *searchIndex
+
+	// stats caches the petition statistics shown on dashboards.
+	stats *statsCache
+
+	// metrics collects the plugin's operational metrics.
+	metrics *metrics
+
+	// jobs tracks the runs of background jobs.
+	jobs *jobTracker
+
+	// limiter enforces the per-user rate limits of the HTTP routes.
+	limiter *rateLimiter
+
+	// webhooks sends petition events to webhook subscriptions.
+	webhooks *webhookDispatcher
+
+	// emails sends the batched email notifications about petition events.
+	emails *emailDispatcher
+
+	// topics refreshes the cached topic list from the hot-topics crawler.
+	topics *topicFetcher
+
+	// stopWorkers stops the background workers when the plugin is deactivated.
+	stopWorkers chan struct{}
+
+	// router dispatches the plugin's HTTP routes.
+	router *mux.Router
+
+	// botUserID is the ID of the bot account sending the plugin's notifications.
+	botUserID string
+}
+
+// OnActivate ensures the notification bot exists, initializes the store and the HTTP router and
+// starts the background workers.
+func (p *Plugin) OnActivate() error {
+	botUserID, err := p.API.EnsureBotUser(&model.Bot{
+		Username:    "xlkn",
+		DisplayName: "Kiến Nghị",
+		Description: "Sends notifications about petitions.",
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure bot user")
+	}
+	p.botUserID = botUserID
+
+	p.metrics = newMetrics()
+	p.jobs = newJobTracker(p.metrics)
+	p.store = NewStore(newInstrumentedKVStore(NewPluginKVStore(p.API), p.metrics))
+	p.search = newSearchIndex(p.store)
+	p.store.OnChange(p.search.handleChange)
+	p.stats = newStatsCache(p.store)
+	p.store.OnChange(p.stats.handleChange)
+	p.store.OnChange(p.broadcastChange)
+	p.limiter = newRateLimiter()
+	p.webhooks = newWebhookDispatcher(p.store, p.API, p.metrics, p.jobs)
+	p.emails = newEmailDispatcher(p.store, p.API, p.metrics, p.jobs, func() time.Duration {
+		return p.getConfiguration().EmailBatchWindow()
+	})
+	p.topics = newTopicFetcher(p.store, p.API, p.jobs, p.topicsConfig)
+	p.router = p.initRouter()
+
+	p.stopWorkers = make(chan struct{})
+	go p.webhooks.Run(p.stopWorkers)
+	go p.emails.Run(p.stopWorkers)
+	go p.topics.Run(p.stopWorkers)
+
+	return nil
+}
+
+// OnDeactivate stops the background workers.
+func (p *Plugin) OnDeactivate() error {
+	if p.stopWorkers != nil {
+		close(p.stopWorkers)
+	}
+	return nil
+}
+
+// publishWebSocketEvent sends a plugin WebSocket event to the clients selected by broadcast.
+func (p *Plugin) publishWebSocketEvent(event string, payload map[string]interface{}, broadcast *model.WebsocketBroadcast) {
+	p.API.PublishWebSocketEvent(event, payload, broadcast)
+	p.metrics.IncWebSocketEvent(event)
 }
 
-// ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
+// ServeHTTP dispatches HTTP requests sent to the plugin to the registered routes.
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "Hello, world! 1")
+	p.router.ServeHTTP(w, r)
 }
 
 // See https://developers.mattermost.com/extend/plugins/server/reference/
@@ -1,28 +1,173 @@
 package main
 
 import (
-	"io"
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+// setupTestPlugin returns an activated plugin backed by an in-memory key-value store.
+func setupTestPlugin(t *testing.T) (*Plugin, *plugintest.API) {
+	api := &plugintest.API{}
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Maybe()
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Maybe()
+	t.Cleanup(func() { api.AssertExpectations(t) })
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.botUserID = "bot"
+	p.metrics = newMetrics()
+	p.jobs = newJobTracker(p.metrics)
+	p.store = NewStore(newInstrumentedKVStore(newMemKVStore(), p.metrics))
+	p.search = newSearchIndex(p.store)
+	p.store.OnChange(p.search.handleChange)
+	p.stats = newStatsCache(p.store)
+	p.store.OnChange(p.stats.handleChange)
+	p.limiter = newRateLimiter()
+	p.webhooks = newWebhookDispatcher(p.store, p.API, p.metrics, p.jobs)
+	p.emails = newEmailDispatcher(p.store, p.API, p.metrics, p.jobs, func() time.Duration {
+		return p.getConfiguration().EmailBatchWindow()
+	})
+	p.topics = newTopicFetcher(p.store, p.API, p.jobs, p.topicsConfig)
+	p.router = p.initRouter()
+	return p, api
+}
+
+// createTestPetition files a petition by userID under a new category.
+func createTestPetition(t *testing.T, p *Plugin, userID string) *Petition {
+	category, err := NewCategory("Roads", "", "")
+	require.NoError(t, err)
+	require.NoError(t, p.store.SaveCategory(category))
+
+	w := doRequest(p, http.MethodPost, "/requests", userID, map[string]interface{}{
+		"title":       "Pothole",
+		"content":     "Main street",
+		"priority":    2,
+		"category_id": category.ID,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	var petition Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petition))
+	return &petition
+}
+
+// doRequest sends a request to the plugin on behalf of userID, encoding body as JSON.
+func doRequest(p *Plugin, method, path, userID string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if userID != "" {
+		r.Header.Set("Mattermost-User-ID", userID)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	return w
+}
+
 func TestServeHTTP(t *testing.T) {
 	assert := assert.New(t)
-	plugin := Plugin{}
+	p, _ := setupTestPlugin(t)
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r := httptest.NewRequest(http.MethodGet, "/list", nil)
 
-	plugin.ServeHTTP(nil, w, r)
+	p.ServeHTTP(nil, w, r)
 
 	result := w.Result()
 	assert.NotNil(result)
 	defer result.Body.Close()
-	bodyBytes, err := io.ReadAll(result.Body)
-	assert.Nil(err)
-	bodyString := string(bodyBytes)
+	assert.Equal(http.StatusUnauthorized, result.StatusCode)
+}
+
+func TestIssueChecklist(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("GetUser", "ghost").Return(nil, model.NewAppError("GetUser", "not_found", nil, "", http.StatusNotFound))
+
+	w := doRequest(p, http.MethodPost, "/add", "user1", map[string]string{"message": "Prepare report"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var issue Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&issue))
+
+	w = doRequest(p, http.MethodPost, "/issues/"+issue.ID+"/subtasks", "user1", map[string]interface{}{"title": "Draft", "assignee_id": "ghost"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/issues/"+issue.ID+"/subtasks", "user1", map[string]interface{}{"title": "Draft", "required": true})
+	require.Equal(t, http.StatusOK, w.Code)
+	var subtask Subtask
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&subtask))
+
+	w = doRequest(p, http.MethodPost, "/issues/"+issue.ID+"/subtasks", "user2", map[string]interface{}{"title": "Intruder"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/complete", "user1", map[string]string{"id": issue.ID})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/issues/"+issue.ID+"/subtasks/"+subtask.ID+"/toggle", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/list?list=my", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var issues []*Issue
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&issues))
+	require.Len(t, issues, 1)
+	assert.Equal(t, 100, issues[0].Completion)
+
+	w = doRequest(p, http.MethodPost, "/complete", "user1", map[string]string{"id": issue.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPetitionChecklist(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	petition := createTestPetition(t, p, "user1")
+	_, err := p.store.AddRoleAssignment(&RoleAssignment{ID: "r1", Role: RoleApprover, UserID: "user1"})
+	require.NoError(t, err)
+
+	base := "/requests/" + petition.ID + "/subtasks"
+	var ids []string
+	for _, title := range []string{"Inspect", "Repair"} {
+		w := doRequest(p, http.MethodPost, base, "user1", map[string]interface{}{"title": title, "required": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		var subtask Subtask
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&subtask))
+		ids = append(ids, subtask.ID)
+	}
+
+	w := doRequest(p, http.MethodPost, base+"/reorder", "user1", map[string][]string{"order": {ids[1], ids[0]}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var checklist Checklist
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&checklist))
+	assert.Equal(t, ids[1], checklist[0].ID)
+
+	w = doRequest(p, http.MethodPost, base+"/"+ids[0]+"/toggle", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]string{"status": StatusResolved})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doRequest(p, http.MethodDelete, base+"/"+ids[1], "user1", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var petitions []*Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petitions))
+	require.Len(t, petitions, 1)
+	assert.Equal(t, 100, petitions[0].Completion)
 
-	assert.Equal("Hello, world!", bodyString)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]string{"status": StatusResolved})
+	assert.Equal(t, http.StatusOK, w.Code)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle buckets are dropped from memory.
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket holds the tokens left to a user on a route as of last. full is when the bucket
+// will have refilled if left alone.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// rateLimiter enforces token-bucket limits per key. Buckets live in the memory of each cluster
+// node: sharing them through the key-value store would cost a write per request, which is the
+// load the limits protect against. A user spreading requests over several nodes may therefore
+// exceed a limit by as many times as there are nodes.
+type rateLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{now: time.Now, buckets: map[string]*tokenBucket{}}
+}
+
+// Allow takes a token from the bucket of key, which holds up to burst tokens and gains perMinute
+// tokens a minute. When the bucket is empty, it returns false and how long until a token is
+// available.
+func (l *rateLimiter) Allow(key string, perMinute, burst int) (bool, time.Duration) {
+	now := l.now()
+	rate := float64(perMinute) / time.Minute.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.full = now.Add(secondsToDuration((float64(burst) - bucket.tokens) / rate))
+
+	if !allowed {
+		return false, secondsToDuration((1 - bucket.tokens) / rate)
+	}
+	return true, 0
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// sweep drops the buckets that have refilled, as they are equivalent to new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if !now.Before(bucket.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("a", 60, 3)
+		require.True(t, allowed)
+	}
+	allowed, wait := limiter.Allow("a", 60, 3)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+
+	allowed, _ = limiter.Allow("b", 60, 3)
+	assert.True(t, allowed, "buckets are per key")
+
+	now = now.Add(1500 * time.Millisecond)
+	allowed, _ = limiter.Allow("a", 60, 3)
+	assert.True(t, allowed)
+	allowed, wait = limiter.Allow("a", 60, 3)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Refilled buckets are dropped by the next sweep.
+	now = now.Add(time.Hour)
+	limiter.Allow("c", 60, 3)
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestConfigurationRateLimit(t *testing.T) {
+	c := &configuration{RateLimitPerMinute: 60, RateLimitOverrides: "GET /list=300, /requests = 30,/search=0"}
+	require.NoError(t, c.IsValid())
+
+	perMinute, burst := c.RateLimit(http.MethodGet, "/list")
+	assert.Equal(t, 300, perMinute)
+	assert.Equal(t, 300, burst)
+	perMinute, _ = c.RateLimit(http.MethodPost, "/list")
+	assert.Equal(t, 60, perMinute)
+	perMinute, _ = c.RateLimit(http.MethodPost, "/requests")
+	assert.Equal(t, 30, perMinute)
+	perMinute, _ = c.RateLimit(http.MethodGet, "/search")
+	assert.Equal(t, 0, perMinute)
+
+	c.RateLimitBurst = 5
+	_, burst = c.RateLimit(http.MethodGet, "/list")
+	assert.Equal(t, 5, burst)
+
+	assert.Error(t, (&configuration{RateLimitOverrides: "/list"}).IsValid())
+	assert.Error(t, (&configuration{RateLimitOverrides: "/list=-1"}).IsValid())
+	assert.Error(t, (&configuration{RateLimitPerMinute: -1}).IsValid())
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	p.setConfiguration(&configuration{RateLimitPerMinute: 60, RateLimitBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		w := doRequest(p, http.MethodGet, "/list", "user1", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	w := doRequest(p, http.MethodGet, "/list", "user1", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	w = doRequest(p, http.MethodGet, "/list", "user2", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodGet, "/categories", "user1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
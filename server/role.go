@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const roleAssignmentsKey = "role_assignments"
+
+// Roles granting access to petitions. Plugin admins hold every other role.
+const (
+	RoleSubmitter       = "submitter"
+	RoleEditor          = "editor"
+	RoleApprover        = "approver"
+	RoleCategoryManager = "category_manager"
+	RolePluginAdmin     = "plugin_admin"
+)
+
+func isValidRole(role string) bool {
+	switch role {
+	case RoleSubmitter, RoleEditor, RoleApprover, RoleCategoryManager, RolePluginAdmin:
+		return true
+	}
+	return false
+}
+
+// RoleAssignment grants a role to a user or to every member of a Mattermost group. Category
+// managers may be limited to a single category; other roles apply to every petition.
+type RoleAssignment struct {
+	ID         string `json:"id"`
+	Role       string `json:"role"`
+	UserID     string `json:"user_id,omitempty"`
+	GroupID    string `json:"group_id,omitempty"`
+	CategoryID string `json:"category_id,omitempty"`
+	CreatorID  string `json:"creator_id"`
+	CreateAt   int64  `json:"create_at"`
+}
+
+// IsValid checks the fields supplied by clients.
+func (a *RoleAssignment) IsValid() error {
+	if !isValidRole(a.Role) {
+		return newBadRequestError("invalid role")
+	}
+	if (a.UserID == "") == (a.GroupID == "") {
+		return newBadRequestError("exactly one of user_id and group_id is required")
+	}
+	if a.CategoryID != "" && a.Role != RoleCategoryManager {
+		return newBadRequestError("only category managers may be limited to a category")
+	}
+	return nil
+}
+
+// NewRoleAssignment returns a role assignment with a freshly generated ID.
+func NewRoleAssignment(role, userID, groupID, categoryID, creatorID string) (*RoleAssignment, error) {
+	assignment := &RoleAssignment{
+		ID:         model.NewId(),
+		Role:       role,
+		UserID:     userID,
+		GroupID:    groupID,
+		CategoryID: categoryID,
+		CreatorID:  creatorID,
+		CreateAt:   model.GetMillis(),
+	}
+	if err := assignment.IsValid(); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// GetRoleAssignments returns every role assignment in creation order.
+func (s *Store) GetRoleAssignments() ([]*RoleAssignment, error) {
+	var assignments []*RoleAssignment
+	if _, err := getJSON(s.kv, roleAssignmentsKey, &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// modifyRoleAssignments atomically replaces the role assignments with the result of fn. A nil
+// result leaves them untouched.
+func (s *Store) modifyRoleAssignments(fn func([]*RoleAssignment) ([]*RoleAssignment, error)) error {
+	return modifyJSON(s.kv, roleAssignmentsKey, func(initial []byte) (interface{}, error) {
+		var assignments []*RoleAssignment
+		if initial != nil {
+			if err := json.Unmarshal(initial, &assignments); err != nil {
+				return nil, errors.Wrap(err, "failed to decode role assignments")
+			}
+		}
+		updated, err := fn(assignments)
+		if updated == nil {
+			return nil, err
+		}
+		return updated, err
+	})
+}
+
+// AddRoleAssignment stores a new role assignment. Granting a role the user or group already
+// holds returns the existing assignment.
+func (s *Store) AddRoleAssignment(assignment *RoleAssignment) (*RoleAssignment, error) {
+	result := assignment
+	err := s.modifyRoleAssignments(func(assignments []*RoleAssignment) ([]*RoleAssignment, error) {
+		for _, existing := range assignments {
+			if existing.Role == assignment.Role && existing.UserID == assignment.UserID &&
+				existing.GroupID == assignment.GroupID && existing.CategoryID == assignment.CategoryID {
+				result = existing
+				return nil, nil
+			}
+		}
+		result = assignment
+		return append(assignments, assignment), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteRoleAssignment removes the role assignment with the given ID and returns it.
+func (s *Store) DeleteRoleAssignment(id string) (*RoleAssignment, error) {
+	var deleted *RoleAssignment
+	err := s.modifyRoleAssignments(func(assignments []*RoleAssignment) ([]*RoleAssignment, error) {
+		for i, assignment := range assignments {
+			if assignment.ID == id {
+				deleted = assignment
+				return append(assignments[:i:i], assignments[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// access answers permission questions for one user. Group memberships and system administrator
+// status are only looked up when an answer depends on them, and at most once.
+type access struct {
+	p           *Plugin
+	userID      string
+	assignments []*RoleAssignment
+	groups      map[string]bool
+	admin       *bool
+}
+
+// newAccess loads the role assignments for checking the permissions of userID.
+func (p *Plugin) newAccess(userID string) (*access, error) {
+	assignments, err := p.store.GetRoleAssignments()
+	if err != nil {
+		return nil, err
+	}
+	return &access{p: p, userID: userID, assignments: assignments}, nil
+}
+
+func (a *access) inGroup(groupID string) bool {
+	if a.groups == nil {
+		a.groups = map[string]bool{}
+		groups, appErr := a.p.API.GetGroupsForUser(a.userID)
+		if appErr != nil {
+			a.p.API.LogError("Failed to get groups of user", "user_id", a.userID, "error", appErr.Error())
+		}
+		for _, group := range groups {
+			a.groups[group.Id] = true
+		}
+	}
+	return a.groups[groupID]
+}
+
+func (a *access) isSystemAdmin() bool {
+	if a.admin == nil {
+		admin := a.p.isSystemAdmin(a.userID)
+		a.admin = &admin
+	}
+	return *a.admin
+}
+
+// assigned reports whether the user holds role through an assignment matching categoryID.
+// Direct assignments are checked before group assignments to spare group lookups.
+func (a *access) assigned(role, categoryID string) bool {
+	matches := func(assignment *RoleAssignment) bool {
+		return assignment.Role == role && (assignment.CategoryID == "" || assignment.CategoryID == categoryID)
+	}
+	for _, assignment := range a.assignments {
+		if matches(assignment) && assignment.UserID == a.userID {
+			return true
+		}
+	}
+	for _, assignment := range a.assignments {
+		if matches(assignment) && assignment.GroupID != "" && a.inGroup(assignment.GroupID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPluginAdmin reports whether the user is a plugin admin. System administrators always are.
+func (a *access) IsPluginAdmin() bool {
+	return a.assigned(RolePluginAdmin, "") || a.isSystemAdmin()
+}
+
+// Has reports whether the user holds role for petitions in categoryID.
+func (a *access) Has(role, categoryID string) bool {
+	return a.assigned(role, categoryID) || a.IsPluginAdmin()
+}
+
+// CanSubmit reports whether the user may file petitions. Until the submitter role is assigned
+// to anyone, every user may.
+func (a *access) CanSubmit() bool {
+	for _, assignment := range a.assignments {
+		if assignment.Role == RoleSubmitter {
+			return a.Has(RoleSubmitter, "")
+		}
+	}
+	return true
+}
+
+// CanManageCategories reports whether the user may create categories, which requires a category
+// manager assignment not limited to a single category.
+func (a *access) CanManageCategories() bool {
+	return a.Has(RoleCategoryManager, "")
+}
+
+// CanView reports whether the user may see the petition and take part in its discussion.
+func (a *access) CanView(petition *Petition) bool {
+	return petition.involves(a.userID) || a.CanViewAll() || a.Has(RoleCategoryManager, petition.CategoryID)
+}
+
+// CanViewAll reports whether the user may see every petition.
+func (a *access) CanViewAll() bool {
+	return a.assigned(RoleEditor, "") || a.assigned(RoleApprover, "") || a.Has(RoleCategoryManager, "")
+}
+
+// CanEdit reports whether the user may change the petition's contents and subtasks. Submitters
+// may edit their own petitions until they are handled.
+func (a *access) CanEdit(petition *Petition) bool {
+	return (petition.CreatorID == a.userID && petition.Status == StatusPending) ||
+		a.assigned(RoleEditor, "") || a.Has(RoleCategoryManager, petition.CategoryID)
+}
+
+// CanHandle reports whether the user may forward the petition and work on its subtasks.
+func (a *access) CanHandle(petition *Petition) bool {
+	return petition.AssigneeID == a.userID || a.CanEdit(petition)
+}
+
+// CanDecide reports whether the user may resolve or reject the petition.
+func (a *access) CanDecide(petition *Petition) bool {
+	return a.assigned(RoleApprover, "") || a.Has(RoleCategoryManager, petition.CategoryID)
+}
+
+// CanDelete reports whether the user may delete the petition.
+func (a *access) CanDelete(petition *Petition) bool {
+	return a.Has(RoleCategoryManager, petition.CategoryID)
+}
+
+// require reports ErrNotFound if the user may not see the petition, and ErrForbidden if they
+// may see it but allowed, when given, denies the action.
+func (a *access) require(petition *Petition, allowed func(*Petition) bool) error {
+	if !a.CanView(petition) {
+		return ErrNotFound
+	}
+	if allowed != nil && !allowed(petition) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CheckPatch reports ErrForbidden if the user may not apply patch to the petition. Closing a
+// petition requires the right to decide on it; other changes require the right to edit it.
+func (a *access) CheckPatch(petition *Petition, patch *PetitionPatch) error {
+	if patch.Status != nil && *patch.Status != petition.Status &&
+		(*patch.Status == StatusResolved || *patch.Status == StatusRejected || !petition.IsOpen()) {
+		if !a.CanDecide(petition) {
+			return ErrForbidden
+		}
+		if patch.Title == nil && patch.Content == nil && patch.Priority == nil && patch.CategoryID == nil && patch.TopicIDs == nil {
+			return nil
+		}
+	}
+	if !a.CanEdit(petition) {
+		return ErrForbidden
+	}
+	if patch.CategoryID != nil && *patch.CategoryID != petition.CategoryID {
+		moved := *petition
+		moved.CategoryID = *patch.CategoryID
+		if !a.CanEdit(&moved) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleAssignmentIsValid(t *testing.T) {
+	assert.NoError(t, (&RoleAssignment{Role: RoleEditor, UserID: "user1"}).IsValid())
+	assert.NoError(t, (&RoleAssignment{Role: RoleCategoryManager, GroupID: "group1", CategoryID: "c1"}).IsValid())
+	assert.Error(t, (&RoleAssignment{Role: "owner", UserID: "user1"}).IsValid())
+	assert.Error(t, (&RoleAssignment{Role: RoleEditor}).IsValid())
+	assert.Error(t, (&RoleAssignment{Role: RoleEditor, UserID: "user1", GroupID: "group1"}).IsValid())
+	assert.Error(t, (&RoleAssignment{Role: RoleApprover, UserID: "user1", CategoryID: "c1"}).IsValid())
+}
+
+func assignRole(t *testing.T, p *Plugin, body map[string]string) *RoleAssignment {
+	w := doRequest(p, http.MethodPost, "/roles", "admin", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var assignment RoleAssignment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&assignment))
+	return &assignment
+}
+
+func TestPetitionRoles(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	api.On("GetUser", mock.Anything).Return(&model.User{}, nil)
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+	api.On("GetGroup", "group1").Return(&model.Group{Id: "group1"}, nil)
+	api.On("GetGroupsForUser", mock.Anything).Return(func(userID string) []*model.Group {
+		if userID == "editor" {
+			return []*model.Group{{Id: "group1"}}
+		}
+		return nil
+	}, nil)
+	petition := createTestPetition(t, p, "user1")
+
+	w := doRequest(p, http.MethodGet, "/roles", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assignRole(t, p, map[string]string{"role": RoleEditor, "group_id": "group1"})
+	assignRole(t, p, map[string]string{"role": RoleApprover, "user_id": "approver"})
+	manager := assignRole(t, p, map[string]string{"role": RoleCategoryManager, "user_id": "manager", "category_id": petition.CategoryID})
+	assert.Equal(t, manager, assignRole(t, p, map[string]string{"role": RoleCategoryManager, "user_id": "manager", "category_id": petition.CategoryID}))
+
+	w = doRequest(p, http.MethodPost, "/roles", "admin", map[string]string{"role": RoleEditor, "user_id": "user2", "category_id": petition.CategoryID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Outsiders cannot see the petition; its submitter may edit it while it is pending.
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user2", map[string]string{"title": "Hijack"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]string{"title": "Deep pothole"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodDelete, "/requests/"+petition.ID, "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/requests/forward/"+petition.ID, "editor", map[string]string{"assignee_id": "user2"})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]string{"title": "Too late"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "editor", map[string]string{"status": StatusResolved})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "approver", map[string]string{"title": "Renamed"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "approver", map[string]string{"status": StatusResolved})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests", "manager", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var petitions []*Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petitions))
+	assert.Len(t, petitions, 1)
+	w = doRequest(p, http.MethodPost, "/categories", "manager", map[string]string{"name": "Parks"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodDelete, "/requests/"+petition.ID, "manager", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Once the submitter role is assigned, only its holders may file petitions.
+	assignRole(t, p, map[string]string{"role": RoleSubmitter, "user_id": "user3"})
+	w = doRequest(p, http.MethodPost, "/requests", "user1", map[string]interface{}{"title": "Noise", "priority": 1, "category_id": petition.CategoryID})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPost, "/requests", "user3", map[string]interface{}{"title": "Noise", "priority": 1, "category_id": petition.CategoryID})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodDelete, "/roles/"+manager.ID, "admin", nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(p, http.MethodDelete, "/roles/"+manager.ID, "admin", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Field weights applied when indexing a document, so that a match in a petition's title ranks
+// above a match buried in its comments.
+const (
+	searchWeightTitle    = 3
+	searchWeightCategory = 2
+	searchWeightBody     = 1
+)
+
+// searchPrefixPenalty scales the score of query terms matched only as a prefix.
+const searchPrefixPenalty = 0.5
+
+// searchDoc is an indexed petition or issue.
+type searchDoc struct {
+	kind  string
+	id    string
+	terms map[string]int
+}
+
+// SearchHit is one search result.
+type SearchHit struct {
+	Kind  string  `json:"type"`
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// searchChange is a record reported as changed while the index was being built.
+type searchChange struct {
+	kind string
+	id   string
+}
+
+// searchIndex is an in-memory inverted index over petitions and issues. It is built from the
+// store on first use and kept current by reindexing each record reported as changed. Each
+// cluster node maintains its own index from the writes it observes and those announced by the
+// other nodes through cluster events.
+type searchIndex struct {
+	store *Store
+
+	mu       sync.RWMutex
+	built    bool
+	docs     map[string]*searchDoc
+	postings map[string]map[string]int
+
+	// pending collects the changes reported while a build reads the store, which may miss
+	// them; they are reindexed once the build completes. It is nil while no build runs.
+	pending map[searchChange]bool
+
+	// terms is the sorted list of indexed terms used for prefix lookups, rebuilt on demand
+	// after the postings change.
+	terms      []string
+	termsDirty bool
+}
+
+func newSearchIndex(store *Store) *searchIndex {
+	return &searchIndex{store: store}
+}
+
+func searchDocKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// addTerms adds the tokens of text to terms with the given weight.
+func addTerms(terms map[string]int, text string, weight int) {
+	for _, token := range tokenize(text) {
+		terms[token] += weight
+	}
+}
+
+// ensureBuilt indexes every petition and issue the first time the index is used.
+func (idx *searchIndex) ensureBuilt() error {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return nil
+	}
+	if idx.pending == nil {
+		idx.pending = map[searchChange]bool{}
+	}
+	idx.mu.Unlock()
+
+	petitions, err := idx.store.GetPetitions()
+	if err != nil {
+		return errors.Wrap(err, "failed to load petitions")
+	}
+	issues, err := idx.store.GetAllIssues()
+	if err != nil {
+		return errors.Wrap(err, "failed to load issues")
+	}
+
+	docs := make([]*searchDoc, 0, len(petitions)+len(issues))
+	for _, petition := range petitions {
+		doc, err := idx.petitionDoc(petition)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	for _, issue := range issues {
+		docs = append(docs, issueDoc(issue))
+	}
+
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return nil
+	}
+	idx.docs = map[string]*searchDoc{}
+	idx.postings = map[string]map[string]int{}
+	for _, doc := range docs {
+		idx.put(doc)
+	}
+	idx.built = true
+	pending := idx.pending
+	idx.pending = nil
+	idx.mu.Unlock()
+
+	for change := range pending {
+		idx.handleChange(change.kind, change.id)
+	}
+	return nil
+}
+
+func (idx *searchIndex) petitionDoc(petition *Petition) (*searchDoc, error) {
+	terms := map[string]int{}
+	addTerms(terms, petition.Title, searchWeightTitle)
+	addTerms(terms, petition.Content, searchWeightBody)
+
+	category, err := idx.store.GetCategory(petition.CategoryID)
+	if err != nil && err != ErrNotFound {
+		return nil, errors.Wrap(err, "failed to load category")
+	}
+	if category != nil {
+		addTerms(terms, category.Name, searchWeightCategory)
+		addTerms(terms, category.Description, searchWeightCategory)
+	}
+
+	comments, err := idx.store.GetComments(petition.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load comments")
+	}
+	for _, comment := range comments {
+		addTerms(terms, comment.Message, searchWeightBody)
+	}
+
+	return &searchDoc{kind: KindPetition, id: petition.ID, terms: terms}, nil
+}
+
+func issueDoc(issue *Issue) *searchDoc {
+	terms := map[string]int{}
+	addTerms(terms, issue.Message, searchWeightTitle)
+	addTerms(terms, issue.Description, searchWeightBody)
+	for _, subtask := range issue.Subtasks {
+		addTerms(terms, subtask.Title, searchWeightBody)
+	}
+	return &searchDoc{kind: KindIssue, id: issue.ID, terms: terms}
+}
+
+// put adds doc to the index, replacing any previous version. The caller must hold the lock.
+func (idx *searchIndex) put(doc *searchDoc) {
+	key := searchDocKey(doc.kind, doc.id)
+	idx.remove(key)
+
+	idx.docs[key] = doc
+	for term, weight := range doc.terms {
+		postings, ok := idx.postings[term]
+		if !ok {
+			postings = map[string]int{}
+			idx.postings[term] = postings
+			idx.termsDirty = true
+		}
+		postings[key] = weight
+	}
+}
+
+// remove drops the document with the given key. The caller must hold the lock.
+func (idx *searchIndex) remove(key string) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	delete(idx.docs, key)
+	for term := range doc.terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+			idx.termsDirty = true
+		}
+	}
+}
+
+// handleChange reindexes the record reported by the store. It is registered as a store change
+// listener; changes reported before the index is built are left to the build.
+func (idx *searchIndex) handleChange(kind, id string) {
+	idx.mu.Lock()
+	built := idx.built
+	if !built && idx.pending != nil {
+		idx.pending[searchChange{kind: kind, id: id}] = true
+	}
+	idx.mu.Unlock()
+	if !built {
+		return
+	}
+
+	var doc *searchDoc
+	var err error
+	switch kind {
+	case KindPetition:
+		var petition *Petition
+		if petition, err = idx.store.GetPetition(id); err == nil {
+			doc, err = idx.petitionDoc(petition)
+		}
+	case KindIssue:
+		var issue *Issue
+		if issue, err = idx.store.GetIssue(id); err == nil {
+			doc = issueDoc(issue)
+		}
+	case KindCategory:
+		// Category names are folded into petition documents; rebuild lazily on next search.
+		idx.mu.Lock()
+		idx.built = false
+		idx.mu.Unlock()
+		return
+	default:
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	switch {
+	case err == ErrNotFound:
+		idx.remove(searchDocKey(kind, id))
+	case err != nil:
+		// The document can no longer be trusted; force a full rebuild on next search.
+		idx.built = false
+	default:
+		idx.put(doc)
+	}
+}
+
+// sortedTerms returns the sorted list of indexed terms. The caller must hold the write lock.
+func (idx *searchIndex) sortedTerms() []string {
+	if idx.termsDirty || idx.terms == nil {
+		idx.terms = make([]string, 0, len(idx.postings))
+		for term := range idx.postings {
+			idx.terms = append(idx.terms, term)
+		}
+		sort.Strings(idx.terms)
+		idx.termsDirty = false
+	}
+	return idx.terms
+}
+
+// Search returns up to limit documents matching every word of query, best match first. Words
+// match indexed terms exactly or as a prefix, ignoring case and diacritics. Only documents
+// accepted by visible are returned; it is consulted in rank order until limit are found.
+func (idx *searchIndex) Search(query string, limit int, visible func(kind, id string) bool) ([]*SearchHit, error) {
+	if err := idx.ensureBuilt(); err != nil {
+		return nil, err
+	}
+
+	tokens := tokenize(query)
+	if len(tokens) == 0 {
+		return []*SearchHit{}, nil
+	}
+
+	idx.mu.Lock()
+	terms := idx.sortedTerms()
+	total := float64(len(idx.docs))
+
+	var scores map[string]float64
+	for _, token := range tokens {
+		tokenScores := map[string]float64{}
+		start := sort.SearchStrings(terms, token)
+		for i := start; i < len(terms) && strings.HasPrefix(terms[i], token); i++ {
+			term := terms[i]
+			postings := idx.postings[term]
+			idf := math.Log(1 + total/float64(len(postings)))
+			factor := 1.0
+			if term != token {
+				factor = searchPrefixPenalty
+			}
+			for key, weight := range postings {
+				score := float64(weight) * idf * factor
+				if score > tokenScores[key] {
+					tokenScores[key] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+		for key, score := range scores {
+			if tokenScore, ok := tokenScores[key]; ok {
+				scores[key] = score + tokenScore
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+
+	hits := make([]*SearchHit, 0, len(scores))
+	for key, score := range scores {
+		doc := idx.docs[key]
+		hits = append(hits, &SearchHit{Kind: doc.kind, ID: doc.id, Score: score})
+	}
+	idx.mu.Unlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	filtered := hits[:0]
+	for _, hit := range hits {
+		if len(filtered) == limit {
+			break
+		}
+		if visible(hit.Kind, hit.ID) {
+			filtered = append(filtered, hit)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldText(t *testing.T) {
+	assert.Equal(t, "kien nghi ve duong", foldText("Kiến nghị về đường"))
+	assert.Equal(t, "duong pho ha noi", foldText("ĐƯỜNG PHỐ Hà Nội"))
+	assert.Equal(t, []string{"kien", "nghi", "so", "12"}, tokenize("Kiến-nghị, số 12!"))
+}
+
+func allVisible(kind, id string) bool {
+	return true
+}
+
+func TestSearchIndex(t *testing.T) {
+	store := NewStore(newMemKVStore())
+	index := newSearchIndex(store)
+	store.OnChange(index.handleChange)
+
+	category, err := NewCategory("Giao thông", "", "")
+	require.NoError(t, err)
+	require.NoError(t, store.SaveCategory(category))
+
+	roads := &Petition{ID: "roads", Title: "Kiến nghị sửa đường", Content: "Ổ gà trên phố", CategoryID: category.ID}
+	lights := &Petition{ID: "lights", Title: "Đèn đường hỏng", Content: "Cần kiến nghị thay đèn", CategoryID: category.ID}
+	require.NoError(t, store.SavePetition(roads))
+	require.NoError(t, store.SavePetition(lights))
+
+	hits, err := index.Search("kien nghi", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, "roads", hits[0].ID, "title matches rank first")
+
+	hits, err = index.Search("giao thong", 10, allVisible)
+	require.NoError(t, err)
+	assert.Len(t, hits, 2)
+
+	hits, err = index.Search("đè", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "lights", hits[0].ID)
+
+	require.NoError(t, store.SaveComment(&Comment{ID: "c1", PetitionID: "roads", Message: "Đã khảo sát hiện trường"}))
+	hits, err = index.Search("khao sat", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "roads", hits[0].ID)
+
+	issue, err := NewIssue("Gọi điện cho người dân", "", "", "user1", "")
+	require.NoError(t, err)
+	require.NoError(t, store.SaveIssue(issue))
+	hits, err = index.Search("goi dien", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, KindIssue, hits[0].Kind)
+
+	hits, err = index.Search("goi dien", 10, func(kind, id string) bool { return kind == KindPetition })
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+
+	require.NoError(t, store.DeletePetition("roads"))
+	hits, err = index.Search("kien nghi", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "lights", hits[0].ID)
+
+	hits, err = index.Search("  ", 10, allVisible)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestSearchLimit(t *testing.T) {
+	store := NewStore(newMemKVStore())
+	index := newSearchIndex(store)
+	store.OnChange(index.handleChange)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, store.SavePetition(&Petition{ID: id, Title: "Kiến nghị " + id}))
+	}
+
+	// Visibility is only checked until the limit is reached.
+	var checked []string
+	hits, err := index.Search("kien nghi", 2, func(kind, id string) bool {
+		checked = append(checked, id)
+		return id != "a"
+	})
+	require.NoError(t, err)
+	require.Len(t, hits, 2)
+	assert.Equal(t, "b", hits[0].ID)
+	assert.Equal(t, "c", hits[1].ID)
+	assert.Equal(t, []string{"a", "b", "c"}, checked)
+}
+
+func TestSearchClusterEvents(t *testing.T) {
+	p, api := setupTestPlugin(t)
+
+	// Another node writes to the shared store without this node's listeners seeing it.
+	other := NewStore(p.store.kv)
+	other.OnChange(p.broadcastChange)
+	var events []model.PluginClusterEvent
+	api.On("PublishPluginClusterEvent", mock.Anything, model.PluginClusterEventSendOptions{SendType: model.PluginClusterEventSendTypeReliable}).Run(func(args mock.Arguments) {
+		events = append(events, args.Get(0).(model.PluginClusterEvent))
+	}).Return(nil)
+
+	hits, err := p.search.Search("pothole", 10, allVisible)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+
+	require.NoError(t, other.SavePetition(&Petition{ID: "remote", Title: "Pothole"}))
+	hits, err = p.search.Search("pothole", 10, allVisible)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+
+	require.Len(t, events, 1)
+	p.OnPluginClusterEvent(nil, events[0])
+	hits, err = p.search.Search("pothole", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "remote", hits[0].ID)
+}
+
+// hookKVStore runs onList once, before the first key listing.
+type hookKVStore struct {
+	KVStore
+	onList func()
+}
+
+func (s *hookKVStore) ListKeys(page, perPage int) ([]string, error) {
+	if onList := s.onList; onList != nil {
+		s.onList = nil
+		onList()
+	}
+	return s.KVStore.ListKeys(page, perPage)
+}
+
+func TestSearchChangesDuringBuild(t *testing.T) {
+	kv := &hookKVStore{KVStore: newMemKVStore()}
+	store := NewStore(kv)
+	index := newSearchIndex(store)
+	store.OnChange(index.handleChange)
+	require.NoError(t, store.SavePetition(&Petition{ID: "roads", Title: "Pothole"}))
+
+	// The petition changes after the build read it, while issues are being loaded.
+	kv.onList = func() {
+		require.NoError(t, store.SavePetition(&Petition{ID: "roads", Title: "Flooding"}))
+	}
+	hits, err := index.Search("pothole", 10, allVisible)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+	hits, err = index.Search("flooding", 10, allVisible)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "roads", hits[0].ID)
+}
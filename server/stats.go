@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// statsCacheTTL bounds the age of cached statistics. Writes observed by this node, or announced
+// by other cluster nodes, clear the cache at once; the TTL catches up with announcements lost.
+const statsCacheTTL = 5 * time.Minute
+
+// StatsScope selects the petitions aggregated by the statistics route.
+type StatsScope struct {
+	TeamID string
+	Since  int64
+	Until  int64
+}
+
+func (s StatsScope) key() string {
+	return fmt.Sprintf("%s:%d:%d", s.TeamID, s.Since, s.Until)
+}
+
+// Matches reports whether the petition was filed within the scope.
+func (s StatsScope) Matches(petition *Petition) bool {
+	return (s.TeamID == "" || petition.TeamID == s.TeamID) && inDateRange(petition.CreateAt, s.Since, s.Until)
+}
+
+// DurationStats summarizes a set of durations in milliseconds. Percentiles use the nearest-rank
+// method.
+type DurationStats struct {
+	Count   int   `json:"count"`
+	Average int64 `json:"average"`
+	P50     int64 `json:"p50"`
+	P90     int64 `json:"p90"`
+	P95     int64 `json:"p95"`
+}
+
+func summarizeDurations(durations []int64) *DurationStats {
+	stats := &DurationStats{Count: len(durations)}
+	if len(durations) == 0 {
+		return stats
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var total int64
+	for _, d := range durations {
+		total += d
+	}
+	stats.Average = total / int64(len(durations))
+	percentile := func(p float64) int64 {
+		rank := int(math.Ceil(p / 100 * float64(len(durations))))
+		return durations[rank-1]
+	}
+	stats.P50 = percentile(50)
+	stats.P90 = percentile(90)
+	stats.P95 = percentile(95)
+	return stats
+}
+
+// PetitionStats aggregates the petitions of a scope for dashboards. Durations are in
+// milliseconds: Resolution runs from filing to resolution of resolved petitions, and TimeInState
+// covers the completed stays of petitions in each open state.
+type PetitionStats struct {
+	Total       int                       `json:"total"`
+	ByStatus    map[string]int            `json:"by_status"`
+	ByCategory  map[string]int            `json:"by_category"`
+	ByPriority  map[int]int               `json:"by_priority"`
+	ByAssignee  map[string]int            `json:"by_assignee"`
+	Unassigned  int                       `json:"unassigned"`
+	Resolution  *DurationStats            `json:"resolution"`
+	TimeInState map[string]*DurationStats `json:"time_in_state"`
+	ComputedAt  int64                     `json:"computed_at"`
+}
+
+// statusHistory returns the petition's status changes, starting with its filing. Petitions
+// filed before status changes were recorded are approximated from their forwarding chain and
+// their last update.
+func (p *Petition) statusHistory() []*StatusChange {
+	history := []*StatusChange{{Status: StatusPending, CreateAt: p.CreateAt}}
+	if len(p.StatusHistory) > 0 {
+		return append(history, p.StatusHistory...)
+	}
+	if len(p.Processes) > 0 && p.Status != StatusPending {
+		history = append(history, &StatusChange{Status: StatusInProgress, CreateAt: p.Processes[0].CreateAt})
+	}
+	if !p.IsOpen() {
+		history = append(history, &StatusChange{Status: p.Status, CreateAt: p.UpdateAt})
+	}
+	return history
+}
+
+// ComputePetitionStats aggregates the petitions matching scope.
+func ComputePetitionStats(petitions []*Petition, scope StatsScope) *PetitionStats {
+	stats := &PetitionStats{
+		ByStatus:    map[string]int{},
+		ByCategory:  map[string]int{},
+		ByPriority:  map[int]int{},
+		ByAssignee:  map[string]int{},
+		TimeInState: map[string]*DurationStats{},
+		ComputedAt:  model.GetMillis(),
+	}
+
+	var resolution []int64
+	inState := map[string][]int64{StatusPending: nil, StatusInProgress: nil}
+	for _, petition := range petitions {
+		if !scope.Matches(petition) {
+			continue
+		}
+		stats.Total++
+		stats.ByStatus[petition.Status]++
+		stats.ByCategory[petition.CategoryID]++
+		stats.ByPriority[petition.Priority]++
+		if petition.AssigneeID == "" {
+			stats.Unassigned++
+		} else {
+			stats.ByAssignee[petition.AssigneeID]++
+		}
+
+		history := petition.statusHistory()
+		for i, change := range history[:len(history)-1] {
+			if _, ok := inState[change.Status]; ok {
+				inState[change.Status] = append(inState[change.Status], history[i+1].CreateAt-change.CreateAt)
+			}
+		}
+		if petition.Status == StatusResolved {
+			resolution = append(resolution, history[len(history)-1].CreateAt-petition.CreateAt)
+		}
+	}
+
+	stats.Resolution = summarizeDurations(resolution)
+	for status, durations := range inState {
+		stats.TimeInState[status] = summarizeDurations(durations)
+	}
+	return stats
+}
+
+// statsCache keeps computed statistics per scope until a petition or category changes.
+type statsCache struct {
+	store *Store
+
+	mu      sync.Mutex
+	entries map[string]*PetitionStats
+	// generation counts the changes seen, so that statistics computed across a change are not
+	// cached.
+	generation int
+}
+
+func newStatsCache(store *Store) *statsCache {
+	return &statsCache{store: store, entries: map[string]*PetitionStats{}}
+}
+
+// handleChange is the store change listener clearing the cache.
+func (c *statsCache) handleChange(kind, id string) {
+	if kind != KindPetition && kind != KindCategory {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*PetitionStats{}
+	c.generation++
+}
+
+// Get returns the statistics of scope, computing them if they are not cached or too old.
+func (c *statsCache) Get(scope StatsScope) (*PetitionStats, error) {
+	key := scope.key()
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && model.GetMillis()-cached.ComputedAt < statsCacheTTL.Milliseconds() {
+		return cached, nil
+	}
+
+	petitions, err := c.store.GetPetitions()
+	if err != nil {
+		return nil, err
+	}
+	stats := ComputePetitionStats(petitions, scope)
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[key] = stats
+	}
+	c.mu.Unlock()
+	return stats, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeDurations(t *testing.T) {
+	assert.Equal(t, &DurationStats{}, summarizeDurations(nil))
+
+	durations := make([]int64, 0, 20)
+	for i := 20; i >= 1; i-- {
+		durations = append(durations, int64(i))
+	}
+	assert.Equal(t, &DurationStats{Count: 20, Average: 10, P50: 10, P90: 18, P95: 19}, summarizeDurations(durations))
+}
+
+func TestComputePetitionStats(t *testing.T) {
+	petitions := []*Petition{
+		{TeamID: "t1", CategoryID: "c1", Priority: 1, Status: StatusResolved, AssigneeID: "u1", CreateAt: 1000, StatusHistory: []*StatusChange{
+			{Status: StatusInProgress, CreateAt: 1100},
+			{Status: StatusResolved, CreateAt: 1400},
+		}},
+		{TeamID: "t1", CategoryID: "c1", Priority: 2, Status: StatusInProgress, AssigneeID: "u1", CreateAt: 2000, StatusHistory: []*StatusChange{
+			{Status: StatusInProgress, CreateAt: 2300},
+		}},
+		// Filed before status changes were recorded.
+		{TeamID: "t1", CategoryID: "c2", Priority: 2, Status: StatusResolved, CreateAt: 3000, UpdateAt: 3600,
+			Processes: []*Process{{CreateAt: 3200}}},
+		{TeamID: "t2", CategoryID: "c1", Priority: 1, Status: StatusPending, CreateAt: 4000},
+	}
+
+	stats := ComputePetitionStats(petitions, StatsScope{TeamID: "t1"})
+	assert.Equal(t, 3, stats.Total)
+	assert.Equal(t, map[string]int{StatusResolved: 2, StatusInProgress: 1}, stats.ByStatus)
+	assert.Equal(t, map[string]int{"c1": 2, "c2": 1}, stats.ByCategory)
+	assert.Equal(t, map[int]int{1: 1, 2: 2}, stats.ByPriority)
+	assert.Equal(t, map[string]int{"u1": 2}, stats.ByAssignee)
+	assert.Equal(t, 1, stats.Unassigned)
+	assert.Equal(t, &DurationStats{Count: 2, Average: 500, P50: 400, P90: 600, P95: 600}, stats.Resolution)
+	assert.Equal(t, &DurationStats{Count: 3, Average: 200, P50: 200, P90: 300, P95: 300}, stats.TimeInState[StatusPending])
+	assert.Equal(t, &DurationStats{Count: 2, Average: 350, P50: 300, P90: 400, P95: 400}, stats.TimeInState[StatusInProgress])
+
+	stats = ComputePetitionStats(petitions, StatsScope{Since: 2500, Until: 4500})
+	assert.Equal(t, 2, stats.Total)
+}
+
+func TestStatsRoute(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	petition := createTestPetition(t, p, "user1")
+
+	getStats := func() *PetitionStats {
+		w := doRequest(p, http.MethodGet, "/stats", "admin", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var stats PetitionStats
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+		return &stats
+	}
+
+	w := doRequest(p, http.MethodGet, "/stats", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodGet, "/stats?from=tomorrow", "admin", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	stats := getStats()
+	assert.Equal(t, 1, stats.Total)
+	assert.Equal(t, stats, getStats())
+
+	// Writes invalidate the cached statistics.
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "admin", map[string]string{"status": StatusRejected})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	stats = getStats()
+	assert.Equal(t, map[string]int{StatusRejected: 1}, stats.ByStatus)
+	assert.Equal(t, 1, stats.TimeInState[StatusPending].Count)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// Kinds of records reported to change listeners. Comments and attachments are reported as
+// changes to their petition.
+const (
+	KindIssue    = "issue"
+	KindPetition = "petition"
+	KindCategory = "category"
+)
+
+// listKeysPerPage is the page size used when enumerating keys.
+const listKeysPerPage = 1000
+
+// ChangeListener is called after a record of the given kind has been created, updated or
+// deleted.
+type ChangeListener func(kind, id string)
+
+// Store persists the plugin's records in the key-value store. Every record is stored as JSON
+// under a prefixed key, and per-type index keys hold the IDs needed to enumerate them.
+type Store struct {
+	kv KVStore
+
+	listenersLock sync.RWMutex
+	listeners     []ChangeListener
+}
+
+// NewStore returns a Store persisting into kv.
+func NewStore(kv KVStore) *Store {
+	return &Store{kv: kv}
+}
+
+// OnChange registers a listener notified of every successful write.
+func (s *Store) OnChange(listener ChangeListener) {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *Store) notifyChange(kind, id string) {
+	s.listenersLock.RLock()
+	defer s.listenersLock.RUnlock()
+	for _, listener := range s.listeners {
+		listener(kind, id)
+	}
+}
+
+// listKeysWithPrefix returns every key starting with prefix.
+func (s *Store) listKeysWithPrefix(prefix string) ([]string, error) {
+	var keys []string
+	for page := 0; ; page++ {
+		pageKeys, err := s.kv.ListKeys(page, listKeysPerPage)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range pageKeys {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		if len(pageKeys) < listKeysPerPage {
+			return keys, nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	telemetryKeyPrefix = "telemetry_day_"
+	telemetryIndexKey  = "telemetry_days"
+)
+
+// telemetryDayLayout formats the UTC day of a telemetry bucket.
+const telemetryDayLayout = "2006-01-02"
+
+// telemetryRetention is how long daily telemetry buckets are kept.
+const telemetryRetention = 90 * 24 * time.Hour
+
+// telemetryEvents lists the events the webapp may report, along with the properties counted for
+// each and their accepted values. Other events are rejected, and other properties or values
+// ignored, so that no free-form data is stored.
+var telemetryEvents = map[string]map[string][]string{
+	"post_action_click":    nil,
+	"channel_header_click": nil,
+	"custom_post_remove":   nil,
+	"custom_post_accept":   nil,
+	"custom_post_complete": nil,
+	"click_lhs_my":         nil,
+	"click_lhs_in":         nil,
+	"click_lhs_out":        nil,
+	"toggle_inbox":         {"action": {"collapse", "expand"}},
+	"toggle_my":            {"action": {"collapse", "expand"}},
+	"rhs_add":              {"list": {"my", "in", "out"}},
+}
+
+// TelemetryBucket counts the telemetry events of one UTC day. Counts are keyed by event, and by
+// event and property value in the form "event.property=value".
+type TelemetryBucket struct {
+	Day    string           `json:"day"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+func telemetryKey(day string) string {
+	return telemetryKeyPrefix + day
+}
+
+// telemetryCounters returns the counters incremented by an event, or an error if the event is
+// not allowed.
+func telemetryCounters(event string, properties map[string]interface{}) ([]string, error) {
+	allowed, ok := telemetryEvents[event]
+	if !ok {
+		return nil, newBadRequestError("unknown telemetry event")
+	}
+
+	counters := []string{event}
+	for property, values := range allowed {
+		value, _ := properties[property].(string)
+		for _, accepted := range values {
+			if value == accepted {
+				counters = append(counters, event+"."+property+"="+value)
+			}
+		}
+	}
+	sort.Strings(counters[1:])
+	return counters, nil
+}
+
+// RecordTelemetry increments the counters of the bucket of the day of at. Buckets older than the
+// retention period are removed when a new day starts.
+func (s *Store) RecordTelemetry(counters []string, at time.Time) error {
+	day := at.UTC().Format(telemetryDayLayout)
+	created := false
+	err := modifyJSON(s.kv, telemetryKey(day), func(initial []byte) (interface{}, error) {
+		bucket := TelemetryBucket{Day: day, Counts: map[string]int64{}}
+		created = initial == nil
+		if !created {
+			if err := json.Unmarshal(initial, &bucket); err != nil {
+				return nil, errors.Wrap(err, "failed to decode telemetry bucket")
+			}
+		}
+		for _, counter := range counters {
+			bucket.Counts[counter]++
+		}
+		return &bucket, nil
+	})
+	if err != nil || !created {
+		return err
+	}
+
+	if err := addToIndex(s.kv, telemetryIndexKey, day); err != nil {
+		return errors.Wrap(err, "failed to index telemetry bucket")
+	}
+	return s.pruneTelemetry(at.Add(-telemetryRetention).UTC().Format(telemetryDayLayout))
+}
+
+// pruneTelemetry removes the buckets of the days before oldest.
+func (s *Store) pruneTelemetry(oldest string) error {
+	days, err := getIndex(s.kv, telemetryIndexKey)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if day >= oldest {
+			continue
+		}
+		if err := removeFromIndex(s.kv, telemetryIndexKey, day); err != nil {
+			return errors.Wrap(err, "failed to unindex telemetry bucket")
+		}
+		if err := s.kv.Delete(telemetryKey(day)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTelemetry returns the buckets of the days from since to until, inclusive, in chronological
+// order. Empty bounds are open.
+func (s *Store) GetTelemetry(since, until string) ([]*TelemetryBucket, error) {
+	days, err := getIndex(s.kv, telemetryIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(days)
+
+	buckets := make([]*TelemetryBucket, 0, len(days))
+	for _, day := range days {
+		if (since != "" && day < since) || (until != "" && day > until) {
+			continue
+		}
+		var bucket TelemetryBucket
+		found, err := getJSON(s.kv, telemetryKey(day), &bucket)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			buckets = append(buckets, &bucket)
+		}
+	}
+	return buckets, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryCounters(t *testing.T) {
+	counters, err := telemetryCounters("toggle_inbox", map[string]interface{}{"action": "expand", "note": "free text"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"toggle_inbox", "toggle_inbox.action=expand"}, counters)
+
+	counters, err = telemetryCounters("rhs_add", map[string]interface{}{"list": "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rhs_add"}, counters)
+
+	_, err = telemetryCounters("delete_everything", nil)
+	assert.Error(t, err)
+}
+
+func TestRecordTelemetry(t *testing.T) {
+	store := NewStore(newMemKVStore())
+	day := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+
+	require.NoError(t, store.RecordTelemetry([]string{"click_lhs_my"}, day))
+	require.NoError(t, store.RecordTelemetry([]string{"click_lhs_my"}, day))
+	require.NoError(t, store.RecordTelemetry([]string{"click_lhs_in"}, day.Add(2*time.Hour)))
+
+	buckets, err := store.GetTelemetry("", "")
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, &TelemetryBucket{Day: "2024-03-01", Counts: map[string]int64{"click_lhs_my": 2}}, buckets[0])
+	assert.Equal(t, "2024-03-02", buckets[1].Day)
+
+	buckets, err = store.GetTelemetry("2024-03-02", "")
+	require.NoError(t, err)
+	assert.Len(t, buckets, 1)
+
+	// Buckets past the retention period are removed when a new day starts.
+	require.NoError(t, store.RecordTelemetry([]string{"click_lhs_out"}, day.Add(telemetryRetention+24*time.Hour)))
+	buckets, err = store.GetTelemetry("", "")
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "2024-03-02", buckets[0].Day)
+}
+
+func TestTelemetryRoutes(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	config := &model.Config{}
+	config.SetDefaults()
+	api.On("GetConfig").Return(func() *model.Config { return config })
+
+	w := doRequest(p, http.MethodPost, "/telemetry", "user1", map[string]interface{}{"event": "toggle_my", "properties": map[string]string{"action": "collapse"}})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = doRequest(p, http.MethodPost, "/telemetry", "user1", map[string]interface{}{"event": "bogus"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Opting out of diagnostics stops the counting.
+	config.LogSettings.EnableDiagnostics = model.NewBool(false)
+	w = doRequest(p, http.MethodPost, "/telemetry", "user1", map[string]interface{}{"event": "toggle_my"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/telemetry", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodGet, "/telemetry?from=yesterday", "admin", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(p, http.MethodGet, "/telemetry", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report TelemetryReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.False(t, report.Enabled)
+	assert.Len(t, report.Days, 1)
+	assert.Equal(t, map[string]int64{"toggle_my": 1, "toggle_my.action=collapse": 1}, report.Totals)
+
+	// Telemetry is not recorded in the audit log.
+	seq, err := p.store.LastAuditSeq()
+	require.NoError(t, err)
+	assert.Zero(t, seq)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// topicCacheKey stores the last topic list fetched from the crawler.
+const topicCacheKey = "topics_cache"
+
+// Limits of the topics a petition links to.
+const (
+	maxPetitionTopics  = 10
+	maxTopicIDLength   = 64
+	maxTopicNameLength = 256
+)
+
+// ErrTopicsUnavailable is returned when the topic crawler cannot be reached or returns no
+// usable topics.
+var ErrTopicsUnavailable = errors.New("topic crawler is unavailable")
+
+// Topic is a subject tracked by the hot-topics crawler.
+type Topic struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TopicCache is the last topic list fetched from the crawler, along with the outcome of the
+// latest attempt. The list is kept when fetching fails, so that deployments without access to
+// the crawler keep working with it.
+type TopicCache struct {
+	Topics        []*Topic `json:"topics"`
+	SourceURL     string   `json:"source_url,omitempty"`
+	FetchedAt     int64    `json:"fetched_at,omitempty"`
+	LastAttemptAt int64    `json:"last_attempt_at,omitempty"`
+	LastError     string   `json:"last_error,omitempty"`
+}
+
+// firstString returns the first of the named fields of item holding a non-empty string.
+func firstString(item map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, ok := item[name].(string); ok {
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// parseTopics reads the crawler's topic list, either a JSON array or an object wrapping it in a
+// data, topics or items field. Topics are identified by id or _id and named by name or title;
+// entries without an ID are skipped.
+func parseTopics(data []byte) ([]*Topic, error) {
+	var items []map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		var wrapper map[string]json.RawMessage
+		if json.Unmarshal(data, &wrapper) != nil {
+			return nil, errors.Wrap(err, "failed to decode topics")
+		}
+		for _, field := range []string{"data", "topics", "items"} {
+			if raw, ok := wrapper[field]; ok {
+				if err := json.Unmarshal(raw, &items); err != nil {
+					return nil, errors.Wrap(err, "failed to decode topics")
+				}
+				break
+			}
+		}
+	}
+
+	topics := make([]*Topic, 0, len(items))
+	seen := map[string]bool{}
+	for _, item := range items {
+		id := firstString(item, "id", "_id")
+		if id == "" || len(id) > maxTopicIDLength || seen[id] {
+			continue
+		}
+		seen[id] = true
+		name := firstString(item, "name", "title")
+		if name == "" {
+			name = id
+		}
+		if len(name) > maxTopicNameLength {
+			name = name[:maxTopicNameLength]
+		}
+		topics = append(topics, &Topic{ID: id, Name: strings.ToValidUTF8(name, "")})
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("no topics found")
+	}
+	return topics, nil
+}
+
+// GetTopicCache returns the cached topic list, which is empty if topics were never fetched.
+func (s *Store) GetTopicCache() (*TopicCache, error) {
+	cache := &TopicCache{Topics: []*Topic{}}
+	if _, err := getJSON(s.kv, topicCacheKey, cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// UpdateTopicCache atomically applies fn to the cached topic list.
+func (s *Store) UpdateTopicCache(fn func(*TopicCache)) (*TopicCache, error) {
+	var updated *TopicCache
+	err := modifyJSON(s.kv, topicCacheKey, func(initial []byte) (interface{}, error) {
+		cache := &TopicCache{Topics: []*Topic{}}
+		if initial != nil {
+			if err := json.Unmarshal(initial, cache); err != nil {
+				return nil, errors.Wrap(err, "failed to decode topic cache")
+			}
+		}
+		fn(cache)
+		updated = cache
+		return cache, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// normalizeTopicIDs trims and deduplicates the topic IDs a petition links to, checking their
+// number and length.
+func normalizeTopicIDs(ids []string) ([]string, error) {
+	normalized := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || len(id) > maxTopicIDLength {
+			return nil, newBadRequestError("invalid topic ID")
+		}
+		if !containsString(normalized, id) {
+			normalized = append(normalized, id)
+		}
+	}
+	if len(normalized) > maxPetitionTopics {
+		return nil, newBadRequestError(fmt.Sprintf("a petition links to at most %d topics", maxPetitionTopics))
+	}
+	return normalized, nil
+}
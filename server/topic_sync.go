@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// topicQueue names the topic refresh job in metrics and diagnostics.
+const topicQueue = "topics"
+
+const (
+	// topicPollInterval is how often the schedule of the topic refresh is checked.
+	topicPollInterval = time.Minute
+
+	// topicTimeout bounds each request to the crawler.
+	topicTimeout = 15 * time.Second
+
+	// maxTopicResponseBytes bounds the size of the crawler's response.
+	maxTopicResponseBytes = 5 * 1024 * 1024
+)
+
+// topicFetcher refreshes the cached topic list from the crawler on a schedule. The time of the
+// latest attempt is kept with the cache, so that a cluster fetches about once per interval
+// rather than once per node.
+type topicFetcher struct {
+	store  *Store
+	api    plugin.API
+	jobs   *jobTracker
+	client *http.Client
+	now    func() time.Time
+
+	// config returns the crawler URL, empty when fetching is disabled, and the refresh interval.
+	config func() (string, time.Duration)
+}
+
+func newTopicFetcher(store *Store, api plugin.API, jobs *jobTracker, config func() (string, time.Duration)) *topicFetcher {
+	return &topicFetcher{
+		store:  store,
+		api:    api,
+		jobs:   jobs,
+		client: &http.Client{Timeout: topicTimeout},
+		now:    time.Now,
+		config: config,
+	}
+}
+
+// Run refreshes the topics whenever the interval passed since the latest attempt, until stop
+// is closed.
+func (f *topicFetcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(topicPollInterval)
+	defer ticker.Stop()
+	for {
+		f.RefreshIfDue()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshIfDue refreshes the topics if fetching is enabled and the interval passed since the
+// latest attempt.
+func (f *topicFetcher) RefreshIfDue() {
+	url, interval := f.config()
+	if url == "" {
+		return
+	}
+	cache, err := f.store.GetTopicCache()
+	if err != nil {
+		f.api.LogError("Failed to load topic cache", "error", err.Error())
+		return
+	}
+	if model.GetMillisForTime(f.now())-cache.LastAttemptAt < interval.Milliseconds() {
+		return
+	}
+	if _, err := f.Refresh(); err != nil {
+		f.api.LogWarn("Failed to refresh topics", "error", err.Error())
+	}
+}
+
+// Refresh fetches the topics from the crawler and caches them. On failure the cached list is
+// kept and the error recorded with it.
+func (f *topicFetcher) Refresh() (*TopicCache, error) {
+	url, _ := f.config()
+	if url == "" {
+		return nil, newBadRequestError("topic crawler URL is not configured")
+	}
+
+	var failure error
+	finish := f.jobs.Start(topicQueue)
+	defer func() { finish(failure) }()
+
+	topics, failure := f.fetch(url)
+	now := model.GetMillisForTime(f.now())
+	cache, err := f.store.UpdateTopicCache(func(cache *TopicCache) {
+		cache.LastAttemptAt = now
+		if failure != nil {
+			cache.LastError = failure.Error()
+			return
+		}
+		cache.Topics = topics
+		cache.SourceURL = url
+		cache.FetchedAt = now
+		cache.LastError = ""
+	})
+	if failure != nil {
+		return nil, errors.Wrap(ErrTopicsUnavailable, failure.Error())
+	}
+	if err != nil {
+		failure = err
+		return nil, err
+	}
+	return cache, nil
+}
+
+func (f *topicFetcher) fetch(url string) ([]*Topic, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTopicResponseBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read topics")
+	}
+	return parseTopics(data)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopics(t *testing.T) {
+	topics, err := parseTopics([]byte(`[{"id": "t1", "name": "Roads"}, {"_id": "t2", "title": "Water"}, {"name": "No ID"}, {"id": "t1"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []*Topic{{ID: "t1", Name: "Roads"}, {ID: "t2", Name: "Water"}}, topics)
+
+	topics, err = parseTopics([]byte(`{"data": [{"id": "t3"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []*Topic{{ID: "t3", Name: "t3"}}, topics)
+
+	_, err = parseTopics([]byte(`{"data": []}`))
+	assert.Error(t, err)
+	_, err = parseTopics([]byte(`<html>`))
+	assert.Error(t, err)
+}
+
+func TestTopicRefresh(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	crawler := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(`[{"id": "hot", "name": "Flooding"}, {"id": "t2", "name": "Roads"}]`))
+	}))
+	defer crawler.Close()
+	p.setConfiguration(&configuration{TopicsURL: crawler.URL, HotTopicID: "hot", TopicsRefreshMinutes: 30})
+
+	// Nothing was fetched yet.
+	w := doRequest(p, http.MethodGet, "/topics", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list TopicList
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Empty(t, list.Topics)
+
+	start := time.Now()
+	p.topics.now = func() time.Time { return start }
+	p.topics.RefreshIfDue()
+	w = doRequest(p, http.MethodGet, "/topics", "user1", nil)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(t, []*Topic{{ID: "hot", Name: "Flooding"}, {ID: "t2", Name: "Roads"}}, list.Topics)
+	assert.Equal(t, "hot", list.HotTopicID)
+	assert.False(t, list.Stale)
+
+	// When the crawler fails, the last list keeps being served.
+	status.Store(http.StatusServiceUnavailable)
+	p.topics.RefreshIfDue()
+	cache, err := p.store.GetTopicCache()
+	require.NoError(t, err)
+	assert.Empty(t, cache.LastError, "refreshed before the interval passed")
+
+	p.topics.now = func() time.Time { return start.Add(31 * time.Minute) }
+	p.topics.RefreshIfDue()
+	w = doRequest(p, http.MethodGet, "/topics", "user1", nil)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Len(t, list.Topics, 2)
+	assert.True(t, list.Stale)
+
+	w = doRequest(p, http.MethodPost, "/topics/refresh", "user1", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPost, "/topics/refresh", "admin", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	status.Store(http.StatusOK)
+	w = doRequest(p, http.MethodPost, "/topics/refresh", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.False(t, list.Stale)
+}
+
+func TestPetitionTopics(t *testing.T) {
+	p, _ := setupTestPlugin(t)
+	petition := createTestPetition(t, p, "user1")
+
+	// Any topic is accepted while none were fetched.
+	w := doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]interface{}{"topic_ids": []string{"legacy", "legacy"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	var updated Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, []string{"legacy"}, updated.TopicIDs)
+
+	_, err := p.store.UpdateTopicCache(func(cache *TopicCache) {
+		cache.Topics = []*Topic{{ID: "hot", Name: "Flooding"}}
+	})
+	require.NoError(t, err)
+
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]interface{}{"topic_ids": []string{"legacy", "unknown"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "user1", map[string]interface{}{"topic_ids": []string{"legacy", "hot"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest(p, http.MethodPost, "/requests", "user1", map[string]interface{}{
+		"title":       "Flooded road",
+		"priority":    2,
+		"category_id": petition.CategoryID,
+		"topic_ids":   []string{"unknown"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doRequest(p, http.MethodGet, "/requests?topic=hot", "user1", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var petitions []*Petition
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petitions))
+	require.Len(t, petitions, 1)
+	assert.Equal(t, petition.ID, petitions[0].ID)
+
+	w = doRequest(p, http.MethodGet, "/requests?topic=other", "user1", nil)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&petitions))
+	assert.Empty(t, petitions)
+}
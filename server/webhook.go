@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	webhookKeyPrefix         = "webhook_sub_"
+	webhookIndexKey          = "webhook_sub_ids"
+	webhookDeliveryKeyPrefix = "webhook_delivery_"
+	webhookQueueKey          = "webhook_queue"
+	webhookDeadLetterKey     = "webhook_dead_letters"
+	webhookLogKey            = "webhook_log"
+)
+
+// Petition events sent to webhook subscriptions.
+const (
+	WebhookEventPetitionCreated   = "petition.created"
+	WebhookEventPetitionForwarded = "petition.forwarded"
+	WebhookEventPetitionResolved  = "petition.resolved"
+)
+
+// States of a webhook delivery.
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+// maxWebhookLog bounds the number of deliveries kept in the delivery log. Older delivered
+// deliveries are removed; pending and dead ones stay until they are delivered or retried.
+const maxWebhookLog = 1000
+
+func isValidWebhookEvent(event string) bool {
+	switch event {
+	case WebhookEventPetitionCreated, WebhookEventPetitionForwarded, WebhookEventPetitionResolved:
+		return true
+	}
+	return false
+}
+
+// WebhookSubscription sends the petition events it lists to URL. Payloads are signed with
+// Secret, which is only returned when the subscription is created.
+type WebhookSubscription struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	Active    bool     `json:"active"`
+	CreatorID string   `json:"creator_id"`
+	CreateAt  int64    `json:"create_at"`
+	UpdateAt  int64    `json:"update_at"`
+}
+
+func webhookKey(id string) string {
+	return webhookKeyPrefix + id
+}
+
+// IsValid reports whether the subscription has an HTTP URL and known events.
+func (s *WebhookSubscription) IsValid() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return newBadRequestError("url must be an http or https URL")
+	}
+	if len(s.Events) == 0 {
+		return newBadRequestError("at least one event is required")
+	}
+	for _, event := range s.Events {
+		if !isValidWebhookEvent(event) {
+			return newBadRequestError("invalid event " + event)
+		}
+	}
+	return nil
+}
+
+// Subscribes reports whether the subscription is active and lists event.
+func (s *WebhookSubscription) Subscribes(event string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, subscribed := range s.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the subscription without its secret, for listing and auditing.
+func (s *WebhookSubscription) Redacted() *WebhookSubscription {
+	redacted := *s
+	redacted.Secret = ""
+	return &redacted
+}
+
+// NewWebhookSubscription returns an active subscription with a freshly generated ID and secret.
+func NewWebhookSubscription(rawURL string, events []string, creatorID string) (*WebhookSubscription, error) {
+	now := model.GetMillis()
+	subscription := &WebhookSubscription{
+		ID:        model.NewId(),
+		URL:       strings.TrimSpace(rawURL),
+		Events:    events,
+		Secret:    model.NewId() + model.NewId(),
+		Active:    true,
+		CreatorID: creatorID,
+		CreateAt:  now,
+		UpdateAt:  now,
+	}
+	if err := subscription.IsValid(); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// signWebhookPayload returns the signature of a payload sent at timestamp, in seconds: the hex
+// HMAC-SHA256 of "timestamp.payload" keyed with the subscription secret, prefixed by "sha256=".
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookPayload is the body posted to subscriptions.
+type WebhookPayload struct {
+	Event    string    `json:"event"`
+	CreateAt int64     `json:"create_at"`
+	Petition *Petition `json:"petition"`
+}
+
+// DeliveryAttempt records one attempt to deliver a webhook. Duration is in milliseconds.
+type DeliveryAttempt struct {
+	CreateAt   int64  `json:"create_at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Duration   int64  `json:"duration"`
+}
+
+// WebhookDelivery is the delivery of an event to a subscription. Pending deliveries wait in the
+// queue until NextAttemptAt; the node sending one holds it until LeaseUntil. Failures counts the
+// failed attempts since the delivery was queued or last retried.
+type WebhookDelivery struct {
+	ID             string             `json:"id"`
+	SubscriptionID string             `json:"subscription_id"`
+	Event          string             `json:"event"`
+	Payload        json.RawMessage    `json:"payload"`
+	Status         string             `json:"status"`
+	Failures       int                `json:"failures"`
+	Attempts       []*DeliveryAttempt `json:"attempts"`
+	NextAttemptAt  int64              `json:"next_attempt_at,omitempty"`
+	LeaseUntil     int64              `json:"lease_until,omitempty"`
+	CreateAt       int64              `json:"create_at"`
+	UpdateAt       int64              `json:"update_at"`
+}
+
+func webhookDeliveryKey(id string) string {
+	return webhookDeliveryKeyPrefix + id
+}
+
+// SaveWebhookSubscription stores a new subscription and indexes it.
+func (s *Store) SaveWebhookSubscription(subscription *WebhookSubscription) error {
+	if err := setJSON(s.kv, webhookKey(subscription.ID), subscription); err != nil {
+		return err
+	}
+	return addToIndex(s.kv, webhookIndexKey, subscription.ID)
+}
+
+// GetWebhookSubscription returns the subscription with the given ID.
+func (s *Store) GetWebhookSubscription(id string) (*WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	found, err := getJSON(s.kv, webhookKey(id), &subscription)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &subscription, nil
+}
+
+// GetWebhookSubscriptions returns every subscription in creation order.
+func (s *Store) GetWebhookSubscriptions() ([]*WebhookSubscription, error) {
+	ids, err := getIndex(s.kv, webhookIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]*WebhookSubscription, 0, len(ids))
+	for _, id := range ids {
+		subscription, err := s.GetWebhookSubscription(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// UpdateWebhookSubscription atomically applies fn to the subscription with the given ID and
+// returns the result.
+func (s *Store) UpdateWebhookSubscription(id string, fn func(*WebhookSubscription) error) (*WebhookSubscription, error) {
+	var updated *WebhookSubscription
+	err := modifyJSON(s.kv, webhookKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var subscription WebhookSubscription
+		if err := json.Unmarshal(initial, &subscription); err != nil {
+			return nil, errors.Wrap(err, "failed to decode webhook subscription")
+		}
+		if err := fn(&subscription); err != nil {
+			return nil, err
+		}
+		updated = &subscription
+		return &subscription, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteWebhookSubscription removes the subscription with the given ID. Its pending deliveries
+// are dead-lettered when they come up.
+func (s *Store) DeleteWebhookSubscription(id string) error {
+	if err := removeFromIndex(s.kv, webhookIndexKey, id); err != nil {
+		return errors.Wrap(err, "failed to unindex webhook subscription")
+	}
+	return s.kv.Delete(webhookKey(id))
+}
+
+// EnqueueWebhookDelivery stores a pending delivery, queues it and adds it to the delivery log,
+// trimming the log to its size limit.
+func (s *Store) EnqueueWebhookDelivery(delivery *WebhookDelivery) error {
+	if err := setJSON(s.kv, webhookDeliveryKey(delivery.ID), delivery); err != nil {
+		return err
+	}
+	if err := addToIndex(s.kv, webhookQueueKey, delivery.ID); err != nil {
+		return errors.Wrap(err, "failed to queue webhook delivery")
+	}
+	if err := addToIndex(s.kv, webhookLogKey, delivery.ID); err != nil {
+		return errors.Wrap(err, "failed to log webhook delivery")
+	}
+	return s.trimWebhookLog()
+}
+
+// trimWebhookLog drops the oldest deliveries from the log once it exceeds maxWebhookLog, and
+// deletes those that were delivered.
+func (s *Store) trimWebhookLog() error {
+	ids, err := getIndex(s.kv, webhookLogKey)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids[:max(0, len(ids)-maxWebhookLog)] {
+		if err := removeFromIndex(s.kv, webhookLogKey, id); err != nil {
+			return errors.Wrap(err, "failed to trim webhook log")
+		}
+		delivery, err := s.GetWebhookDelivery(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if delivery.Status == DeliveryStatusDelivered {
+			if err := s.kv.Delete(webhookDeliveryKey(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetWebhookDelivery returns the delivery with the given ID.
+func (s *Store) GetWebhookDelivery(id string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	found, err := getJSON(s.kv, webhookDeliveryKey(id), &delivery)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &delivery, nil
+}
+
+// getWebhookDeliveries returns the deliveries listed by the index under key, in index order.
+func (s *Store) getWebhookDeliveries(key string) ([]*WebhookDelivery, error) {
+	ids, err := getIndex(s.kv, key)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := s.GetWebhookDelivery(id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetQueuedWebhookDeliveries returns the pending deliveries, oldest first.
+func (s *Store) GetQueuedWebhookDeliveries() ([]*WebhookDelivery, error) {
+	return s.getWebhookDeliveries(webhookQueueKey)
+}
+
+// GetDeadWebhookDeliveries returns the deliveries that exhausted their attempts, oldest first.
+func (s *Store) GetDeadWebhookDeliveries() ([]*WebhookDelivery, error) {
+	return s.getWebhookDeliveries(webhookDeadLetterKey)
+}
+
+// GetWebhookDeliveryLog returns the most recent deliveries, oldest first.
+func (s *Store) GetWebhookDeliveryLog() ([]*WebhookDelivery, error) {
+	return s.getWebhookDeliveries(webhookLogKey)
+}
+
+// UpdateWebhookDelivery atomically applies fn to the delivery with the given ID, then moves it
+// between the queue and the dead-letter list according to its new status.
+func (s *Store) UpdateWebhookDelivery(id string, fn func(*WebhookDelivery) error) (*WebhookDelivery, error) {
+	var updated *WebhookDelivery
+	err := modifyJSON(s.kv, webhookDeliveryKey(id), func(initial []byte) (interface{}, error) {
+		if initial == nil {
+			return nil, ErrNotFound
+		}
+		var delivery WebhookDelivery
+		if err := json.Unmarshal(initial, &delivery); err != nil {
+			return nil, errors.Wrap(err, "failed to decode webhook delivery")
+		}
+		if err := fn(&delivery); err != nil {
+			return nil, err
+		}
+		updated = &delivery
+		return &delivery, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch updated.Status {
+	case DeliveryStatusPending:
+		err = removeFromIndex(s.kv, webhookDeadLetterKey, id)
+		if err == nil {
+			err = addToIndex(s.kv, webhookQueueKey, id)
+		}
+	case DeliveryStatusDead:
+		err = removeFromIndex(s.kv, webhookQueueKey, id)
+		if err == nil {
+			err = addToIndex(s.kv, webhookDeadLetterKey, id)
+		}
+	default:
+		err = removeFromIndex(s.kv, webhookQueueKey, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to index webhook delivery")
+	}
+	return updated, nil
+}
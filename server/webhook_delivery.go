@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// webhookQueue names the webhook delivery job and its queue in metrics and diagnostics.
+const webhookQueue = "webhooks"
+
+const (
+	// webhookPollInterval is how often the queue is checked for deliveries coming due.
+	webhookPollInterval = 10 * time.Second
+
+	// webhookTimeout bounds each delivery attempt.
+	webhookTimeout = 10 * time.Second
+
+	// webhookLease is how long a node sending a delivery holds it. It exceeds webhookTimeout, so
+	// that other nodes only take over deliveries whose sender went away.
+	webhookLease = time.Minute
+
+	// webhookMaxFailures is the number of failed attempts after which a delivery is dead-lettered.
+	webhookMaxFailures = 8
+
+	// Retries wait webhookBaseBackoff after the first failure, doubling after each further one
+	// up to webhookMaxBackoff.
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+
+	// maxWebhookResponseBytes bounds the part of a response body read before closing it.
+	maxWebhookResponseBytes = 64 * 1024
+)
+
+// Headers sent with webhook deliveries. Receivers verify the signature by computing the
+// HMAC-SHA256 of "<timestamp>.<body>" with the subscription secret.
+const (
+	headerWebhookEvent     = "X-Xlkn-Event"
+	headerWebhookDelivery  = "X-Xlkn-Delivery"
+	headerWebhookTimestamp = "X-Xlkn-Timestamp"
+	headerWebhookSignature = "X-Xlkn-Signature"
+)
+
+// errDeliveryNotDue is returned by delivery updates to skip deliveries that are not due or are
+// being sent by another node.
+var errDeliveryNotDue = errors.New("delivery is not due")
+
+// webhookBackoff returns the delay before retrying a delivery that failed failures times.
+func webhookBackoff(failures int) time.Duration {
+	delay := webhookBaseBackoff
+	for i := 1; i < failures && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	return delay
+}
+
+// webhookDispatcher sends the queued webhook deliveries. The queue is persisted in the key-value
+// store, so deliveries survive restarts, and every cluster node may send them: a node leases a
+// delivery before sending it.
+type webhookDispatcher struct {
+	store   *Store
+	api     plugin.API
+	metrics *metrics
+	jobs    *jobTracker
+	client  *http.Client
+	now     func() time.Time
+
+	// wake prompts Run to check the queue before the next poll.
+	wake chan struct{}
+}
+
+func newWebhookDispatcher(store *Store, api plugin.API, m *metrics, jobs *jobTracker) *webhookDispatcher {
+	return &webhookDispatcher{
+		store:   store,
+		api:     api,
+		metrics: m,
+		jobs:    jobs,
+		client:  &http.Client{Timeout: webhookTimeout},
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues the delivery of event about petition to every subscription to the event.
+func (d *webhookDispatcher) Enqueue(event string, petition *Petition) error {
+	subscriptions, err := d.store.GetWebhookSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	now := model.GetMillisForTime(d.now())
+	payload, err := json.Marshal(&WebhookPayload{Event: event, CreateAt: now, Petition: petition})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook payload")
+	}
+	queued := false
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(event) {
+			continue
+		}
+		delivery := &WebhookDelivery{
+			ID:             model.NewId(),
+			SubscriptionID: subscription.ID,
+			Event:          event,
+			Payload:        payload,
+			Status:         DeliveryStatusPending,
+			Attempts:       []*DeliveryAttempt{},
+			NextAttemptAt:  now,
+			CreateAt:       now,
+			UpdateAt:       now,
+		}
+		if err := d.store.EnqueueWebhookDelivery(delivery); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		d.Wake()
+	}
+	return nil
+}
+
+// Wake prompts Run to check the queue at once.
+func (d *webhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the deliveries coming due until stop is closed.
+func (d *webhookDispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		d.ProcessDue()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// ProcessDue attempts every due delivery that no other node is sending.
+func (d *webhookDispatcher) ProcessDue() {
+	deliveries, err := d.store.GetQueuedWebhookDeliveries()
+	if err != nil {
+		d.api.LogError("Failed to load webhook queue", "error", err.Error())
+		return
+	}
+	d.metrics.SetQueueSize(webhookQueue, len(deliveries))
+
+	now := model.GetMillisForTime(d.now())
+	var due []string
+	for _, delivery := range deliveries {
+		if delivery.NextAttemptAt <= now && delivery.LeaseUntil <= now {
+			due = append(due, delivery.ID)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	var failure error
+	finish := d.jobs.Start(webhookQueue)
+	defer func() { finish(failure) }()
+	for _, id := range due {
+		if err := d.attempt(id); err != nil {
+			d.api.LogError("Failed to process webhook delivery", "delivery_id", id, "error", err.Error())
+			failure = err
+		}
+	}
+	if deliveries, err := d.store.GetQueuedWebhookDeliveries(); err == nil {
+		d.metrics.SetQueueSize(webhookQueue, len(deliveries))
+	}
+}
+
+// attempt leases the delivery with the given ID if it is still due, sends it and records the
+// outcome, scheduling a retry or dead-lettering it on failure.
+func (d *webhookDispatcher) attempt(id string) error {
+	now := model.GetMillisForTime(d.now())
+	delivery, err := d.store.UpdateWebhookDelivery(id, func(delivery *WebhookDelivery) error {
+		if delivery.Status != DeliveryStatusPending || delivery.NextAttemptAt > now || delivery.LeaseUntil > now {
+			return errDeliveryNotDue
+		}
+		delivery.LeaseUntil = now + webhookLease.Milliseconds()
+		return nil
+	})
+	if err == errDeliveryNotDue || err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attempt, permanent := d.send(delivery)
+	delivery, err = d.store.UpdateWebhookDelivery(id, func(delivery *WebhookDelivery) error {
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.LeaseUntil = 0
+		delivery.UpdateAt = model.GetMillisForTime(d.now())
+		if attempt.Error == "" {
+			delivery.Status = DeliveryStatusDelivered
+			delivery.NextAttemptAt = 0
+			return nil
+		}
+
+		delivery.Failures++
+		if permanent || delivery.Failures >= webhookMaxFailures {
+			delivery.Status = DeliveryStatusDead
+			delivery.NextAttemptAt = 0
+			return nil
+		}
+		delivery.NextAttemptAt = delivery.UpdateAt + webhookBackoff(delivery.Failures).Milliseconds()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if delivery.Status == DeliveryStatusDead {
+		d.api.LogWarn("Webhook delivery dead-lettered", "delivery_id", delivery.ID, "subscription_id", delivery.SubscriptionID, "error", attempt.Error)
+	}
+	return nil
+}
+
+// send posts the delivery's payload to its subscription. It reports whether a failure is
+// permanent, as when the subscription was deleted or deactivated.
+func (d *webhookDispatcher) send(delivery *WebhookDelivery) (*DeliveryAttempt, bool) {
+	start := d.now()
+	attempt := &DeliveryAttempt{CreateAt: model.GetMillisForTime(start)}
+	defer func() { attempt.Duration = d.now().Sub(start).Milliseconds() }()
+
+	subscription, err := d.store.GetWebhookSubscription(delivery.SubscriptionID)
+	if err == ErrNotFound {
+		attempt.Error = "subscription was deleted"
+		return attempt, true
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	if !subscription.Active {
+		attempt.Error = "subscription is inactive"
+		return attempt, true
+	}
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, true
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWebhookEvent, delivery.Event)
+	req.Header.Set(headerWebhookDelivery, delivery.ID)
+	req.Header.Set(headerWebhookTimestamp, timestamp)
+	req.Header.Set(headerWebhookSignature, signWebhookPayload(subscription.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBytes))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = "unexpected status " + resp.Status
+	}
+	return attempt, false
+}
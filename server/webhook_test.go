@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhookBackoff(1))
+	assert.Equal(t, time.Minute, webhookBackoff(2))
+	assert.Equal(t, 4*time.Minute, webhookBackoff(4))
+	assert.Equal(t, webhookMaxBackoff, webhookBackoff(20))
+}
+
+func TestWebhookSubscriptionIsValid(t *testing.T) {
+	_, err := NewWebhookSubscription("https://example.com/hook", []string{WebhookEventPetitionCreated}, "admin")
+	assert.NoError(t, err)
+	_, err = NewWebhookSubscription("ftp://example.com", []string{WebhookEventPetitionCreated}, "admin")
+	assert.Error(t, err)
+	_, err = NewWebhookSubscription("https://example.com/hook", nil, "admin")
+	assert.Error(t, err)
+	_, err = NewWebhookSubscription("https://example.com/hook", []string{"petition.deleted"}, "admin")
+	assert.Error(t, err)
+}
+
+// webhookReceiver is a local stand-in for a system receiving webhooks.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, body)
+	w.WriteHeader(rec.status)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	p, api := setupTestPlugin(t)
+	api.On("HasPermissionTo", mock.Anything, model.PermissionManageSystem).Return(func(userID string, _ *model.Permission) bool {
+		return userID == "admin"
+	})
+	api.On("LogWarn", "Webhook delivery dead-lettered", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	receiver := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	now := time.Now()
+	p.webhooks.now = func() time.Time { return now }
+
+	w := doRequest(p, http.MethodPost, "/webhooks", "user1", map[string]interface{}{"url": server.URL, "events": []string{WebhookEventPetitionCreated}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doRequest(p, http.MethodPost, "/webhooks", "admin", map[string]interface{}{"url": server.URL, "events": []string{WebhookEventPetitionCreated, WebhookEventPetitionResolved}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var subscription WebhookSubscription
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&subscription))
+	require.NotEmpty(t, subscription.Secret)
+
+	w = doRequest(p, http.MethodGet, "/webhooks", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), subscription.Secret)
+
+	petition := createTestPetition(t, p, "user1")
+	p.webhooks.ProcessDue()
+
+	require.Len(t, receiver.requests, 1)
+	req := receiver.requests[0]
+	assert.Equal(t, WebhookEventPetitionCreated, req.Header.Get(headerWebhookEvent))
+	assert.Equal(t, signWebhookPayload(subscription.Secret, req.Header.Get(headerWebhookTimestamp), receiver.bodies[0]), req.Header.Get(headerWebhookSignature))
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal(receiver.bodies[0], &payload))
+	assert.Equal(t, petition.ID, payload.Petition.ID)
+
+	// Failed deliveries are retried with backoff, then dead-lettered.
+	receiver.status = http.StatusInternalServerError
+	w = doRequest(p, http.MethodPut, "/requests/"+petition.ID, "admin", map[string]string{"status": StatusResolved})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	for i := 1; i <= webhookMaxFailures; i++ {
+		p.webhooks.ProcessDue()
+		require.Len(t, receiver.requests, 1+i)
+		p.webhooks.ProcessDue()
+		require.Len(t, receiver.requests, 1+i, "retries wait for the backoff")
+		now = now.Add(webhookBackoff(i))
+	}
+
+	w = doRequest(p, http.MethodGet, "/webhooks/dead_letters", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var dead []*WebhookDelivery
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&dead))
+	require.Len(t, dead, 1)
+	assert.Equal(t, WebhookEventPetitionResolved, dead[0].Event)
+	assert.Len(t, dead[0].Attempts, webhookMaxFailures)
+	assert.Equal(t, http.StatusInternalServerError, dead[0].Attempts[0].StatusCode)
+
+	receiver.status = http.StatusNoContent
+	w = doRequest(p, http.MethodPost, "/webhooks/deliveries/"+dead[0].ID+"/retry", "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doRequest(p, http.MethodPost, "/webhooks/deliveries/"+dead[0].ID+"/retry", "admin", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	p.webhooks.ProcessDue()
+
+	w = doRequest(p, http.MethodGet, "/webhooks/deliveries?status="+DeliveryStatusDelivered, "admin", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var delivered []*WebhookDelivery
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&delivered))
+	assert.Len(t, delivered, 2)
+	assert.Equal(t, "2", w.Header().Get(headerTotalCount))
+
+	// Deliveries to deleted subscriptions are dead-lettered at once.
+	w = doRequest(p, http.MethodPost, "/requests", "user1", map[string]interface{}{"title": "Noise", "priority": 1, "category_id": petition.CategoryID})
+	require.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(p, http.MethodDelete, "/webhooks/"+subscription.ID, "admin", nil)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	p.webhooks.ProcessDue()
+	dead, err := p.store.GetDeadWebhookDeliveries()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "subscription was deleted", dead[0].Attempts[0].Error)
+}
@@ -0,0 +1,17 @@
+import axios from 'axios';
+import { API_URL, CONST } from '../common/enum'
+
+export const apiTopic = {
+    // The plugin serves the topics it caches from the crawler, along with the configured hot
+    // topic; the default one is used when none is configured.
+    getAll() {
+        return axios.get(`${API_URL.GET_TOPICS_LIST}`,
+            {
+                withCredentials: true,
+            }).then(({ data }) => ({
+                topics: data.topics,
+                hotTopicId: data.hot_topic_id || CONST.HOT_TOPIC_ID,
+                stale: data.stale,
+            }));
+    }
+};
@@ -1,6 +1,6 @@
 export enum API_URL {
     HOST = "https://serverxlkn.onrender.com",
-    GET_TOPICS_LIST = "https://crawler.deepaicare.com/api/topic",
+    GET_TOPICS_LIST = "/plugins/plugin-xlkn/topics",
 };
 export enum CONST {
     HOT_TOPIC_ID = "8320840b-e2fc-42fa-9614-3dd66083d795",